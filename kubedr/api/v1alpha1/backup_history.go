@@ -0,0 +1,46 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// RecordRun adds a backup to the history, dropping the oldest ones beyond
+// MaxBackupRuns, and updates the fields derived from the history. A backup
+// that was already recorded, going by its pod, is ignored.
+func (s *BackupHistory) RecordRun(run BackupRun) {
+	if n := len(s.History); n > 0 && run.Pod != "" && s.History[n-1].Pod == run.Pod {
+		return
+	}
+
+	s.History = append(s.History, run)
+	if n := len(s.History); n > MaxBackupRuns {
+		s.History = append([]BackupRun(nil), s.History[n-MaxBackupRuns:]...)
+	}
+
+	if run.Result == "Completed" {
+		s.ConsecutiveFailures = 0
+		s.LastSuccessfulBackupTime = run.CompletionTime
+	} else {
+		s.ConsecutiveFailures++
+	}
+
+	succeeded := 0
+	for _, r := range s.History {
+		if r.Result == "Completed" {
+			succeeded++
+		}
+	}
+	s.SuccessRatePercent = int32(succeeded * 100 / len(s.History))
+}
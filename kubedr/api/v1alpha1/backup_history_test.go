@@ -0,0 +1,70 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecordRun(t *testing.T) {
+	base := time.Date(2020, time.March, 30, 22, 0, 0, 0, time.UTC)
+
+	run := func(i int, result string) BackupRun {
+		completion := metav1.NewTime(base.Add(time.Duration(i) * time.Hour))
+		return BackupRun{CompletionTime: &completion, Result: result, Pod: fmt.Sprintf("backup-%d", i)}
+	}
+
+	var status MetadataBackupPolicyStatus
+	status.RecordRun(run(0, "Completed"))
+	status.RecordRun(run(1, "Failed"))
+	status.RecordRun(run(2, "Failed"))
+
+	// The same backup is only recorded once.
+	status.RecordRun(run(2, "Failed"))
+
+	if len(status.History) != 3 {
+		t.Fatalf("expected 3 runs, got %d", len(status.History))
+	}
+	if status.ConsecutiveFailures != 2 {
+		t.Fatalf("expected 2 consecutive failures, got %d", status.ConsecutiveFailures)
+	}
+	if status.SuccessRatePercent != 33 {
+		t.Fatalf("expected success rate of 33%%, got %d%%", status.SuccessRatePercent)
+	}
+	if !status.LastSuccessfulBackupTime.Equal(run(0, "").CompletionTime) {
+		t.Fatalf("unexpected last successful backup time: %v", status.LastSuccessfulBackupTime)
+	}
+
+	for i := 3; i < 3+MaxBackupRuns; i++ {
+		status.RecordRun(run(i, "Completed"))
+	}
+
+	if len(status.History) != MaxBackupRuns {
+		t.Fatalf("expected %d runs, got %d", MaxBackupRuns, len(status.History))
+	}
+	if status.History[0].Pod != "backup-3" {
+		t.Fatalf("expected the oldest runs to be dropped, first run is %s", status.History[0].Pod)
+	}
+	if status.ConsecutiveFailures != 0 || status.SuccessRatePercent != 100 {
+		t.Fatalf("unexpected derived fields: %d failures, %d%%", status.ConsecutiveFailures,
+			status.SuccessRatePercent)
+	}
+}
@@ -17,24 +17,376 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// Names of the supported backup engines.
+const (
+	EngineRestic = "restic"
+	EngineTarGz  = "targz"
+)
+
+// Values of "deletionPolicy".
+const (
+	// Backups are left in place when the BackupLocation is deleted.
+	DeletionPolicyRetain = "Retain"
+
+	// All backups are deleted along with the BackupLocation.
+	DeletionPolicyPurge = "Purge"
+)
+
+// Retention modes of S3 Object Lock.
+const (
+	// Users with special permissions can delete locked objects.
+	ObjectLockGovernance = "GOVERNANCE"
+
+	// Nobody can delete locked objects.
+	ObjectLockCompliance = "COMPLIANCE"
+)
+
+// ForceDeleteAnnotation, if set to "true", allows a BackupLocation to be
+// deleted even if it is still in use.
+const ForceDeleteAnnotation = "kubedr.catalogicsoftware.com/force-delete"
+
+// Default names of the keys in the credentials secret.
+const (
+	DefaultAccessKeyName    = "access_key"
+	DefaultSecretKeyName    = "secret_key"
+	DefaultRepoPasswordName = "restic_repo_password"
+)
+
+// CredentialKeys maps the values needed by KubeDR to the keys of the
+// credentials secret. Keys that are not given have the default names.
+type CredentialKeys struct {
+	// If not provided, "access_key" is used.
+	// +kubebuilder:validation:Optional
+	AccessKey string `json:"accessKey,omitempty"`
+
+	// If not provided, "secret_key" is used.
+	// +kubebuilder:validation:Optional
+	SecretKey string `json:"secretKey,omitempty"`
+
+	// Key containing the session token of temporary credentials. There
+	// is no default, session token is not used unless this is given.
+	// +kubebuilder:validation:Optional
+	SessionToken string `json:"sessionToken,omitempty"`
+
+	// If not provided, "restic_repo_password" is used.
+	// +kubebuilder:validation:Optional
+	RepoPassword string `json:"repoPassword,omitempty"`
+}
+
+// WebIdentity describes S3 credentials that are obtained by assuming a role
+// with a projected service account token, as done by IAM roles for service
+// accounts.
+type WebIdentity struct {
+	// ARN of the role to assume.
+	// kubebuilder:validation:MinLength:=1
+	RoleARN string `json:"roleArn"`
+
+	// Audience of the token. If not provided, "sts.amazonaws.com" is used.
+	// +kubebuilder:validation:Optional
+	Audience string `json:"audience,omitempty"`
+
+	// Requested lifetime of the token. If not provided, one hour is used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=600
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
+}
+
+// FilesystemTarget describes a backup repository that is kept on a volume
+// instead of in an object store. Exactly one of "pvcName" and "nfs" must be
+// given.
+type FilesystemTarget struct {
+	// Name of a PersistentVolumeClaim in the namespace of the BackupLocation.
+	// +kubebuilder:validation:Optional
+	PVCName string `json:"pvcName,omitempty"`
+
+	// NFS export to be mounted directly in the pods that access the repo.
+	// +kubebuilder:validation:Optional
+	NFS *corev1.NFSVolumeSource `json:"nfs,omitempty"`
+
+	// Directory, relative to the root of the volume, in which the repo
+	// is stored. If not provided, root of the volume is used. It can't
+	// be absolute or contain "..".
+	// +kubebuilder:validation:Optional
+	Path string `json:"path,omitempty"`
+}
+
+// ObjectLock describes the retention set on the backup data written to a
+// bucket that has S3 Object Lock enabled. Such data can't be deleted, even
+// by KubeDR, until the retention period ends.
+type ObjectLock struct {
+	// +kubebuilder:validation:Enum=GOVERNANCE;COMPLIANCE
+	Mode string `json:"mode"`
+
+	// Number of days, from the time of a backup, for which its data is
+	// locked.
+	// +kubebuilder:validation:Minimum=1
+	RetentionDays int64 `json:"retentionDays"`
+}
+
+// CABundleSource refers to a PEM encoded bundle of CA certificates. Exactly
+// one of "configMapKeyRef" and "secretKeyRef" must be given.
+type CABundleSource struct {
+	// +kubebuilder:validation:Optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// TLSOptions control how the TLS certificate of a S3 end point is verified.
+type TLSOptions struct {
+	// CA certificates used, in addition to the system ones, to verify
+	// the end point.
+	// +kubebuilder:validation:Optional
+	CABundle *CABundleSource `json:"caBundle,omitempty"`
+
+	// If true, the certificate of the end point is not verified at all.
+	// Only meant for testing.
+	// +kubebuilder:validation:Optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
 // BackupLocationSpec defines the desired state of BackupLocation
 type BackupLocationSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// kubebuilder:validation:MinLength:=1
-	Url string `json:"url"`
-	// kubebuilder:validation:MinLength:=1
-	BucketName string `json:"bucketName"`
+	// S3 end point. Required unless "filesystem" is given.
+	// +kubebuilder:validation:Optional
+	Url string `json:"url,omitempty"`
+	// Required unless "filesystem" is given.
+	// +kubebuilder:validation:Optional
+	BucketName string `json:"bucketName,omitempty"`
 
-	// name of the secret
-	// kubebuilder:validation:MinLength:=1
-	Credentials string `json:"credentials"`
+	// Directory, within the bucket (or within "filesystem.path"), in which
+	// the repo is stored. This allows several clusters to share a bucket.
+	// It is a Go template that can refer to "{{.ClusterName}}" (as given
+	// to the manager), "{{.Namespace}}" and "{{.Name}}" of the
+	// BackupLocation, for example "clusters/{{.ClusterName}}".
+	// +kubebuilder:validation:Optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// TLS options for a S3 end point using "https".
+	// +kubebuilder:validation:Optional
+	TLS *TLSOptions `json:"tls,omitempty"`
+
+	// If given, backup data is written with object lock retention. The
+	// bucket must have object lock enabled (it is enabled if KubeDR
+	// creates the bucket). Only supported by the "targz" engine, restic
+	// needs to delete objects to prune and unlock the repo.
+	// +kubebuilder:validation:Optional
+	ObjectLock *ObjectLock `json:"objectLock,omitempty"`
+
+	// If given, the repo is stored on a volume (PVC or NFS) instead of S3.
+	// +kubebuilder:validation:Optional
+	Filesystem *FilesystemTarget `json:"filesystem,omitempty"`
+
+	// Name of the secret containing S3 credentials and the repo password.
+	// Required unless neither of them is needed from this secret.
+	// +kubebuilder:validation:Optional
+	Credentials string `json:"credentials,omitempty"`
+
+	// Names of the keys in the credentials secret.
+	// +kubebuilder:validation:Optional
+	CredentialKeys *CredentialKeys `json:"credentialKeys,omitempty"`
+
+	// If given, the repo password is read from this secret instead of
+	// the credentials secret.
+	// +kubebuilder:validation:Optional
+	RepoPasswordSecret *corev1.SecretKeySelector `json:"repoPasswordSecret,omitempty"`
+
+	// If given, S3 credentials are obtained by assuming a role instead of
+	// being read from the credentials secret.
+	// +kubebuilder:validation:Optional
+	WebIdentity *WebIdentity `json:"webIdentity,omitempty"`
+
+	// Tool used to store backups in this location. If not provided,
+	// "restic" is used. The "targz" engine stores each backup as a
+	// compressed tar archive and only supports S3 targets.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=restic;targz
+	Engine string `json:"engine,omitempty"`
+
+	// If given, integrity of the repo is checked as per this schedule. The
+	// value should be in the same format as "schedule" in "cronjob".
+	// +kubebuilder:validation:Optional
+	CheckSchedule string `json:"checkSchedule,omitempty"`
+
+	// Subset of the backup data that is also read and verified during a
+	// check, for example "1/5" or "10%". If not provided, only the
+	// structure of the repo is checked.
+	// +kubebuilder:validation:Optional
+	CheckReadDataSubset string `json:"checkReadDataSubset,omitempty"`
+
+	// If given, usage statistics of the repo (size, number of snapshots
+	// etc) are collected as per this schedule. The value should be in the
+	// same format as "schedule" in "cronjob".
+	// +kubebuilder:validation:Optional
+	StatsSchedule string `json:"statsSchedule,omitempty"`
+
+	// What happens to the backups when the BackupLocation is deleted. If
+	// "Purge", all of them are deleted from the target, along with their
+	// MetadataBackupRecords, before the resource goes away. If not
+	// provided, "Retain" is used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Retain;Purge
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+
+	// If given, locks left behind in the repo (for example, by a pod that
+	// was killed) are removed automatically once the repo has been reported
+	// as locked for this long, such as "1h". Only supported by the "restic"
+	// engine.
+	// +kubebuilder:validation:Optional
+	UnlockStaleLocksAfter *metav1.Duration `json:"unlockStaleLocksAfter,omitempty"`
+
+	// Strategic merge patch of a pod template, for example to set
+	// resources, tolerations or annotations, that is applied to the pods
+	// working on the repo of this location: initialization, integrity
+	// checks, usage statistics, unlocking, password changes, purges,
+	// deletion of snapshots, restores and replication into this location.
+	// Backup pods use the "podTemplate" of their policy instead.
+	// Containers are merged by name. Only labels and annotations can be
+	// set in the metadata.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+}
+
+// SecretKeyNames returns the names of the keys in the credentials secret,
+// with defaults filled in.
+func (spec *BackupLocationSpec) SecretKeyNames() CredentialKeys {
+	keys := CredentialKeys{}
+	if spec.CredentialKeys != nil {
+		keys = *spec.CredentialKeys
+	}
+
+	if keys.AccessKey == "" {
+		keys.AccessKey = DefaultAccessKeyName
+	}
+
+	if keys.SecretKey == "" {
+		keys.SecretKey = DefaultSecretKeyName
+	}
+
+	if keys.RepoPassword == "" {
+		keys.RepoPassword = DefaultRepoPasswordName
+	}
+
+	return keys
+}
+
+// RepoPasswordRef returns the secret, and the key, containing the repo
+// password as per the spec.
+func (spec *BackupLocationSpec) RepoPasswordRef() corev1.SecretKeySelector {
+	if spec.RepoPasswordSecret != nil {
+		return *spec.RepoPasswordSecret
+	}
+
+	ref := corev1.SecretKeySelector{Key: spec.SecretKeyNames().RepoPassword}
+	ref.Name = spec.Credentials
+
+	return ref
+}
+
+// ExpandPrefix returns "prefix" with the template expanded, without any
+// leading or trailing "/". "clusterName" is the name of the cluster in which
+// KubeDR is running. If it is empty, the template must not refer to it.
+func (r *BackupLocation) ExpandPrefix(clusterName string) (string, error) {
+	if r.Spec.Prefix == "" {
+		return "", nil
+	}
+
+	tmpl, err := template.New("prefix").Option("missingkey=error").Parse(r.Spec.Prefix)
+	if err != nil {
+		return "", err
+	}
+
+	vars := map[string]string{
+		"Namespace": r.Namespace,
+		"Name":      r.Name,
+	}
+	if clusterName != "" {
+		vars["ClusterName"] = clusterName
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+
+	prefix := strings.Trim(path.Clean("/"+buf.String()), "/")
+	if prefix == "" {
+		return "", fmt.Errorf("prefix (%s) expands to an empty path", r.Spec.Prefix)
+	}
+
+	return prefix, nil
+}
+
+// RepoCheckResult describes the result of an integrity check. It is set
+// by the check pod.
+type RepoCheckResult struct {
+	// Name of the pod that performed the check.
+	CheckPod string `json:"checkPod"`
+
+	CheckTime metav1.Time `json:"checkTime"`
+
+	// "Completed" if the check ran to completion (even if it found errors),
+	// "Failed" otherwise.
+	CheckStatus string `json:"checkStatus"`
+
+	// Number of errors found in the repo.
+	// +kubebuilder:validation:Optional
+	NumErrors int64 `json:"numErrors"`
+
+	// +kubebuilder:validation:Optional
+	CheckErrorMessage string `json:"checkErrorMessage,omitempty"`
+}
+
+// RepoStats describes the usage of a repo. It is set by the stats pod.
+type RepoStats struct {
+	// Name of the pod that collected the statistics.
+	StatsPod string `json:"statsPod"`
+
+	StatsTime metav1.Time `json:"statsTime"`
+
+	// "Completed" or "Failed". If failed, the statistics from the previous
+	// run are retained.
+	StatsStatus string `json:"statsStatus"`
+
+	// +kubebuilder:validation:Optional
+	StatsErrorMessage string `json:"statsErrorMessage,omitempty"`
+
+	// Size, in bytes, of all the snapshots as they would be if restored.
+	// +kubebuilder:validation:Optional
+	TotalSize uint64 `json:"totalSize"`
+
+	// Size, in bytes, of the data actually stored in the target after
+	// deduplication. For engines that don't deduplicate, this is the
+	// same as "totalSize".
+	// +kubebuilder:validation:Optional
+	DeduplicatedSize uint64 `json:"deduplicatedSize"`
+
+	// +kubebuilder:validation:Optional
+	NumSnapshots int64 `json:"numSnapshots"`
+
+	// +kubebuilder:validation:Optional
+	OldestSnapshotTime *metav1.Time `json:"oldestSnapshotTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	NewestSnapshotTime *metav1.Time `json:"newestSnapshotTime,omitempty"`
 }
 
 // BackupLocationStatus defines the observed state of BackupLocation
@@ -48,13 +400,68 @@ type BackupLocationStatus struct {
 	InitStatus string `json:"initStatus"`
 
 	// +kubebuilder:validation:Optional
-	InitErrorMessage string `json:"initErrorMessage"`
+	InitErrorMessage string `json:"initErrorMessage,omitempty"`
+
+	// Deprecated: use "lastInitTime".
+	// +kubebuilder:validation:Optional
+	InitTime string `json:"initTime,omitempty"`
+
+	// Time at which the status of initialization last changed.
+	// +kubebuilder:validation:Optional
+	LastInitTime *metav1.Time `json:"lastInitTime,omitempty"`
+
+	// Fingerprint of the target (end point, bucket, credentials etc) for
+	// which the repo was last initialized or verified successfully.
+	// +kubebuilder:validation:Optional
+	TargetFingerprint string `json:"targetFingerprint,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	LastCheck *RepoCheckResult `json:"lastCheck,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Stats *RepoStats `json:"stats,omitempty"`
+
+	// Secret, and key, containing the password with which the repo can
+	// currently be opened. It is used by all pods until a change of the
+	// password in the spec is applied to the repo.
+	// +kubebuilder:validation:Optional
+	RepoPassword *corev1.SecretKeySelector `json:"repoPassword,omitempty"`
+
+	// "Rotating", "Completed" or "Failed".
+	// +kubebuilder:validation:Optional
+	PasswordRotationStatus string `json:"passwordRotationStatus,omitempty"`
 
-	InitTime string `json:"initTime"`
+	// +kubebuilder:validation:Optional
+	PasswordRotationErrorMessage string `json:"passwordRotationErrorMessage,omitempty"`
+
+	// Time at which the password was last changed successfully.
+	// +kubebuilder:validation:Optional
+	PasswordRotationTime *metav1.Time `json:"passwordRotationTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Conditions []Condition `json:"conditions,omitempty"`
 }
 
+// Condition types of BackupLocation.
+const (
+	// True if the last integrity check didn't find any errors.
+	BackupLocationHealthy = "Healthy"
+
+	// Set when deletion policy is "Purge" and the resource is deleted. False
+	// while the backups are being deleted or if that fails.
+	BackupLocationPurged = "Purged"
+
+	// True if an operation failed because the repo is locked. Set to false
+	// once the stale locks are removed.
+	BackupLocationRepoLocked = "RepoLocked"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.initStatus"
+// +kubebuilder:printcolumn:name="Engine",type="string",JSONPath=".spec.engine"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // BackupLocation is the Schema for the backuplocations API
 type BackupLocation struct {
@@ -17,17 +17,67 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"kubedr/s3util"
 )
 
 // log is for logging in this package.
 var backuplocationlog = logf.Log.WithName("backuplocation-resource")
 
+// BackupLocationValidationOptions controls the checks, done by the validation
+// webhook, that need access to the cluster or to the S3 end point.
+// +kubebuilder:object:generate=false
+type BackupLocationValidationOptions struct {
+	// Upper bound on the time taken by all the checks of a single request.
+	Timeout time.Duration
+
+	// If true, the bucket is probed with the configured credentials.
+	ProbeBucket bool
+
+	// Name of the cluster, used to expand "prefix".
+	ClusterName string
+}
+
+// Used if no timeout is given for the checks.
+const defaultValidationTimeout = 10 * time.Second
+
+var (
+	// Used to read the secret and the CA bundle referenced by a BackupLocation.
+	// It reads directly from API server as there is no need to cache secrets.
+	backupLocationReader client.Reader
+
+	backupLocationValidation = BackupLocationValidationOptions{Timeout: defaultValidationTimeout}
+)
+
 // SetupWebhookWithManager configures the web hook with the manager.
-func (r *BackupLocation) SetupWebhookWithManager(mgr ctrl.Manager) error {
+func (r *BackupLocation) SetupWebhookWithManager(mgr ctrl.Manager, opts BackupLocationValidationOptions) error {
+	backupLocationReader = mgr.GetAPIReader()
+
+	backupLocationValidation = opts
+	if opts.Timeout <= 0 {
+		backupLocationValidation.Timeout = defaultValidationTimeout
+	}
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
@@ -43,38 +93,590 @@ var _ webhook.Defaulter = &BackupLocation{}
 func (r *BackupLocation) Default() {
 	backuplocationlog.Info("default", "name", r.Name)
 
-	// TODO(user): fill in your defaulting logic.
+	defaultBackupLocationSpec(&r.Spec, backuplocationlog)
+}
+
+// defaultBackupLocationSpec is shared with ClusterBackupLocation.
+func defaultBackupLocationSpec(spec *BackupLocationSpec, log logr.Logger) {
+	if spec.Engine == "" {
+		log.Info("Initializing Engine")
+		spec.Engine = EngineRestic
+	}
+
+	if spec.DeletionPolicy == "" {
+		log.Info("Initializing DeletionPolicy")
+		spec.DeletionPolicy = DeletionPolicyRetain
+	}
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
-// +kubebuilder:webhook:verbs=create;update,path=/validate-kubedr-catalogicsoftware-com-v1alpha1-backuplocation,mutating=false,failurePolicy=fail,groups=kubedr.catalogicsoftware.com,resources=backuplocations,versions=v1alpha1,name=vbackuplocation.kb.io
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get
+// +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=metadatabackuppolicies;metadatabackuprecords;resourcebackuppolicies,verbs=list
+// +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=clusterbackuplocations,verbs=get
+
+// +kubebuilder:webhook:verbs=create;update;delete,path=/validate-kubedr-catalogicsoftware-com-v1alpha1-backuplocation,mutating=false,failurePolicy=fail,groups=kubedr.catalogicsoftware.com,resources=backuplocations,versions=v1alpha1,name=vbackuplocation.kb.io
 
 var _ webhook.Validator = &BackupLocation{}
 
+func (r *BackupLocation) validateTarget() field.ErrorList {
+	var allErrs field.ErrorList
+
+	specPath := field.NewPath("spec")
+	fs := r.Spec.Filesystem
+
+	if r.Spec.Prefix != "" {
+		if _, err := r.ExpandPrefix(backupLocationValidation.ClusterName); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("prefix"), r.Spec.Prefix, err.Error()))
+		}
+	}
+
+	if fs == nil {
+		if r.Spec.Url == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("url"),
+				"url is required unless filesystem is given"))
+		} else if err := s3util.ValidateEndpoint(r.Spec.Url); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("url"), r.Spec.Url, err.Error()))
+		}
+
+		if r.Spec.BucketName == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("bucketName"),
+				"bucketName is required unless filesystem is given"))
+		}
+
+		return allErrs
+	}
+
+	fsPath := specPath.Child("filesystem")
+	if (r.Spec.Url != "") || (r.Spec.BucketName != "") {
+		allErrs = append(allErrs, field.Forbidden(fsPath,
+			"filesystem can't be combined with url and bucketName"))
+	}
+
+	if (fs.PVCName == "") == (fs.NFS == nil) {
+		allErrs = append(allErrs, field.Invalid(fsPath, "",
+			"exactly one of pvcName and nfs must be given"))
+	}
+
+	// The path is joined to the mount path of the volume, so it must not
+	// be able to point outside of it.
+	if path.IsAbs(fs.Path) || hasDotDot(fs.Path) {
+		allErrs = append(allErrs, field.Invalid(fsPath.Child("path"), fs.Path,
+			"path must be relative and can't contain '..'"))
+	}
+
+	if r.Spec.Engine == EngineTarGz {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("engine"), r.Spec.Engine,
+			"engine doesn't support filesystem targets"))
+	}
+
+	if r.Spec.ObjectLock != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("objectLock"),
+			"objectLock can't be combined with filesystem"))
+	}
+
+	if r.Spec.TLS != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("tls"),
+			"tls can't be combined with filesystem"))
+	}
+
+	return allErrs
+}
+
+// hasDotDot returns true if any element of the given path is "..".
+func hasDotDot(p string) bool {
+	for _, elem := range strings.Split(p, "/") {
+		if elem == ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *BackupLocation) validateTLS() field.ErrorList {
+	var allErrs field.ErrorList
+
+	tls := r.Spec.TLS
+	if tls == nil || tls.CABundle == nil {
+		return allErrs
+	}
+
+	tlsPath := field.NewPath("spec").Child("tls")
+	caPath := tlsPath.Child("caBundle")
+
+	if tls.InsecureSkipVerify {
+		allErrs = append(allErrs, field.Forbidden(tlsPath.Child("insecureSkipVerify"),
+			"insecureSkipVerify can't be combined with caBundle"))
+	}
+
+	configMapRef, secretRef := tls.CABundle.ConfigMapKeyRef, tls.CABundle.SecretKeyRef
+	if (configMapRef == nil) == (secretRef == nil) {
+		return append(allErrs, field.Invalid(caPath, "",
+			"exactly one of configMapKeyRef and secretKeyRef must be given"))
+	}
+
+	if configMapRef != nil && (configMapRef.Name == "" || configMapRef.Key == "") {
+		allErrs = append(allErrs, field.Required(caPath.Child("configMapKeyRef"), "name and key are required"))
+	}
+
+	if secretRef != nil && (secretRef.Name == "" || secretRef.Key == "") {
+		allErrs = append(allErrs, field.Required(caPath.Child("secretKeyRef"), "name and key are required"))
+	}
+
+	return allErrs
+}
+
+// readCABundle returns the contents of the CA bundle referenced by the
+// spec, or nil if there is none.
+func (r *BackupLocation) readCABundle(ctx context.Context) ([]byte, *field.Error) {
+	tls := r.Spec.TLS
+	if tls == nil || tls.CABundle == nil {
+		return nil, nil
+	}
+
+	caPath := field.NewPath("spec").Child("tls").Child("caBundle")
+
+	var data []byte
+	var err error
+
+	if ref := tls.CABundle.ConfigMapKeyRef; ref != nil {
+		caPath = caPath.Child("configMapKeyRef")
+
+		var configMap corev1.ConfigMap
+		if err = backupLocationReader.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: ref.Name},
+			&configMap); err == nil {
+			data = []byte(configMap.Data[ref.Key])
+		}
+	} else {
+		ref := tls.CABundle.SecretKeyRef
+		caPath = caPath.Child("secretKeyRef")
+
+		var secret corev1.Secret
+		if err = backupLocationReader.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: ref.Name},
+			&secret); err == nil {
+			data = secret.Data[ref.Key]
+		}
+	}
+
+	if apierrors.IsNotFound(err) {
+		return nil, field.NotFound(caPath, tls.CABundle)
+	} else if err != nil {
+		return nil, field.InternalError(caPath, err)
+	}
+
+	if len(data) == 0 {
+		return nil, field.Invalid(caPath, "", "CA bundle is empty")
+	}
+
+	return data, nil
+}
+
+// Keys that must be present in the credentials secret.
+func (r *BackupLocation) requiredSecretKeys() []string {
+	var keys []string
+
+	names := r.Spec.SecretKeyNames()
+
+	if r.Spec.Filesystem == nil && r.Spec.WebIdentity == nil {
+		keys = append(keys, names.AccessKey, names.SecretKey)
+
+		if names.SessionToken != "" {
+			keys = append(keys, names.SessionToken)
+		}
+	}
+
+	if r.Spec.Engine != EngineTarGz && r.Spec.RepoPasswordSecret == nil {
+		keys = append(keys, names.RepoPassword)
+	}
+
+	return keys
+}
+
+func (r *BackupLocation) validateCredentialSources() field.ErrorList {
+	var allErrs field.ErrorList
+
+	specPath := field.NewPath("spec")
+
+	if webIdentity := r.Spec.WebIdentity; webIdentity != nil {
+		webIdentityPath := specPath.Child("webIdentity")
+
+		if r.Spec.Filesystem != nil {
+			allErrs = append(allErrs, field.Forbidden(webIdentityPath,
+				"webIdentity can't be combined with filesystem"))
+		}
+
+		if r.Spec.Engine == EngineTarGz {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("engine"), r.Spec.Engine,
+				"engine doesn't support webIdentity"))
+		}
+
+		if webIdentity.RoleARN == "" {
+			allErrs = append(allErrs, field.Required(webIdentityPath.Child("roleArn"), ""))
+		}
+	}
+
+	if ref := r.Spec.RepoPasswordSecret; ref != nil && (ref.Name == "" || ref.Key == "") {
+		allErrs = append(allErrs, field.Required(specPath.Child("repoPasswordSecret"),
+			"name and key are required"))
+	}
+
+	if r.Spec.Credentials == "" && len(r.requiredSecretKeys()) > 0 {
+		allErrs = append(allErrs, field.Required(specPath.Child("credentials"),
+			"name of the secret is required"))
+	}
+
+	return allErrs
+}
+
+// readSecret returns the data of the given secret in the namespace of the
+// BackupLocation.
+func (r *BackupLocation) readSecret(ctx context.Context, name string,
+	fldPath *field.Path) (map[string][]byte, *field.Error) {
+
+	var secret corev1.Secret
+	secretKey := types.NamespacedName{Namespace: r.Namespace, Name: name}
+	if err := backupLocationReader.Get(ctx, secretKey, &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, field.NotFound(fldPath, name)
+		}
+
+		return nil, field.InternalError(fldPath, err)
+	}
+
+	return secret.Data, nil
+}
+
+// validateCredentials checks that the secrets have all the required keys
+// and, if enabled, that S3 accepts the credentials.
+func (r *BackupLocation) validateCredentials(ctx context.Context) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if backupLocationReader == nil || r.Namespace == "" {
+		// Not running as part of the manager, nothing more can be checked.
+		return allErrs
+	}
+
+	credsPath := field.NewPath("spec").Child("credentials")
+
+	var data map[string][]byte
+	if r.Spec.Credentials != "" {
+		var err *field.Error
+		if data, err = r.readSecret(ctx, r.Spec.Credentials, credsPath); err != nil {
+			return append(allErrs, err)
+		}
+	}
+
+	for _, key := range r.requiredSecretKeys() {
+		if len(data[key]) == 0 {
+			allErrs = append(allErrs, field.Invalid(credsPath, r.Spec.Credentials,
+				fmt.Sprintf("secret doesn't contain the key %q", key)))
+		}
+	}
+
+	if ref := r.Spec.RepoPasswordSecret; ref != nil && r.Spec.Engine != EngineTarGz {
+		passwordPath := field.NewPath("spec").Child("repoPasswordSecret")
+
+		passwordData, err := r.readSecret(ctx, ref.Name, passwordPath)
+		if err != nil {
+			allErrs = append(allErrs, err)
+		} else if len(passwordData[ref.Key]) == 0 {
+			allErrs = append(allErrs, field.Invalid(passwordPath, ref.Name,
+				fmt.Sprintf("secret doesn't contain the key %q", ref.Key)))
+		}
+	}
+
+	caBundle, caErr := r.readCABundle(ctx)
+	if caErr != nil {
+		allErrs = append(allErrs, caErr)
+	}
+
+	// Credentials obtained through web identity can only be verified from
+	// a pod.
+	if len(allErrs) > 0 || !backupLocationValidation.ProbeBucket || r.Spec.Filesystem != nil ||
+		r.Spec.WebIdentity != nil {
+
+		return allErrs
+	}
+
+	insecureSkipVerify := r.Spec.TLS != nil && r.Spec.TLS.InsecureSkipVerify
+	httpClient, err := s3util.NewHTTPClient(caBundle, insecureSkipVerify)
+	if err != nil {
+		return append(allErrs, field.Invalid(field.NewPath("spec").Child("tls").Child("caBundle"),
+			"", err.Error()))
+	}
+
+	names := r.Spec.SecretKeyNames()
+	creds := s3util.Credentials{
+		AccessKey: string(data[names.AccessKey]),
+		SecretKey: string(data[names.SecretKey]),
+	}
+	if names.SessionToken != "" {
+		creds.SessionToken = string(data[names.SessionToken])
+	}
+
+	if err := s3util.ProbeBucket(ctx, httpClient, r.Spec.Url, r.Spec.BucketName, creds); err != nil {
+		return append(allErrs, field.Invalid(field.NewPath("spec").Child("url"), r.Spec.Url, err.Error()))
+	}
+
+	if r.Spec.ObjectLock != nil {
+		if err := s3util.ProbeObjectLock(ctx, httpClient, r.Spec.Url, r.Spec.BucketName, creds); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("objectLock"),
+				r.Spec.BucketName, err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
+var readDataSubsetRegexp = regexp.MustCompile(`^([1-9][0-9]*/[1-9][0-9]*|[0-9]+(\.[0-9]+)?%)$`)
+
+func (r *BackupLocation) validateCheck() field.ErrorList {
+	var allErrs field.ErrorList
+
+	specPath := field.NewPath("spec")
+
+	if r.Spec.CheckSchedule != "" {
+		if err := validateScheduleFormat(r.Spec.CheckSchedule, specPath.Child("checkSchedule")); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+
+	if r.Spec.StatsSchedule != "" {
+		if err := validateScheduleFormat(r.Spec.StatsSchedule, specPath.Child("statsSchedule")); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+
+	if subset := r.Spec.CheckReadDataSubset; subset != "" {
+		subsetPath := specPath.Child("checkReadDataSubset")
+
+		if r.Spec.CheckSchedule == "" {
+			allErrs = append(allErrs, field.Forbidden(subsetPath, "checkSchedule is not given"))
+		} else if !readDataSubsetRegexp.MatchString(subset) {
+			allErrs = append(allErrs, field.Invalid(subsetPath, subset,
+				`must be of the form "n/t" or "x%"`))
+		}
+	}
+
+	return allErrs
+}
+
+func (r *BackupLocation) validateObjectLock() field.ErrorList {
+	var allErrs field.ErrorList
+
+	lock := r.Spec.ObjectLock
+	if lock == nil {
+		return allErrs
+	}
+
+	lockPath := field.NewPath("spec").Child("objectLock")
+
+	// restic deletes objects when it prunes, unlocks or rebuilds the
+	// index, all of which fail on locked data.
+	if r.Spec.Engine != EngineTarGz {
+		allErrs = append(allErrs, field.Forbidden(lockPath,
+			fmt.Sprintf("only supported by engine (%s)", EngineTarGz)))
+	}
+
+	if lock.Mode != ObjectLockGovernance && lock.Mode != ObjectLockCompliance {
+		allErrs = append(allErrs, field.NotSupported(lockPath.Child("mode"), lock.Mode,
+			[]string{ObjectLockGovernance, ObjectLockCompliance}))
+	}
+
+	if lock.RetentionDays < 1 {
+		allErrs = append(allErrs, field.Invalid(lockPath.Child("retentionDays"), lock.RetentionDays,
+			"must be at least 1"))
+	}
+
+	return allErrs
+}
+
+func (r *BackupLocation) validateUnlock() field.ErrorList {
+	var allErrs field.ErrorList
+
+	after := r.Spec.UnlockStaleLocksAfter
+	if after == nil {
+		return allErrs
+	}
+
+	afterPath := field.NewPath("spec").Child("unlockStaleLocksAfter")
+
+	if after.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(afterPath, after.Duration.String(), "must be positive"))
+	}
+
+	if r.Spec.Engine == EngineTarGz {
+		allErrs = append(allErrs, field.Forbidden(afterPath,
+			fmt.Sprintf("not supported by engine (%s)", EngineTarGz)))
+	}
+
+	return allErrs
+}
+
+// validateSpec returns all the errors in the spec. It is shared with
+// ClusterBackupLocation, which validates the spec of its BackupLocation.
+func (r *BackupLocation) validateSpec() field.ErrorList {
+	allErrs := r.validateTarget()
+	allErrs = append(allErrs, r.validateTLS()...)
+	allErrs = append(allErrs, r.validateCredentialSources()...)
+	allErrs = append(allErrs, r.validateCheck()...)
+	allErrs = append(allErrs, r.validateUnlock()...)
+	allErrs = append(allErrs, r.validateObjectLock()...)
+	allErrs = append(allErrs, validatePodTemplate(r.Spec.PodTemplate, field.NewPath("spec").Child("podTemplate"))...)
+
+	if len(allErrs) == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), backupLocationValidation.Timeout)
+		defer cancel()
+
+		allErrs = append(allErrs, r.validateCredentials(ctx)...)
+	}
+
+	return allErrs
+}
+
+func (r *BackupLocation) validateBackupLocation() error {
+	allErrs := r.validateSpec()
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: "kubedr.catalogicsoftware.com/v1alpha1", Kind: "BackupLocation"},
+		r.Name, allErrs)
+}
+
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type
 func (r *BackupLocation) ValidateCreate() error {
 	backuplocationlog.Info("validate create", "name", r.Name)
 
-	// We need to validate that Credentials are correct.
-	//
-	// The quickest way for now is to actually try and initialize the repo.
-	// The command will fail if credentials are wrong.
-
-	return nil
+	// Make sure that the secret has the required keys and, if configured,
+	// that S3 accepts the credentials. This catches typos right away instead
+	// of as a failure of the init pod.
+	return r.validateBackupLocation()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *BackupLocation) ValidateUpdate(old runtime.Object) error {
 	backuplocationlog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	return nil
+	// Updates to metadata (such as finalizers and annotations) must not
+	// depend on availability of the end point.
+	if oldLoc, ok := old.(*BackupLocation); ok && reflect.DeepEqual(oldLoc.Spec, r.Spec) {
+		return nil
+	}
+
+	return r.validateBackupLocation()
+}
+
+// findUsers returns descriptions of the resources that still refer to this
+// BackupLocation. Backup records are not included if they are going to be
+// purged along with the location.
+func (r *BackupLocation) findUsers(ctx context.Context) ([]string, error) {
+	var users []string
+
+	var policyList MetadataBackupPolicyList
+	if err := backupLocationReader.List(ctx, &policyList, client.InNamespace(r.Namespace)); err != nil {
+		return nil, err
+	}
+
+	for _, policy := range policyList.Items {
+		usesLocation := (policy.Spec.Destination == r.Name && !policy.Spec.UsesClusterBackupLocation())
+		for _, replica := range policy.Spec.Replicas {
+			usesLocation = usesLocation || (replica.Destination == r.Name)
+		}
+
+		if usesLocation {
+			users = append(users, "MetadataBackupPolicy/"+policy.Name)
+		}
+	}
+
+	var resourcePolicyList ResourceBackupPolicyList
+	if err := backupLocationReader.List(ctx, &resourcePolicyList, client.InNamespace(r.Namespace)); err != nil {
+		return nil, err
+	}
+
+	for _, policy := range resourcePolicyList.Items {
+		if policy.Spec.Destination == r.Name && !policy.Spec.UsesClusterBackupLocation() {
+			users = append(users, "ResourceBackupPolicy/"+policy.Name)
+		}
+	}
+
+	if r.Spec.DeletionPolicy == DeletionPolicyPurge {
+		return users, nil
+	}
+
+	var mbrList MetadataBackupRecordList
+	if err := backupLocationReader.List(ctx, &mbrList, client.InNamespace(r.Namespace)); err != nil {
+		return nil, err
+	}
+
+	numRecords := 0
+	for _, mbr := range mbrList.Items {
+		if mbr.Spec.Backuploc == r.Name && mbr.Spec.BackuplocKind != KindClusterBackupLocation {
+			numRecords++
+		}
+	}
+
+	if numRecords > 0 {
+		users = append(users, fmt.Sprintf("%d MetadataBackupRecord(s)", numRecords))
+	}
+
+	return users, nil
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
 func (r *BackupLocation) ValidateDelete() error {
 	backuplocationlog.Info("validate delete", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object deletion.
-	return nil
+	if r.ObjectMeta.Annotations[ForceDeleteAnnotation] == "true" {
+		return nil
+	}
+
+	if backupLocationReader == nil || r.Namespace == "" {
+		// Not running as part of the manager (or the API server didn't
+		// send the object), nothing can be checked.
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backupLocationValidation.Timeout)
+	defer cancel()
+
+	// The BackupLocation of a ClusterBackupLocation goes away along with
+	// it. Whether it is still in use is checked when the
+	// ClusterBackupLocation is deleted.
+	if owner := metav1.GetControllerOf(r); owner != nil && owner.Kind == KindClusterBackupLocation {
+		return r.validateClusterOwnerDeleted(ctx, owner.Name)
+	}
+
+	users, err := r.findUsers(ctx)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+
+	if len(users) == 0 {
+		return nil
+	}
+
+	return apierrors.NewForbidden(
+		schema.GroupResource{Group: "kubedr.catalogicsoftware.com", Resource: "backuplocations"},
+		r.Name, fmt.Errorf("still in use by %s, set the annotation %q to \"true\" to delete anyway",
+			strings.Join(users, ", "), ForceDeleteAnnotation))
+}
+
+func (r *BackupLocation) validateClusterOwnerDeleted(ctx context.Context, clusterLocName string) error {
+	var clusterLoc ClusterBackupLocation
+	err := backupLocationReader.Get(ctx, types.NamespacedName{Name: clusterLocName}, &clusterLoc)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+
+	if !clusterLoc.ObjectMeta.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	return apierrors.NewForbidden(
+		schema.GroupResource{Group: "kubedr.catalogicsoftware.com", Resource: "backuplocations"},
+		r.Name, fmt.Errorf("managed by ClusterBackupLocation %q, delete that instead", clusterLocName))
 }
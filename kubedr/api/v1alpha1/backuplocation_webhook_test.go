@@ -0,0 +1,666 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeS3 answers HEAD requests for buckets. It only knows about one bucket
+// and one access key.
+func fakeS3(bucket string, accessKey string, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(fakeS3Handler(bucket, accessKey, delay))
+}
+
+func fakeS3Handler(bucket string, accessKey string, delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(delay)
+
+		if !strings.Contains(req.Header.Get("Authorization"), "Credential="+accessKey+"/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if req.Method != http.MethodHead || req.URL.Path != "/"+bucket {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// fakeObjectLockS3 behaves like fakeS3 and also returns the object lock
+// configuration of the bucket. Object lock is not configured if "lockConfig"
+// is empty.
+func fakeObjectLockS3(bucket string, accessKey string, lockConfig string) *httptest.Server {
+	bucketHandler := fakeS3Handler(bucket, accessKey, 0)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := req.URL.Query()["object-lock"]; !ok {
+			bucketHandler.ServeHTTP(w, req)
+			return
+		}
+
+		switch {
+		case !strings.Contains(req.Header.Get("Authorization"), "Credential="+accessKey+"/"):
+			w.WriteHeader(http.StatusForbidden)
+
+		case req.Method != http.MethodGet || req.URL.Path != "/"+bucket:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<Error><Code>NoSuchBucket</Code></Error>"))
+
+		case lockConfig == "":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<Error><Code>ObjectLockConfigurationNotFoundError</Code></Error>"))
+
+		default:
+			_, _ = w.Write([]byte(lockConfig))
+		}
+	}))
+}
+
+func testBackupLocation(url string) *BackupLocation {
+	return &BackupLocation{
+		ObjectMeta: metav1.ObjectMeta{Name: "loc", Namespace: "kubedr-system"},
+		Spec: BackupLocationSpec{
+			Url:         url,
+			BucketName:  "testbucket",
+			Credentials: "s3-creds",
+			Engine:      EngineRestic,
+		},
+	}
+}
+
+// setupValidation replaces the webhook state and returns a function that
+// restores it. Any additional objects are also made available to the webhook.
+func setupValidation(opts BackupLocationValidationOptions, data map[string]string,
+	objs ...runtime.Object) func() {
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-creds", Namespace: "kubedr-system"},
+		Data:       map[string][]byte{},
+	}
+	for k, v := range data {
+		secret.Data[k] = []byte(v)
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = AddToScheme(scheme)
+
+	backupLocationReader = fake.NewFakeClientWithScheme(scheme, append(objs, secret)...)
+	backupLocationValidation = opts
+
+	return func() {
+		backupLocationReader = nil
+		backupLocationValidation = BackupLocationValidationOptions{Timeout: defaultValidationTimeout}
+	}
+}
+
+var validCreds = map[string]string{
+	"access_key":           "goodkey",
+	"secret_key":           "secret",
+	"restic_repo_password": "password",
+}
+
+func TestBackupLocationValidateCreate(t *testing.T) {
+	server := fakeS3("testbucket", "goodkey", 0)
+	defer server.Close()
+
+	probe := BackupLocationValidationOptions{Timeout: 5 * time.Second, ProbeBucket: true}
+
+	tests := []struct {
+		name    string
+		url     string
+		creds   map[string]string
+		opts    BackupLocationValidationOptions
+		wantErr string
+	}{
+		{"valid", server.URL, validCreds, probe, ""},
+		{"invalid url", "ftp://10.0.0.1", validCreds, probe, "spec.url"},
+		{"missing key", server.URL,
+			map[string]string{"access_key": "goodkey", "secret_key": "secret"}, probe,
+			"restic_repo_password"},
+		{"wrong access key", server.URL,
+			map[string]string{"access_key": "badkey", "secret_key": "secret", "restic_repo_password": "p"}, probe,
+			"Access denied"},
+		{"no probe", server.URL,
+			map[string]string{"access_key": "badkey", "secret_key": "secret", "restic_repo_password": "p"},
+			BackupLocationValidationOptions{Timeout: 5 * time.Second}, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setupValidation(tc.opts, tc.creds)()
+
+			err := testBackupLocation(tc.url).ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBackupLocationValidateCreateMissingSecret(t *testing.T) {
+	defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds)()
+
+	loc := testBackupLocation("http://10.0.0.1:9000")
+	loc.Spec.Credentials = "no-such-secret"
+
+	if err := loc.ValidateCreate(); err == nil || !strings.Contains(err.Error(), "Not found") {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+}
+
+func TestBackupLocationProbeTimeout(t *testing.T) {
+	server := fakeS3("testbucket", "goodkey", 2*time.Second)
+	defer server.Close()
+
+	defer setupValidation(BackupLocationValidationOptions{Timeout: 200 * time.Millisecond, ProbeBucket: true},
+		validCreds)()
+
+	start := time.Now()
+	if err := testBackupLocation(server.URL).ValidateCreate(); err == nil {
+		t.Fatalf("expected an error from unresponsive end point")
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fatalf("validation was not bounded by the timeout")
+	}
+}
+
+func TestBackupLocationValidateUpdateSkipsMetadataChanges(t *testing.T) {
+	defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second, ProbeBucket: true}, nil)()
+
+	// Credentials are invalid but only the finalizers changed.
+	oldLoc := testBackupLocation("http://127.0.0.1:1")
+	newLoc := oldLoc.DeepCopy()
+	newLoc.Finalizers = []string{"backuplocation.finalizers.kubedr.catalogicsoftware.com"}
+
+	if err := newLoc.ValidateUpdate(oldLoc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBackupLocationValidateCheck(t *testing.T) {
+	defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds)()
+
+	tests := []struct {
+		name     string
+		schedule string
+		subset   string
+		wantErr  string
+	}{
+		{"no check", "", "", ""},
+		{"schedule only", "0 3 * * 0", "", ""},
+		{"fraction", "0 3 * * 0", "1/5", ""},
+		{"percentage", "0 3 * * 0", "2.5%", ""},
+		{"invalid schedule", "0 3 *", "", "spec.checkSchedule"},
+		{"invalid subset", "0 3 * * 0", "five", "spec.checkReadDataSubset"},
+		{"subset without schedule", "", "10%", "spec.checkReadDataSubset"},
+	}
+
+	statsTests := []struct {
+		name     string
+		schedule string
+		wantErr  string
+	}{
+		{"stats schedule", "0 * * * *", ""},
+		{"invalid stats schedule", "every hour", "spec.statsSchedule"},
+	}
+
+	for _, tc := range statsTests {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := testBackupLocation("http://10.0.0.1:9000")
+			loc.Spec.StatsSchedule = tc.schedule
+
+			err := loc.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := testBackupLocation("http://10.0.0.1:9000")
+			loc.Spec.CheckSchedule = tc.schedule
+			loc.Spec.CheckReadDataSubset = tc.subset
+
+			err := loc.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBackupLocationValidateUnlock(t *testing.T) {
+	defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds)()
+
+	tests := []struct {
+		name    string
+		after   *metav1.Duration
+		engine  string
+		wantErr string
+	}{
+		{"not given", nil, "", ""},
+		{"restic", &metav1.Duration{Duration: time.Hour}, EngineRestic, ""},
+		{"zero", &metav1.Duration{}, EngineRestic, "spec.unlockStaleLocksAfter"},
+		{"negative", &metav1.Duration{Duration: -time.Minute}, EngineRestic, "spec.unlockStaleLocksAfter"},
+		{"targz", &metav1.Duration{Duration: time.Hour}, EngineTarGz, "spec.unlockStaleLocksAfter"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := testBackupLocation("http://10.0.0.1:9000")
+			loc.Spec.UnlockStaleLocksAfter = tc.after
+			loc.Spec.Engine = tc.engine
+
+			err := loc.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBackupLocationExpandPrefix(t *testing.T) {
+	tests := []struct {
+		name        string
+		prefix      string
+		clusterName string
+		want        string
+		wantErr     bool
+	}{
+		{"not given", "", "prod", "", false},
+		{"plain", "/kubedr/backups/", "", "kubedr/backups", false},
+		{"cluster name", "clusters/{{.ClusterName}}/{{.Name}}", "prod", "clusters/prod/loc", false},
+		{"namespace", "{{.Namespace}}", "", "kubedr-system", false},
+		{"no cluster name", "clusters/{{.ClusterName}}", "", "", true},
+		{"unknown variable", "{{.Policy}}", "prod", "", true},
+		{"invalid template", "{{.ClusterName", "prod", "", true},
+		{"empty", "{{.ClusterName}}/..", "prod", "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := testBackupLocation("http://10.0.0.1:9000")
+			loc.Spec.Prefix = tc.prefix
+
+			got, err := loc.ExpandPrefix(tc.clusterName)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got prefix %q", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBackupLocationValidatePrefix(t *testing.T) {
+	defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second, ClusterName: "prod"},
+		validCreds)()
+
+	loc := testBackupLocation("http://10.0.0.1:9000")
+	loc.Spec.Prefix = "clusters/{{.ClusterName}}"
+	if err := loc.ValidateCreate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loc.Spec.Prefix = "clusters/{{.Cluster}}"
+	if err := loc.ValidateCreate(); err == nil || !strings.Contains(err.Error(), "spec.prefix") {
+		t.Fatalf("expected error containing %q, got: %v", "spec.prefix", err)
+	}
+}
+
+func TestBackupLocationValidateFilesystemPath(t *testing.T) {
+	defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds)()
+
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{"", false},
+		{"repos/kubedr", false},
+		{"repos/..kubedr", false},
+		{"/repos", true},
+		{"..", true},
+		{"repos/../../etc", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			loc := testBackupLocation("")
+			loc.Spec.Url = ""
+			loc.Spec.BucketName = ""
+			loc.Spec.Filesystem = &FilesystemTarget{PVCName: "backups", Path: tc.path}
+
+			err := loc.ValidateCreate()
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("expected error: %v, got: %v", tc.wantErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "spec.filesystem.path") {
+				t.Fatalf("expected error containing %q, got: %v", "spec.filesystem.path", err)
+			}
+		})
+	}
+}
+
+func TestBackupLocationValidateObjectLock(t *testing.T) {
+	enabled := "<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled></ObjectLockConfiguration>"
+
+	lockedServer := fakeObjectLockS3("testbucket", "goodkey", enabled)
+	defer lockedServer.Close()
+
+	unlockedServer := fakeObjectLockS3("testbucket", "goodkey", "")
+	defer unlockedServer.Close()
+
+	defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second, ProbeBucket: true},
+		validCreds)()
+
+	governance := &ObjectLock{Mode: ObjectLockGovernance, RetentionDays: 30}
+
+	tests := []struct {
+		name    string
+		url     string
+		bucket  string
+		lock    *ObjectLock
+		wantErr string
+	}{
+		{"enabled", lockedServer.URL, "testbucket", governance, ""},
+		{"not enabled", unlockedServer.URL, "testbucket", governance, "Object lock is not enabled"},
+		{"not enabled but not used", unlockedServer.URL, "testbucket", nil, ""},
+		{"new bucket", unlockedServer.URL, "newbucket", governance, ""},
+		{"invalid mode", lockedServer.URL, "testbucket",
+			&ObjectLock{Mode: "LEGAL_HOLD", RetentionDays: 30}, "spec.objectLock.mode"},
+		{"invalid days", lockedServer.URL, "testbucket",
+			&ObjectLock{Mode: ObjectLockCompliance}, "spec.objectLock.retentionDays"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := testBackupLocation(tc.url)
+			loc.Spec.Engine = EngineTarGz
+			loc.Spec.BucketName = tc.bucket
+			loc.Spec.ObjectLock = tc.lock
+
+			err := loc.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	// restic needs to delete objects, even if the bucket has object lock.
+	loc := testBackupLocation(lockedServer.URL)
+	loc.Spec.ObjectLock = governance
+	if err := loc.ValidateCreate(); err == nil || !strings.Contains(err.Error(), "spec.objectLock") {
+		t.Fatalf("expected error containing %q, got: %v", "spec.objectLock", err)
+	}
+
+	loc = testBackupLocation("")
+	loc.Spec.Url = ""
+	loc.Spec.BucketName = ""
+	loc.Spec.Filesystem = &FilesystemTarget{PVCName: "backups"}
+	loc.Spec.ObjectLock = governance
+	if err := loc.ValidateCreate(); err == nil || !strings.Contains(err.Error(), "spec.objectLock") {
+		t.Fatalf("expected error containing %q, got: %v", "spec.objectLock", err)
+	}
+}
+
+func TestBackupLocationValidateTLS(t *testing.T) {
+	server := httptest.NewTLSServer(fakeS3Handler("testbucket", "goodkey", 0))
+	defer server.Close()
+
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-ca", Namespace: "kubedr-system"},
+		Data:       map[string]string{"ca.crt": string(caBundle)},
+	}
+
+	caRef := func(name string) *CABundleSource {
+		ref := &corev1.ConfigMapKeySelector{Key: "ca.crt"}
+		ref.Name = name
+		return &CABundleSource{ConfigMapKeyRef: ref}
+	}
+
+	tests := []struct {
+		name    string
+		tls     *TLSOptions
+		wantErr string
+	}{
+		{"ca bundle", &TLSOptions{CABundle: caRef("s3-ca")}, ""},
+		{"insecure", &TLSOptions{InsecureSkipVerify: true}, ""},
+		{"unknown ca", nil, "certificate"},
+		{"missing config map", &TLSOptions{CABundle: caRef("no-such-ca")}, "spec.tls.caBundle.configMapKeyRef"},
+		{"no ref", &TLSOptions{CABundle: &CABundleSource{}}, "spec.tls.caBundle"},
+		{"ca bundle and insecure", &TLSOptions{CABundle: caRef("s3-ca"), InsecureSkipVerify: true},
+			"spec.tls.insecureSkipVerify"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second, ProbeBucket: true},
+				validCreds, configMap)()
+
+			loc := testBackupLocation(server.URL)
+			loc.Spec.TLS = tc.tls
+
+			err := loc.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBackupLocationValidateCredentialSources(t *testing.T) {
+	server := fakeS3("testbucket", "goodkey", 0)
+	defer server.Close()
+
+	passwordSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "repo-password", Namespace: "kubedr-system"},
+		Data:       map[string][]byte{"password": []byte("p")},
+	}
+
+	passwordRef := func(key string) *corev1.SecretKeySelector {
+		ref := &corev1.SecretKeySelector{Key: key}
+		ref.Name = "repo-password"
+		return ref
+	}
+
+	syncedCreds := map[string]string{
+		"AWS_ACCESS_KEY_ID":     "goodkey",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_SESSION_TOKEN":     "token",
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(loc *BackupLocation)
+		creds   map[string]string
+		wantErr string
+	}{
+		{"custom key names", func(loc *BackupLocation) {
+			loc.Spec.CredentialKeys = &CredentialKeys{
+				AccessKey:    "AWS_ACCESS_KEY_ID",
+				SecretKey:    "AWS_SECRET_ACCESS_KEY",
+				SessionToken: "AWS_SESSION_TOKEN",
+			}
+			loc.Spec.RepoPasswordSecret = passwordRef("password")
+		}, syncedCreds, ""},
+		{"default key names", func(loc *BackupLocation) {
+			loc.Spec.RepoPasswordSecret = passwordRef("password")
+		}, syncedCreds, `"access_key"`},
+		{"missing password key", func(loc *BackupLocation) {
+			loc.Spec.RepoPasswordSecret = passwordRef("no-such-key")
+		}, validCreds, "spec.repoPasswordSecret"},
+		{"web identity", func(loc *BackupLocation) {
+			loc.Spec.Credentials = ""
+			loc.Spec.WebIdentity = &WebIdentity{RoleARN: "arn:aws:iam::123456789012:role/kubedr"}
+			loc.Spec.RepoPasswordSecret = passwordRef("password")
+		}, nil, ""},
+		{"web identity without password", func(loc *BackupLocation) {
+			loc.Spec.Credentials = ""
+			loc.Spec.WebIdentity = &WebIdentity{RoleARN: "arn:aws:iam::123456789012:role/kubedr"}
+		}, nil, "spec.credentials"},
+		{"web identity with targz", func(loc *BackupLocation) {
+			loc.Spec.Engine = EngineTarGz
+			loc.Spec.WebIdentity = &WebIdentity{RoleARN: "arn:aws:iam::123456789012:role/kubedr"}
+		}, validCreds, "spec.engine"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second, ProbeBucket: true},
+				tc.creds, passwordSecret)()
+
+			loc := testBackupLocation(server.URL)
+			tc.modify(loc)
+
+			err := loc.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBackupLocationValidateDelete(t *testing.T) {
+	policy := &MetadataBackupPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "kubedr-system"},
+		Spec:       MetadataBackupPolicySpec{Destination: "primary", Replicas: []ReplicaSpec{{Destination: "offsite"}}},
+	}
+
+	mbr := &MetadataBackupRecord{
+		ObjectMeta: metav1.ObjectMeta{Name: "mbr-1", Namespace: "kubedr-system"},
+		Spec:       MetadataBackupRecordSpec{SnapshotId: "1", Policy: "old-policy", Backuploc: "archive"},
+	}
+
+	tests := []struct {
+		name           string
+		locName        string
+		deletionPolicy string
+		force          bool
+		wantErr        string
+	}{
+		{"unused", "unused", DeletionPolicyRetain, false, ""},
+		{"destination of policy", "primary", DeletionPolicyRetain, false, "MetadataBackupPolicy/policy"},
+		{"replica of policy", "offsite", DeletionPolicyRetain, false, "MetadataBackupPolicy/policy"},
+		{"policy with purge", "primary", DeletionPolicyPurge, false, "MetadataBackupPolicy/policy"},
+		{"forced", "primary", DeletionPolicyRetain, true, ""},
+		{"records", "archive", DeletionPolicyRetain, false, "1 MetadataBackupRecord(s)"},
+		{"records with purge", "archive", DeletionPolicyPurge, false, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds,
+				policy, mbr)()
+
+			loc := testBackupLocation("http://10.0.0.1:9000")
+			loc.Name = tc.locName
+			loc.Spec.DeletionPolicy = tc.deletionPolicy
+			if tc.force {
+				loc.Annotations = map[string]string{ForceDeleteAnnotation: "true"}
+			}
+
+			err := loc.ValidateDelete()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
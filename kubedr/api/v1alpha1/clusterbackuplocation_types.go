@@ -0,0 +1,127 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Kinds of locations that a policy can refer to.
+const (
+	KindBackupLocation        = "BackupLocation"
+	KindClusterBackupLocation = "ClusterBackupLocation"
+)
+
+// ClusterBackupLocationLabel is set, to the name of the ClusterBackupLocation,
+// on the BackupLocation that manages its repo and on the copies of its
+// secrets.
+const ClusterBackupLocationLabel = "kubedr.catalogicsoftware.com/cluster-backup-location"
+
+// AllNamespaces, in "allowedNamespaces", allows all namespaces.
+const AllNamespaces = "*"
+
+// ClusterBackupLocationSpec defines the desired state of ClusterBackupLocation
+type ClusterBackupLocationSpec struct {
+	BackupLocationSpec `json:",inline"`
+
+	// Namespace containing the secrets (and config maps) referred to in
+	// the spec. A BackupLocation with the same name is created in this
+	// namespace to initialize and manage the repo.
+	// kubebuilder:validation:MinLength:=1
+	SecretsNamespace string `json:"secretsNamespace"`
+
+	// Namespaces whose policies can use this location. "*" allows all
+	// namespaces. Namespaces other than "secretsNamespace" also need
+	// "copySecrets".
+	// +kubebuilder:validation:Optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// Pods that back up to, restore from or delete snapshots in this
+	// location run in the namespaces of the policies. If true, the
+	// secrets (credentials and repo password) are copied to those
+	// namespaces so that the pods can use them. Anyone who can read
+	// secrets in an allowed namespace can then read them.
+	// +kubebuilder:validation:Optional
+	CopySecrets bool `json:"copySecrets,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.initStatus"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterBackupLocation is the Schema for the clusterbackuplocations API.
+// It is a BackupLocation that can be used by policies in any of the allowed
+// namespaces. Its status is that of the BackupLocation that manages the repo.
+type ClusterBackupLocation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterBackupLocationSpec `json:"spec,omitempty"`
+	Status BackupLocationStatus      `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterBackupLocationList contains a list of ClusterBackupLocation
+type ClusterBackupLocationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterBackupLocation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterBackupLocation{}, &ClusterBackupLocationList{})
+}
+
+// AllowsNamespace returns true if policies in the given namespace can use
+// this location. Other than "secretsNamespace", a namespace is only allowed
+// if the secrets can be copied to it.
+func (r *ClusterBackupLocation) AllowsNamespace(namespace string) bool {
+	if namespace != r.Spec.SecretsNamespace && !r.Spec.CopySecrets {
+		return false
+	}
+
+	for _, allowed := range r.Spec.AllowedNamespaces {
+		if allowed == AllNamespaces || allowed == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BackupLocation returns the BackupLocation that manages the repo of this
+// location.
+func (r *ClusterBackupLocation) BackupLocation() *BackupLocation {
+	loc := &BackupLocation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.Name,
+			Namespace: r.Spec.SecretsNamespace,
+			Labels:    map[string]string{ClusterBackupLocationLabel: r.Name},
+		},
+		Spec: *r.Spec.BackupLocationSpec.DeepCopy(),
+	}
+
+	if value, ok := r.ObjectMeta.Annotations[ForceDeleteAnnotation]; ok {
+		loc.ObjectMeta.Annotations = map[string]string{ForceDeleteAnnotation: value}
+	}
+
+	return loc
+}
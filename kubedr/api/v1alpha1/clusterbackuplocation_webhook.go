@@ -0,0 +1,213 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var clusterbackuplocationlog = logf.Log.WithName("clusterbackuplocation-resource")
+
+// SetupWebhookWithManager configures the web hook with the manager. The
+// validation options are shared with BackupLocation.
+func (r *ClusterBackupLocation) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-kubedr-catalogicsoftware-com-v1alpha1-clusterbackuplocation,mutating=true,failurePolicy=fail,groups=kubedr.catalogicsoftware.com,resources=clusterbackuplocations,verbs=create;update,versions=v1alpha1,name=mclusterbackuplocation.kb.io
+
+var _ webhook.Defaulter = &ClusterBackupLocation{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *ClusterBackupLocation) Default() {
+	clusterbackuplocationlog.Info("default", "name", r.Name)
+
+	defaultBackupLocationSpec(&r.Spec.BackupLocationSpec, clusterbackuplocationlog)
+}
+
+// +kubebuilder:webhook:verbs=create;update;delete,path=/validate-kubedr-catalogicsoftware-com-v1alpha1-clusterbackuplocation,mutating=false,failurePolicy=fail,groups=kubedr.catalogicsoftware.com,resources=clusterbackuplocations,versions=v1alpha1,name=vclusterbackuplocation.kb.io
+
+var _ webhook.Validator = &ClusterBackupLocation{}
+
+func (r *ClusterBackupLocation) validateClusterSpec() field.ErrorList {
+	var allErrs field.ErrorList
+
+	specPath := field.NewPath("spec")
+
+	if r.Spec.SecretsNamespace == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("secretsNamespace"), ""))
+	} else if msgs := validation.IsDNS1123Label(r.Spec.SecretsNamespace); len(msgs) > 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("secretsNamespace"), r.Spec.SecretsNamespace,
+			strings.Join(msgs, ", ")))
+	}
+
+	// The volume must be accessible from the namespaces of the policies.
+	if fs := r.Spec.Filesystem; fs != nil && fs.PVCName != "" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("filesystem").Child("pvcName"),
+			"a PVC can't be shared across namespaces, use nfs instead"))
+	}
+
+	for i, namespace := range r.Spec.AllowedNamespaces {
+		fldPath := specPath.Child("allowedNamespaces").Index(i)
+
+		if namespace != r.Spec.SecretsNamespace && !r.Spec.CopySecrets {
+			allErrs = append(allErrs, field.Forbidden(fldPath,
+				"namespaces other than secretsNamespace need copySecrets, the secrets are copied to them"))
+			continue
+		}
+
+		if namespace == AllNamespaces {
+			continue
+		}
+
+		if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath, namespace, strings.Join(msgs, ", ")))
+		}
+	}
+
+	return allErrs
+}
+
+func (r *ClusterBackupLocation) validateClusterBackupLocation() error {
+	allErrs := r.validateClusterSpec()
+	if len(allErrs) == 0 {
+		// Secrets are read from "secretsNamespace", just as they are by
+		// the BackupLocation that is created for the repo.
+		allErrs = r.BackupLocation().validateSpec()
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: "kubedr.catalogicsoftware.com/v1alpha1", Kind: "ClusterBackupLocation"},
+		r.Name, allErrs)
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterBackupLocation) ValidateCreate() error {
+	clusterbackuplocationlog.Info("validate create", "name", r.Name)
+
+	return r.validateClusterBackupLocation()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterBackupLocation) ValidateUpdate(old runtime.Object) error {
+	clusterbackuplocationlog.Info("validate update", "name", r.Name)
+
+	if oldLoc, ok := old.(*ClusterBackupLocation); ok && reflect.DeepEqual(oldLoc.Spec, r.Spec) {
+		return nil
+	}
+
+	return r.validateClusterBackupLocation()
+}
+
+// findUsers returns descriptions of the resources, in all namespaces, that
+// still refer to this ClusterBackupLocation.
+func (r *ClusterBackupLocation) findUsers(ctx context.Context) ([]string, error) {
+	var users []string
+
+	var policyList MetadataBackupPolicyList
+	if err := backupLocationReader.List(ctx, &policyList); err != nil {
+		return nil, err
+	}
+
+	for _, policy := range policyList.Items {
+		if policy.Spec.UsesClusterBackupLocation() && policy.Spec.Destination == r.Name {
+			users = append(users, "MetadataBackupPolicy/"+policy.Namespace+"/"+policy.Name)
+		}
+	}
+
+	var resourcePolicyList ResourceBackupPolicyList
+	if err := backupLocationReader.List(ctx, &resourcePolicyList); err != nil {
+		return nil, err
+	}
+
+	for _, policy := range resourcePolicyList.Items {
+		if policy.Spec.UsesClusterBackupLocation() && policy.Spec.Destination == r.Name {
+			users = append(users, "ResourceBackupPolicy/"+policy.Namespace+"/"+policy.Name)
+		}
+	}
+
+	if r.Spec.DeletionPolicy == DeletionPolicyPurge {
+		return users, nil
+	}
+
+	var mbrList MetadataBackupRecordList
+	if err := backupLocationReader.List(ctx, &mbrList); err != nil {
+		return nil, err
+	}
+
+	numRecords := 0
+	for _, mbr := range mbrList.Items {
+		if mbr.Spec.BackuplocKind == KindClusterBackupLocation && mbr.Spec.Backuploc == r.Name {
+			numRecords++
+		}
+	}
+
+	if numRecords > 0 {
+		users = append(users, fmt.Sprintf("%d MetadataBackupRecord(s)", numRecords))
+	}
+
+	return users, nil
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterBackupLocation) ValidateDelete() error {
+	clusterbackuplocationlog.Info("validate delete", "name", r.Name)
+
+	if r.ObjectMeta.Annotations[ForceDeleteAnnotation] == "true" {
+		return nil
+	}
+
+	if backupLocationReader == nil || r.Name == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backupLocationValidation.Timeout)
+	defer cancel()
+
+	users, err := r.findUsers(ctx)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+
+	if len(users) == 0 {
+		return nil
+	}
+
+	return apierrors.NewForbidden(
+		schema.GroupResource{Group: "kubedr.catalogicsoftware.com", Resource: "clusterbackuplocations"},
+		r.Name, fmt.Errorf("still in use by %s, set the annotation %q to \"true\" to delete anyway",
+			strings.Join(users, ", "), ForceDeleteAnnotation))
+}
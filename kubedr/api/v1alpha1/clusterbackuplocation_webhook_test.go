@@ -0,0 +1,206 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testClusterBackupLocation(url string) *ClusterBackupLocation {
+	return &ClusterBackupLocation{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+		Spec: ClusterBackupLocationSpec{
+			BackupLocationSpec: testBackupLocation(url).Spec,
+			SecretsNamespace:   "kubedr-system",
+			AllowedNamespaces:  []string{"team-a"},
+			CopySecrets:        true,
+		},
+	}
+}
+
+func TestClusterBackupLocationAllowsNamespace(t *testing.T) {
+	loc := testClusterBackupLocation("http://10.0.0.1:9000")
+
+	if !loc.AllowsNamespace("team-a") || loc.AllowsNamespace("team-b") {
+		t.Fatalf("unexpected result for allowedNamespaces %v", loc.Spec.AllowedNamespaces)
+	}
+
+	loc.Spec.AllowedNamespaces = []string{AllNamespaces}
+	if !loc.AllowsNamespace("team-b") {
+		t.Fatalf("%q doesn't allow all namespaces", AllNamespaces)
+	}
+
+	loc.Spec.AllowedNamespaces = nil
+	if loc.AllowsNamespace("team-a") {
+		t.Fatalf("empty allowedNamespaces allows a namespace")
+	}
+
+	loc.Spec.AllowedNamespaces = []string{AllNamespaces}
+	loc.Spec.CopySecrets = false
+	if loc.AllowsNamespace("team-a") || !loc.AllowsNamespace("kubedr-system") {
+		t.Fatalf("only secretsNamespace should be allowed without copySecrets")
+	}
+}
+
+func TestClusterBackupLocationValidateCreate(t *testing.T) {
+	server := fakeS3("testbucket", "goodkey", 0)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		modify  func(*ClusterBackupLocation)
+		wantErr string
+	}{
+		{"valid", func(*ClusterBackupLocation) {}, ""},
+		{"all namespaces", func(loc *ClusterBackupLocation) {
+			loc.Spec.AllowedNamespaces = []string{AllNamespaces}
+		}, ""},
+		{"no secrets namespace", func(loc *ClusterBackupLocation) {
+			loc.Spec.SecretsNamespace = ""
+		}, "spec.secretsNamespace"},
+		{"invalid allowed namespace", func(loc *ClusterBackupLocation) {
+			loc.Spec.AllowedNamespaces = []string{"team-a", "Team_B"}
+		}, "spec.allowedNamespaces[1]"},
+		{"secrets not copied", func(loc *ClusterBackupLocation) {
+			loc.Spec.AllowedNamespaces = []string{"kubedr-system", "team-a"}
+			loc.Spec.CopySecrets = false
+		}, "spec.allowedNamespaces[1]"},
+		{"pvc", func(loc *ClusterBackupLocation) {
+			loc.Spec.Url = ""
+			loc.Spec.BucketName = ""
+			loc.Spec.Filesystem = &FilesystemTarget{PVCName: "backups"}
+		}, "spec.filesystem.pvcName"},
+		{"nfs", func(loc *ClusterBackupLocation) {
+			loc.Spec.Url = ""
+			loc.Spec.BucketName = ""
+			loc.Spec.Filesystem = &FilesystemTarget{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/exports"}}
+		}, ""},
+		{"spec of backup location", func(loc *ClusterBackupLocation) {
+			loc.Spec.CheckSchedule = "daily"
+		}, "spec.checkSchedule"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second, ProbeBucket: true},
+				validCreds)()
+
+			loc := testClusterBackupLocation(server.URL)
+			tc.modify(loc)
+
+			err := loc.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestClusterBackupLocationValidateDelete(t *testing.T) {
+	clusterPolicy := &MetadataBackupPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "team-a"},
+		Spec:       MetadataBackupPolicySpec{Destination: "shared", DestinationKind: KindClusterBackupLocation},
+	}
+
+	// Refers to a BackupLocation with the same name.
+	localPolicy := &MetadataBackupPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "local-policy", Namespace: "team-b"},
+		Spec:       MetadataBackupPolicySpec{Destination: "archive"},
+	}
+
+	mbr := &MetadataBackupRecord{
+		ObjectMeta: metav1.ObjectMeta{Name: "mbr-1", Namespace: "team-b"},
+		Spec: MetadataBackupRecordSpec{SnapshotId: "1", Policy: "old-policy", Backuploc: "archive",
+			BackuplocKind: KindClusterBackupLocation},
+	}
+
+	tests := []struct {
+		name           string
+		locName        string
+		deletionPolicy string
+		force          bool
+		wantErr        string
+	}{
+		{"unused", "unused", DeletionPolicyRetain, false, ""},
+		{"destination of policy", "shared", DeletionPolicyRetain, false, "MetadataBackupPolicy/team-a/policy"},
+		{"forced", "shared", DeletionPolicyRetain, true, ""},
+		{"records", "archive", DeletionPolicyRetain, false, "1 MetadataBackupRecord(s)"},
+		{"records with purge", "archive", DeletionPolicyPurge, false, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds,
+				clusterPolicy, localPolicy, mbr)()
+
+			loc := testClusterBackupLocation("http://10.0.0.1:9000")
+			loc.Name = tc.locName
+			loc.Spec.DeletionPolicy = tc.deletionPolicy
+			if tc.force {
+				loc.Annotations = map[string]string{ForceDeleteAnnotation: "true"}
+			}
+
+			err := loc.ValidateDelete()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBackupLocationValidateDeleteOwnedByClusterBackupLocation(t *testing.T) {
+	clusterLoc := testClusterBackupLocation("http://10.0.0.1:9000")
+
+	backupLoc := clusterLoc.BackupLocation()
+	isController := true
+	backupLoc.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: GroupVersion.String(),
+		Kind:       KindClusterBackupLocation,
+		Name:       clusterLoc.Name,
+		Controller: &isController,
+	}}
+
+	restore := setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds, clusterLoc)
+	if err := backupLoc.ValidateDelete(); err == nil || !strings.Contains(err.Error(), "ClusterBackupLocation") {
+		t.Fatalf("expected error about the ClusterBackupLocation, got: %v", err)
+	}
+	restore()
+
+	defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds)()
+	if err := backupLoc.ValidateDelete(); err != nil {
+		t.Fatalf("unexpected error after the ClusterBackupLocation is deleted: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition describes one aspect of the state of a resource. It has the
+// same fields as "Condition" in newer versions of apimachinery so that
+// it can be replaced without changing the serialized form.
+type Condition struct {
+	// Type of the condition in CamelCase.
+	Type string `json:"type"`
+
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status metav1.ConditionStatus `json:"status"`
+
+	// Generation of the resource for which the condition was set.
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Last time the status of the condition changed.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+
+	// Reason for the last transition in CamelCase.
+	Reason string `json:"reason"`
+
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+// FindCondition returns the condition of the given type, or nil.
+func FindCondition(conditions []Condition, conditionType string) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+
+	return nil
+}
+
+// SetCondition adds or updates the condition with the same type. The
+// transition time is only changed if the status changes.
+func SetCondition(conditions *[]Condition, newCondition Condition) {
+	if newCondition.LastTransitionTime.IsZero() {
+		newCondition.LastTransitionTime = metav1.Now()
+	}
+
+	existing := FindCondition(*conditions, newCondition.Type)
+	if existing == nil {
+		*conditions = append(*conditions, newCondition)
+		return
+	}
+
+	if existing.Status != newCondition.Status {
+		existing.Status = newCondition.Status
+		existing.LastTransitionTime = newCondition.LastTransitionTime
+	}
+
+	existing.ObservedGeneration = newCondition.ObservedGeneration
+	existing.Reason = newCondition.Reason
+	existing.Message = newCondition.Message
+}
+
+// Condition types set on all resources. Exactly one of them is true once
+// the resource has been processed.
+const (
+	// The resource is in the desired state. For a policy, the last backup
+	// was successful.
+	ConditionReady = "Ready"
+
+	// An operation (such as initialization, backup or restore) is in
+	// progress.
+	ConditionProgressing = "Progressing"
+
+	// The last operation failed. The message has the details.
+	ConditionFailed = "Failed"
+)
+
+// SetPhase sets the "Ready", "Progressing" and "Failed" conditions such
+// that only the one of the given type is true. The reason and message only
+// apply to that condition. The others get the type of the true condition
+// as their reason, and no message.
+func SetPhase(conditions *[]Condition, conditionType string, generation int64, reason string, message string) {
+	for _, t := range []string{ConditionReady, ConditionProgressing, ConditionFailed} {
+		cond := Condition{
+			Type:               t,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: generation,
+			Reason:             conditionType,
+		}
+
+		if t == conditionType {
+			cond.Status = metav1.ConditionTrue
+			cond.Reason = reason
+			cond.Message = message
+		}
+
+		SetCondition(conditions, cond)
+	}
+}
+
+// PhaseOf returns the type of the condition that corresponds to the given
+// value of a status field such as "backupStatus" or "initStatus".
+func PhaseOf(status string) string {
+	switch status {
+	case "Completed":
+		return ConditionReady
+
+	case "Failed":
+		return ConditionFailed
+	}
+
+	return ConditionProgressing
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetPhase(t *testing.T) {
+	var conditions []Condition
+
+	SetPhase(&conditions, ConditionProgressing, 1, "BackupInProgress", "")
+	SetPhase(&conditions, ConditionFailed, 2, "BackupFailed", "repo is locked")
+
+	tests := []struct {
+		conditionType string
+		status        metav1.ConditionStatus
+		reason        string
+		message       string
+	}{
+		{ConditionReady, metav1.ConditionFalse, ConditionFailed, ""},
+		{ConditionProgressing, metav1.ConditionFalse, ConditionFailed, ""},
+		{ConditionFailed, metav1.ConditionTrue, "BackupFailed", "repo is locked"},
+	}
+
+	if len(conditions) != len(tests) {
+		t.Fatalf("expected %d conditions, got %v", len(tests), conditions)
+	}
+
+	for _, tc := range tests {
+		cond := FindCondition(conditions, tc.conditionType)
+		if cond == nil {
+			t.Fatalf("condition %s is not set", tc.conditionType)
+		}
+
+		if cond.Status != tc.status || cond.Reason != tc.reason || cond.Message != tc.message ||
+			cond.ObservedGeneration != 2 {
+			t.Fatalf("unexpected condition %s: %+v", tc.conditionType, cond)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MetadataBackupSpec defines the desired state of MetadataBackup
+type MetadataBackupSpec struct {
+	// Name of the MetadataBackupPolicy, in the same namespace, whose
+	// settings are used for the backup.
+	// kubebuilder:validation:MinLength:=1
+	Policy string `json:"policy"`
+}
+
+// MetadataBackupStatus defines the observed state of MetadataBackup
+type MetadataBackupStatus struct {
+	// Generation of the spec that was last processed.
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// One of "InProgress", "Completed" or "Failed".
+	// +kubebuilder:validation:Optional
+	BackupStatus string `json:"backupStatus,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	BackupErrorMessage string `json:"backupErrorMessage,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Name of the job that performs the backup.
+	// +kubebuilder:validation:Optional
+	JobName string `json:"jobName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	SnapshotID string `json:"snapshotId,omitempty"`
+
+	// Name of the MetadataBackupRecord of the backup.
+	// +kubebuilder:validation:Optional
+	MBRName string `json:"mbrName,omitempty"`
+
+	// "Ready", "Progressing" and "Failed" conditions.
+	// +kubebuilder:validation:Optional
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// The creation of this resource triggers a one-off backup using the
+// settings of a MetadataBackupPolicy, independent of its schedule.
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Policy",type="string",JSONPath=".spec.policy"
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.backupStatus"
+// +kubebuilder:printcolumn:name="Snapshot",type="string",JSONPath=".status.snapshotId"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// MetadataBackup is the Schema for the metadatabackups API
+type MetadataBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MetadataBackupSpec   `json:"spec,omitempty"`
+	Status MetadataBackupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MetadataBackupList contains a list of MetadataBackup
+type MetadataBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MetadataBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MetadataBackup{}, &MetadataBackupList{})
+}
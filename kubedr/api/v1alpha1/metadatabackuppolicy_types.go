@@ -17,8 +17,10 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -33,6 +35,13 @@ type MetadataBackupPolicySpec struct {
 	// kubebuilder:validation:MinLength:=1
 	Destination string `json:"destination"`
 
+	// Kind of the destination, "BackupLocation" (in the namespace of the
+	// policy) or "ClusterBackupLocation". If not provided,
+	// "BackupLocation" is used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=BackupLocation;ClusterBackupLocation
+	DestinationKind string `json:"destinationKind,omitempty"`
+
 	// Optional. If not provided, certificates will not be backed up.
 	// +kubebuilder:validation:Optional
 	CertsDir string `json:"certsDir,omitempty"`
@@ -61,17 +70,310 @@ type MetadataBackupPolicySpec struct {
 	// +kubebuilder:validation:Optional
 	RetainNumBackups *int64 `json:"retainNumBackups,omitempty"`
 
+	// Rules that decide which backups are kept. If provided,
+	// "retainNumBackups" is ignored.
+	// +kubebuilder:validation:Optional
+	Retention *RetentionPolicy `json:"retention,omitempty"`
+
+	// Backups older than this (such as "720h") are deleted. If provided,
+	// "retainNumBackups" is ignored. It can't be used with "retention".
+	// +kubebuilder:validation:Optional
+	RetainWithin *metav1.Duration `json:"retainWithin,omitempty"`
+
+	// Number of latest backups that are kept regardless of "retainWithin".
+	// If not provided, 1 is used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	RetainMinBackups *int64 `json:"retainMinBackups,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	Suspend *bool `json:"suspend,omitempty"`
+
+	// Number of times a failed backup pod is retried before the backup
+	// is marked as failed.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// Time, in seconds, that a backup can run, including retries,
+	// before it is stopped and reported as timed out.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// If a backup can't be started within this many seconds of its
+	// scheduled time, it is skipped.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// Number of completed backup jobs to keep.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+
+	// Number of failed backup jobs to keep.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+
+	// Additional BackupLocations to which every successful backup is copied.
+	// +kubebuilder:validation:Optional
+	Replicas []ReplicaSpec `json:"replicas,omitempty"`
+
+	// Containers that run in the backup pod before and after the backup.
+	// +kubebuilder:validation:Optional
+	Hooks *BackupHooks `json:"hooks,omitempty"`
+
+	// If provided, the etcd snapshot is verified before it is backed up
+	// and the backup fails if it is not valid.
+	// +kubebuilder:validation:Optional
+	Verify *SnapshotVerification `json:"verify,omitempty"`
+
+	// Strategic merge patch of a pod template, for example to set
+	// resources, tolerations or annotations, that is applied to the pods
+	// that back up etcd and the certificates for this policy. The
+	// "podTemplate" of the backup location is not used for these pods.
+	// Containers are merged by name. Only labels and annotations can be
+	// set in the metadata.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+}
+
+// SnapshotVerification configures the checks of the etcd snapshot. Its
+// integrity hash, revision and number of keys are always checked.
+type SnapshotVerification struct {
+	// If true, the snapshot is also restored into a scratch directory and
+	// the keys in the restored data are counted.
+	// +kubebuilder:validation:Optional
+	Restore bool `json:"restore,omitempty"`
+}
+
+// SnapshotVerificationResult is the outcome of the verification of an etcd
+// snapshot.
+type SnapshotVerificationResult struct {
+	Verified bool `json:"verified"`
+
+	// Hash of the snapshot, in hex, as reported by "etcdctl snapshot status".
+	// +kubebuilder:validation:Optional
+	Hash string `json:"hash,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Revision int64 `json:"revision,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	TotalKeys int64 `json:"totalKeys,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	TotalSizeBytes int64 `json:"totalSizeBytes,omitempty"`
+
+	// Number of keys in the restored data. Only set if the snapshot was
+	// restored.
+	// +kubebuilder:validation:Optional
+	RestoredKeys *int64 `json:"restoredKeys,omitempty"`
+
+	// Reason why the snapshot couldn't be verified.
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+// Failure policies of backup hooks.
+const (
+	HookOnErrorFail     = "Fail"
+	HookOnErrorContinue = "Continue"
+)
+
+// Phases in which backup hooks run.
+const (
+	HookPhasePre  = "Pre"
+	HookPhasePost = "Post"
+)
+
+// BackupHooks lists the hooks of a policy. Hooks of each phase run one
+// after the other, in the given order.
+type BackupHooks struct {
+	// Hooks that run before the backup.
+	// +kubebuilder:validation:Optional
+	Pre []BackupHook `json:"pre,omitempty"`
+
+	// Hooks that run after a successful backup.
+	// +kubebuilder:validation:Optional
+	Post []BackupHook `json:"post,omitempty"`
+}
+
+// BackupHook is a command that runs in a container of the backup pod. It
+// has access to the directory that is backed up ("/data") and to the etcd
+// credentials ("/etcd_creds").
+type BackupHook struct {
+	// Name of the hook, unique among all the hooks of the policy.
+	// kubebuilder:validation:MinLength:=1
+	Name string `json:"name"`
+
+	// kubebuilder:validation:MinLength:=1
+	Image string `json:"image"`
+
+	// kubebuilder:validation:MinItems:=1
+	Command []string `json:"command"`
+
+	// +kubebuilder:validation:Optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// What to do if the hook fails or times out. "Fail" skips the
+	// remaining hooks (and the backup, for a pre-backup hook) and
+	// "Continue" ignores the failure. If not provided, "Fail" is used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Fail;Continue
+	OnError string `json:"onError,omitempty"`
+
+	// If not provided, 300 is used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	TimeoutSeconds *int64 `json:"timeoutSeconds,omitempty"`
+}
+
+// HookResult is the result of a hook in the last backup.
+type HookResult struct {
+	Name string `json:"name"`
+
+	// "Pre" or "Post".
+	Phase string `json:"phase"`
+
+	// One of "Succeeded", "Failed" or "TimedOut".
+	Status string `json:"status"`
+
+	// +kubebuilder:validation:Optional
+	ExitCode int32 `json:"exitCode,omitempty"`
+
+	// Last lines of the output of a hook that failed.
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// MaxBackupRuns is the number of recent backups that are kept in the
+// history of a policy.
+const MaxBackupRuns = 20
+
+// BackupRun is the outcome of a single backup of a policy.
+type BackupRun struct {
+	// +kubebuilder:validation:Optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// One of "Completed", "Failed" or "TimedOut".
+	Result string `json:"result"`
+
+	// +kubebuilder:validation:Optional
+	ErrorMessage string `json:"errorMessage,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	SnapshotID string `json:"snapshotId,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	DataAdded uint64 `json:"dataAdded,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	DurationSecs resource.Quantity `json:"durationSecs,omitempty"`
+
+	// Name of the pod that performed the backup or, if the backup timed
+	// out, of the job.
+	// +kubebuilder:validation:Optional
+	Pod string `json:"pod,omitempty"`
+}
+
+// BackupHistory describes the recent backups of a policy. It is part of the
+// status but, since kubedrutil overwrites the status after every backup, the
+// controller keeps it in a config map as well and restores it from there.
+type BackupHistory struct {
+	// Recent backups, oldest first. At most MaxBackupRuns are kept.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:MaxItems=20
+	History []BackupRun `json:"history,omitempty"`
+
+	// Number of backups that failed since the last successful one.
+	// +kubebuilder:validation:Optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	LastSuccessfulBackupTime *metav1.Time `json:"lastSuccessfulBackupTime,omitempty"`
+
+	// Percentage of the backups in the history that succeeded.
+	// +kubebuilder:validation:Optional
+	SuccessRatePercent int32 `json:"successRatePercent,omitempty"`
+}
+
+// ReplicaSpec describes a copy of the backups of a policy.
+type ReplicaSpec struct {
+	// Name of the BackupLocation resource to which backups are copied.
+	// It must be different from the destination of the policy.
+	// kubebuilder:validation:MinLength:=1
+	Destination string `json:"destination"`
+
+	// Number of copies to keep at the destination. If not provided,
+	// "retention" or "retainNumBackups" of the policy is used.
+	// +kubebuilder:validation:Optional
+	RetainNumBackups *int64 `json:"retainNumBackups,omitempty"`
+}
+
+// RetentionPolicy keeps the latest backups as well as the latest backup of
+// each of the last few hours, days, weeks, months and years. A backup is
+// kept if any of the rules keeps it. Periods are in UTC and only those
+// that have a backup are counted.
+type RetentionPolicy struct {
+	// Number of latest backups to keep.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	KeepLast int64 `json:"keepLast,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	KeepHourly int64 `json:"keepHourly,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	KeepDaily int64 `json:"keepDaily,omitempty"`
+
+	// Weeks start on Monday.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	KeepWeekly int64 `json:"keepWeekly,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	KeepMonthly int64 `json:"keepMonthly,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	KeepYearly int64 `json:"keepYearly,omitempty"`
 }
 
 // MetadataBackupPolicyStatus defines the observed state of MetadataBackupPolicy
 type MetadataBackupPolicyStatus struct {
-	BackupTime   string `json:"backupTime"`
-	BackupStatus string `json:"backupStatus"`
+	// Generation of the spec that was last processed.
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
+	// Deprecated: use "lastBackupTime".
 	// +kubebuilder:validation:Optional
-	BackupErrorMessage string `json:"backupErrorMessage"`
+	BackupTime string `json:"backupTime,omitempty"`
+
+	// Time at which the last backup finished.
+	// +kubebuilder:validation:Optional
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	BackupStatus string `json:"backupStatus,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	BackupErrorMessage string `json:"backupErrorMessage,omitempty"`
 
 	// +kubebuilder:validation:Optional
 	FilesNew uint `json:"filesNew"`
@@ -91,16 +393,36 @@ type MetadataBackupPolicyStatus struct {
 	// +kubebuilder:validation:Optional
 	SnapshotID string `json:"snapshotId"`
 
-	// Name of the pod that performed the backup.
+	// Name of the pod that performed the backup or, if the backup timed
+	// out, of the job.
 	// +kubebuilder:validation:Optional
 	BackupPod string `json:"backupPod"`
 
 	// +kubebuilder:validation:Optional
 	MBRName string `json:"mbrName"`
+
+	// Outcome of the verification of the last snapshot.
+	// +kubebuilder:validation:Optional
+	Verification *SnapshotVerificationResult `json:"verification,omitempty"`
+
+	// Results of the hooks that ran in the last backup.
+	// +kubebuilder:validation:Optional
+	HookResults []HookResult `json:"hookResults,omitempty"`
+
+	BackupHistory `json:",inline"`
+
+	// "Ready", "Progressing" and "Failed" conditions.
+	// +kubebuilder:validation:Optional
+	Conditions []Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Destination",type="string",JSONPath=".spec.destination"
+// +kubebuilder:printcolumn:name="Schedule",type="string",JSONPath=".spec.schedule"
+// +kubebuilder:printcolumn:name="Last Backup",type="date",JSONPath=".status.lastBackupTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MetadataBackupPolicy is the Schema for the metadatabackuppolicies API
 type MetadataBackupPolicy struct {
@@ -123,3 +445,9 @@ type MetadataBackupPolicyList struct {
 func init() {
 	SchemeBuilder.Register(&MetadataBackupPolicy{}, &MetadataBackupPolicyList{})
 }
+
+// UsesClusterBackupLocation returns true if the destination is a
+// ClusterBackupLocation.
+func (spec *MetadataBackupPolicySpec) UsesClusterBackupLocation() bool {
+	return spec.DestinationKind == KindClusterBackupLocation
+}
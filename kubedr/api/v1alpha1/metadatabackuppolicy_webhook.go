@@ -17,11 +17,17 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/robfig/cron"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -64,11 +70,67 @@ func (r *MetadataBackupPolicy) Default() {
 		*r.Spec.RetainNumBackups = 120
 	}
 
+	if r.Spec.RetainWithin != nil && r.Spec.RetainMinBackups == nil {
+		log.Info("Initializing RetainMinBackups")
+		r.Spec.RetainMinBackups = new(int64)
+		*r.Spec.RetainMinBackups = 1
+	}
+
+	if r.Spec.Hooks != nil {
+		defaultHooks(r.Spec.Hooks.Pre)
+		defaultHooks(r.Spec.Hooks.Post)
+	}
+
 	if r.Spec.Suspend == nil {
 		log.Info("Initializing 'Suspend'")
 		// Initialized to false.
 		r.Spec.Suspend = new(bool)
 	}
+
+	r.defaultJobLimits()
+}
+
+// defaultJobLimits sets the limits of the backup jobs. Without a deadline,
+// a hung backup would block all later ones as they are not run
+// concurrently.
+func (r *MetadataBackupPolicy) defaultJobLimits() {
+	if r.Spec.BackoffLimit == nil {
+		r.Spec.BackoffLimit = new(int32)
+		*r.Spec.BackoffLimit = 2
+	}
+
+	if r.Spec.ActiveDeadlineSeconds == nil {
+		r.Spec.ActiveDeadlineSeconds = new(int64)
+		*r.Spec.ActiveDeadlineSeconds = 3600
+	}
+
+	if r.Spec.StartingDeadlineSeconds == nil {
+		r.Spec.StartingDeadlineSeconds = new(int64)
+		*r.Spec.StartingDeadlineSeconds = 300
+	}
+
+	if r.Spec.SuccessfulJobsHistoryLimit == nil {
+		r.Spec.SuccessfulJobsHistoryLimit = new(int32)
+		*r.Spec.SuccessfulJobsHistoryLimit = 3
+	}
+
+	if r.Spec.FailedJobsHistoryLimit == nil {
+		r.Spec.FailedJobsHistoryLimit = new(int32)
+		*r.Spec.FailedJobsHistoryLimit = 1
+	}
+}
+
+func defaultHooks(hooks []BackupHook) {
+	for i := range hooks {
+		if hooks[i].OnError == "" {
+			hooks[i].OnError = HookOnErrorFail
+		}
+
+		if hooks[i].TimeoutSeconds == nil {
+			hooks[i].TimeoutSeconds = new(int64)
+			*hooks[i].TimeoutSeconds = 300
+		}
+	}
 }
 
 // TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
@@ -89,15 +151,196 @@ func (r *MetadataBackupPolicy) validateCronJobSpec() *field.Error {
 		field.NewPath("spec").Child("schedule"))
 }
 
-func (r *MetadataBackupPolicy) validatePolicy() error {
+// validateJobLimits checks the limits of the backup jobs.
+func (r *MetadataBackupPolicy) validateJobLimits() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	checkMin := func(name string, value *int64, min int64) {
+		if value != nil && *value < min {
+			allErrs = append(allErrs, field.Invalid(specPath.Child(name), *value,
+				fmt.Sprintf("must be at least %d", min)))
+		}
+	}
+
+	int32Value := func(value *int32) *int64 {
+		if value == nil {
+			return nil
+		}
+		v := int64(*value)
+		return &v
+	}
+
+	checkMin("backoffLimit", int32Value(r.Spec.BackoffLimit), 0)
+	checkMin("activeDeadlineSeconds", r.Spec.ActiveDeadlineSeconds, 1)
+	checkMin("startingDeadlineSeconds", r.Spec.StartingDeadlineSeconds, 0)
+	checkMin("successfulJobsHistoryLimit", int32Value(r.Spec.SuccessfulJobsHistoryLimit), 0)
+	checkMin("failedJobsHistoryLimit", int32Value(r.Spec.FailedJobsHistoryLimit), 0)
+
+	return allErrs
+}
+
+func (r *MetadataBackupPolicy) validateReplicas() field.ErrorList {
+	var allErrs field.ErrorList
+
+	// A ClusterBackupLocation can have the same name as a BackupLocation.
+	seen := map[string]bool{}
+	if !r.Spec.UsesClusterBackupLocation() {
+		seen[r.Spec.Destination] = true
+	}
+
+	for i, replica := range r.Spec.Replicas {
+		replicaPath := field.NewPath("spec").Child("replicas").Index(i)
+
+		if replica.Destination == "" {
+			allErrs = append(allErrs, field.Required(replicaPath.Child("destination"), ""))
+		} else if seen[replica.Destination] {
+			allErrs = append(allErrs, field.Duplicate(replicaPath.Child("destination"), replica.Destination))
+		}
+		seen[replica.Destination] = true
+
+		if replica.RetainNumBackups != nil && *replica.RetainNumBackups < 1 {
+			allErrs = append(allErrs, field.Invalid(replicaPath.Child("retainNumBackups"),
+				*replica.RetainNumBackups, "must be at least 1"))
+		}
+	}
+
+	return allErrs
+}
+
+func (r *MetadataBackupPolicy) validateRetention() field.ErrorList {
+	var allErrs field.ErrorList
+
+	specPath := field.NewPath("spec")
+
+	if r.Spec.Retention != nil {
+		allErrs = append(allErrs, r.Spec.Retention.validate(specPath.Child("retention"))...)
+	}
+
+	if r.Spec.RetainWithin != nil {
+		if r.Spec.Retention != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("retainWithin"),
+				"can't be used with retention"))
+		} else if r.Spec.RetainWithin.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("retainWithin"),
+				r.Spec.RetainWithin.Duration.String(), "must be greater than zero"))
+		}
+	}
+
+	// Keeping no backups would defeat the purpose of the minimum.
+	if r.Spec.RetainMinBackups != nil && *r.Spec.RetainMinBackups < 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("retainMinBackups"),
+			*r.Spec.RetainMinBackups, "must be at least 1"))
+	}
+
+	return allErrs
+}
+
+const maxHookNameLength = validation.DNS1123LabelMaxLength - len("hook-")
+
+func (r *MetadataBackupPolicy) validateHooks() field.ErrorList {
+	var allErrs field.ErrorList
+
+	if r.Spec.Hooks == nil {
+		return nil
+	}
+
+	hooksPath := field.NewPath("spec").Child("hooks")
+	seen := map[string]bool{}
+
+	validate := func(hooks []BackupHook, fldPath *field.Path) {
+		for i, hook := range hooks {
+			hookPath := fldPath.Index(i)
+
+			// Hook names are used in the names of containers, with the
+			// prefix "hook-".
+			if hook.Name == "" {
+				allErrs = append(allErrs, field.Required(hookPath.Child("name"), ""))
+			} else if len(hook.Name) > maxHookNameLength {
+				allErrs = append(allErrs, field.TooLong(hookPath.Child("name"), hook.Name, maxHookNameLength))
+			} else if msgs := validation.IsDNS1123Label(hook.Name); len(msgs) > 0 {
+				allErrs = append(allErrs, field.Invalid(hookPath.Child("name"), hook.Name,
+					strings.Join(msgs, ", ")))
+			} else if seen[hook.Name] {
+				allErrs = append(allErrs, field.Duplicate(hookPath.Child("name"), hook.Name))
+			}
+			seen[hook.Name] = true
+
+			if hook.Image == "" {
+				allErrs = append(allErrs, field.Required(hookPath.Child("image"), ""))
+			}
+
+			if len(hook.Command) == 0 {
+				allErrs = append(allErrs, field.Required(hookPath.Child("command"), ""))
+			}
+
+			if hook.TimeoutSeconds != nil && *hook.TimeoutSeconds < 1 {
+				allErrs = append(allErrs, field.Invalid(hookPath.Child("timeoutSeconds"),
+					*hook.TimeoutSeconds, "must be at least 1"))
+			}
+		}
+	}
+
+	validate(r.Spec.Hooks.Pre, hooksPath.Child("pre"))
+	validate(r.Spec.Hooks.Post, hooksPath.Child("post"))
+
+	return allErrs
+}
+
+// validateClusterDestination checks that the ClusterBackupLocation exists
+// and that the namespace of the policy is allowed to use it. It is shared
+// by all kinds of policies.
+func validateClusterDestination(namespace string, kind string, destination string) *field.Error {
+	if kind != KindClusterBackupLocation || backupLocationReader == nil {
+		return nil
+	}
+
+	destPath := field.NewPath("spec").Child("destination")
+
+	ctx, cancel := context.WithTimeout(context.Background(), backupLocationValidation.Timeout)
+	defer cancel()
+
+	var clusterLoc ClusterBackupLocation
+	if err := backupLocationReader.Get(ctx, types.NamespacedName{Name: destination},
+		&clusterLoc); err != nil {
+
+		if apierrors.IsNotFound(err) {
+			return field.NotFound(destPath, destination)
+		}
+
+		return field.InternalError(destPath, err)
+	}
+
+	if !clusterLoc.AllowsNamespace(namespace) {
+		return field.Forbidden(destPath, fmt.Sprintf("namespace %q is not allowed to use ClusterBackupLocation %q",
+			namespace, destination))
+	}
+
+	return nil
+}
+
+// validatePolicy checks the policy. The destination is checked only if
+// "checkDestination" is true so that a location that is no longer allowed
+// doesn't block unrelated updates.
+func (r *MetadataBackupPolicy) validatePolicy(checkDestination bool) error {
 	var allErrs field.ErrorList
 
 	if err := r.validateCronJobSpec(); err != nil {
 		allErrs = append(allErrs, err)
 	}
 
-	// Validate destination
-	// Verify that the resource exists.
+	allErrs = append(allErrs, r.validateReplicas()...)
+
+	allErrs = append(allErrs, r.validateRetention()...)
+	allErrs = append(allErrs, r.validateHooks()...)
+	allErrs = append(allErrs, r.validateJobLimits()...)
+	allErrs = append(allErrs, validatePodTemplate(r.Spec.PodTemplate, field.NewPath("spec").Child("podTemplate"))...)
+
+	if checkDestination {
+		if err := validateClusterDestination(r.Namespace, r.Spec.DestinationKind, r.Spec.Destination); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
 
 	// Validate etcd endpoint and creds
 	// Connect and issue a dummy command
@@ -117,13 +360,20 @@ func (r *MetadataBackupPolicy) validatePolicy() error {
 func (r *MetadataBackupPolicy) ValidateCreate() error {
 	log.Info("validate create", "name", r.Name)
 
-	return r.validatePolicy()
+	return r.validatePolicy(true)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *MetadataBackupPolicy) ValidateUpdate(old runtime.Object) error {
 	log.Info("validate update", "name", r.Name)
-	return r.validatePolicy()
+
+	checkDestination := true
+	if oldPolicy, ok := old.(*MetadataBackupPolicy); ok {
+		checkDestination = (oldPolicy.Spec.Destination != r.Spec.Destination) ||
+			(oldPolicy.Spec.DestinationKind != r.Spec.DestinationKind)
+	}
+
+	return r.validatePolicy(checkDestination)
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -0,0 +1,204 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPolicy() *MetadataBackupPolicy {
+	return &MetadataBackupPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "kubedr-system"},
+		Spec: MetadataBackupPolicySpec{
+			Destination: "primary",
+			Schedule:    "*/10 * * * *",
+		},
+	}
+}
+
+func TestMetadataBackupPolicyValidateReplicas(t *testing.T) {
+	zero := int64(0)
+	five := int64(5)
+
+	tests := []struct {
+		name     string
+		replicas []ReplicaSpec
+		wantErr  string
+	}{
+		{"no replicas", nil, ""},
+		{"valid", []ReplicaSpec{{Destination: "offsite", RetainNumBackups: &five}}, ""},
+		{"same as destination", []ReplicaSpec{{Destination: "primary"}}, "spec.replicas[0].destination"},
+		{"duplicate", []ReplicaSpec{{Destination: "offsite"}, {Destination: "offsite"}},
+			"spec.replicas[1].destination"},
+		{"empty destination", []ReplicaSpec{{}}, "spec.replicas[0].destination"},
+		{"invalid retention", []ReplicaSpec{{Destination: "offsite", RetainNumBackups: &zero}},
+			"spec.replicas[0].retainNumBackups"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := testPolicy()
+			policy.Spec.Replicas = tc.replicas
+
+			err := policy.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMetadataBackupPolicyValidateHooks(t *testing.T) {
+	hook := func(name string) BackupHook {
+		return BackupHook{Name: name, Image: "quay.io/coreos/etcd:v3.4.3", Command: []string{"etcdctl", "defrag"}}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*BackupHooks)
+		wantErr string
+	}{
+		{"valid", func(*BackupHooks) {}, ""},
+		{"duplicate across phases", func(hooks *BackupHooks) {
+			hooks.Post = append(hooks.Post, hook("defrag"))
+		}, "spec.hooks.post[1].name"},
+		{"invalid name", func(hooks *BackupHooks) {
+			hooks.Pre[0].Name = "Defrag"
+		}, "spec.hooks.pre[0].name"},
+		{"long name", func(hooks *BackupHooks) {
+			hooks.Pre[0].Name = strings.Repeat("a", 59)
+		}, "spec.hooks.pre[0].name"},
+		{"no command", func(hooks *BackupHooks) {
+			hooks.Post[0].Command = nil
+		}, "spec.hooks.post[0].command"},
+		{"no image", func(hooks *BackupHooks) {
+			hooks.Post[0].Image = ""
+		}, "spec.hooks.post[0].image"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := testPolicy()
+			policy.Spec.Hooks = &BackupHooks{
+				Pre:  []BackupHook{hook("defrag")},
+				Post: []BackupHook{hook("marker")},
+			}
+			tc.modify(policy.Spec.Hooks)
+			policy.Default()
+
+			err := policy.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMetadataBackupPolicyJobLimits(t *testing.T) {
+	policy := testPolicy()
+	policy.Default()
+
+	if *policy.Spec.BackoffLimit != 2 || *policy.Spec.ActiveDeadlineSeconds != 3600 ||
+		*policy.Spec.StartingDeadlineSeconds != 300 || *policy.Spec.SuccessfulJobsHistoryLimit != 3 ||
+		*policy.Spec.FailedJobsHistoryLimit != 1 {
+		t.Fatalf("unexpected defaults: %+v", policy.Spec)
+	}
+
+	if err := policy.ValidateCreate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Values that are set are not changed.
+	policy = testPolicy()
+	deadline := int64(0)
+	policy.Spec.ActiveDeadlineSeconds = &deadline
+	policy.Default()
+
+	err := policy.ValidateCreate()
+	if err == nil || !strings.Contains(err.Error(), "spec.activeDeadlineSeconds") {
+		t.Fatalf("expected error containing %q, got: %v", "spec.activeDeadlineSeconds", err)
+	}
+}
+
+func TestMetadataBackupPolicyValidateClusterDestination(t *testing.T) {
+	clusterLoc := testClusterBackupLocation("http://10.0.0.1:9000")
+
+	tests := []struct {
+		name        string
+		namespace   string
+		destination string
+		wantErr     string
+	}{
+		{"allowed", "team-a", "shared", ""},
+		{"not allowed", "team-b", "shared", "not allowed"},
+		{"missing", "team-a", "missing", "spec.destination"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds,
+				clusterLoc)()
+
+			policy := testPolicy()
+			policy.Namespace = tc.namespace
+			policy.Spec.Destination = tc.destination
+			policy.Spec.DestinationKind = KindClusterBackupLocation
+
+			err := policy.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	// A replica can have the same name as a ClusterBackupLocation.
+	policy := testPolicy()
+	policy.Namespace = "team-a"
+	policy.Spec.Destination = "shared"
+	policy.Spec.DestinationKind = KindClusterBackupLocation
+	policy.Spec.Replicas = []ReplicaSpec{{Destination: "shared"}}
+
+	defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds, clusterLoc)()
+	if err := policy.ValidateCreate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -34,17 +34,73 @@ type MetadataBackupRecordSpec struct {
 	// kubebuilder:validation:MinLength:=1
 	Policy string `json:"policy"`
 
+	// Kind of "policy", "MetadataBackupPolicy" or "ResourceBackupPolicy".
+	// If not set, it is a MetadataBackupPolicy.
+	// +kubebuilder:validation:Optional
+	PolicyKind string `json:"policyKind,omitempty"`
+
 	// kubebuilder:validation:MinLength:=1
 	Backuploc string `json:"backuploc"`
+
+	// Kind of "backuploc", copied from "destinationKind" of the policy. If
+	// not set, it is a BackupLocation in the namespace of the record.
+	// +kubebuilder:validation:Optional
+	BackuplocKind string `json:"backuplocKind,omitempty"`
+
+	// Name of the MetadataBackupRecord from which this snapshot was
+	// copied. Only set for replicas.
+	// +kubebuilder:validation:Optional
+	ReplicaOf string `json:"replicaOf,omitempty"`
+
+	// Name of the MetadataBackup that started the backup. Only set for
+	// backups that were not started by the schedule of the policy.
+	// +kubebuilder:validation:Optional
+	ManualBackup string `json:"manualBackup,omitempty"`
+
+	// Outcome of the verification of the etcd snapshot. Only set if the
+	// policy has "verify".
+	// +kubebuilder:validation:Optional
+	Verification *SnapshotVerificationResult `json:"verification,omitempty"`
+
+	// Time until which the data of the snapshot is locked by S3 Object
+	// Lock. Set when the BackupLocation has "objectLock".
+	// +kubebuilder:validation:Optional
+	LockedUntil *metav1.Time `json:"lockedUntil,omitempty"`
 }
 
 // MetadataBackupRecordStatus defines the observed state of MetadataBackupRecord
 type MetadataBackupRecordStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Generation of the spec that was last processed.
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// "Ready" (the snapshot is available), "Progressing", "Failed", "Held"
+	// and "Replicated" conditions.
+	// +kubebuilder:validation:Optional
+	Conditions []Condition `json:"conditions,omitempty"`
 }
 
+// Condition types of MetadataBackupRecord.
+const (
+	// True if the snapshot is due to be deleted as per retention but is
+	// kept because it is still locked.
+	MetadataBackupRecordHeld = "Held"
+
+	// True once the snapshot has been copied to all the replicas of the
+	// policy, false if copying to any of them failed.
+	MetadataBackupRecordReplicated = "Replicated"
+)
+
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Policy",type="string",JSONPath=".spec.policy"
+// +kubebuilder:printcolumn:name="Location",type="string",JSONPath=".spec.backuploc"
+// +kubebuilder:printcolumn:name="Snapshot",type="string",JSONPath=".spec.snapshotId"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MetadataBackupRecord is the Schema for the metadatabackuprecords API
 type MetadataBackupRecord struct {
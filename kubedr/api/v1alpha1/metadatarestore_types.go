@@ -43,12 +43,23 @@ type MetadataRestoreStatus struct {
 	// +kubebuilder:validation:Optional
 	ObservedGeneration int64 `json:"observedGeneration"`
 
-	RestoreStatus string `json:"restoreStatus"`
+	// +kubebuilder:validation:Optional
+	RestoreStatus string `json:"restoreStatus,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	RestoreErrorMessage string `json:"restoreErrorMessage,omitempty"`
 
+	// Deprecated: use "completionTime".
 	// +kubebuilder:validation:Optional
-	RestoreErrorMessage string `json:"restoreErrorMessage"`
+	RestoreTime string `json:"restoreTime,omitempty"`
 
-	RestoreTime string `json:"restoreTime"`
+	// Time at which the restore finished.
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// "Ready", "Progressing" and "Failed" conditions.
+	// +kubebuilder:validation:Optional
+	Conditions []Condition `json:"conditions,omitempty"`
 }
 
 // The creation of this resource triggers full restore of the data
@@ -59,6 +70,10 @@ type MetadataRestoreStatus struct {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="MBR",type="string",JSONPath=".spec.mbrName"
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.restoreStatus"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MetadataRestore is the Schema for the metadatarestores API
 type MetadataRestore struct {
@@ -0,0 +1,168 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// AllContainers is the name of a container in a pod template override that
+// is merged into all the containers of a pod.
+const AllContainers = "*"
+
+// ApplyPodTemplate merges the given override, a strategic merge patch of a
+// pod template, into the given template. Containers are merged by name.
+func ApplyPodTemplate(template *corev1.PodTemplateSpec, override *runtime.RawExtension) error {
+	if override == nil || len(override.Raw) == 0 {
+		return nil
+	}
+
+	original, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+
+	patch, err := expandAllContainers(override.Raw, template)
+	if err != nil {
+		return fmt.Errorf("error in applying podTemplate: %v", err)
+	}
+
+	merged, err := strategicpatch.StrategicMergePatch(original, patch, corev1.PodTemplateSpec{})
+	if err != nil {
+		return fmt.Errorf("error in applying podTemplate: %v", err)
+	}
+
+	var result corev1.PodTemplateSpec
+	if err := json.Unmarshal(merged, &result); err != nil {
+		return fmt.Errorf("error in applying podTemplate: %v", err)
+	}
+
+	*template = result
+	return nil
+}
+
+// expandAllContainers replaces the containers named AllContainers in the
+// patch with a copy for each of the containers in the template, as names of
+// generated containers are not always known in advance. The copies come
+// before the other containers of the patch, which take precedence.
+func expandAllContainers(patch []byte, template *corev1.PodTemplateSpec) ([]byte, error) {
+	var override map[string]interface{}
+	if err := json.Unmarshal(patch, &override); err != nil {
+		return nil, err
+	}
+
+	spec, ok := override["spec"].(map[string]interface{})
+	if !ok {
+		return patch, nil
+	}
+
+	lists := []struct {
+		key        string
+		containers []corev1.Container
+	}{
+		{"initContainers", template.Spec.InitContainers},
+		{"containers", template.Spec.Containers},
+	}
+
+	for _, list := range lists {
+		entries, ok := spec[list.key].([]interface{})
+		if !ok {
+			continue
+		}
+
+		var expanded, named []interface{}
+		for _, entry := range entries {
+			container, ok := entry.(map[string]interface{})
+			if !ok || container["name"] != AllContainers {
+				named = append(named, entry)
+				continue
+			}
+
+			for _, c := range list.containers {
+				copied := make(map[string]interface{}, len(container))
+				for k, v := range container {
+					copied[k] = v
+				}
+				copied["name"] = c.Name
+				expanded = append(expanded, copied)
+			}
+		}
+
+		if merged := append(expanded, named...); len(merged) > 0 {
+			spec[list.key] = merged
+		} else {
+			delete(spec, list.key)
+		}
+	}
+
+	return json.Marshal(override)
+}
+
+// ApplyPodTemplateToPod is the same as ApplyPodTemplate but for a pod.
+func ApplyPodTemplateToPod(pod *corev1.Pod, override *runtime.RawExtension) error {
+	template := corev1.PodTemplateSpec{ObjectMeta: pod.ObjectMeta, Spec: pod.Spec}
+	if err := ApplyPodTemplate(&template, override); err != nil {
+		return err
+	}
+
+	pod.ObjectMeta = template.ObjectMeta
+	pod.Spec = template.Spec
+	return nil
+}
+
+// validatePodTemplate checks that the override is a pod template that only
+// sets labels and annotations in its metadata.
+func validatePodTemplate(override *runtime.RawExtension, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if override == nil || len(override.Raw) == 0 {
+		return allErrs
+	}
+
+	var template corev1.PodTemplateSpec
+	decoder := json.NewDecoder(bytes.NewReader(override.Raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&template); err != nil {
+		return append(allErrs, field.Invalid(fldPath, string(override.Raw), err.Error()))
+	}
+
+	meta := template.ObjectMeta
+	meta.Labels = nil
+	meta.Annotations = nil
+	if !reflect.DeepEqual(meta, metav1.ObjectMeta{}) {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("metadata"),
+			"only labels and annotations can be set"))
+	}
+
+	// Merging into a template with a container catches patches of
+	// containers that can't be merged, such as those without a name.
+	sample := corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "kubedr"}}}}
+	if err := ApplyPodTemplate(&sample, override); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, string(override.Raw), err.Error()))
+	}
+
+	return allErrs
+}
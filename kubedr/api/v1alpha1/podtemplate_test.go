@@ -0,0 +1,135 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestApplyPodTemplate(t *testing.T) {
+	template := corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			RestartPolicy: "Never",
+			Containers:    []corev1.Container{{Name: "backup", Image: "kubedrutil"}},
+			Tolerations:   []corev1.Toleration{{Operator: "Exists", Effect: "NoSchedule"}},
+		},
+	}
+	template.Labels = map[string]string{"kubedr.type": "backup"}
+
+	override := &runtime.RawExtension{Raw: []byte(`{
+		"metadata": {"annotations": {"team": "infra"}},
+		"spec": {
+			"priorityClassName": "backup",
+			"containers": [{"name": "backup", "resources": {"limits": {"memory": "256Mi"}}}]
+		}
+	}`)}
+
+	if err := ApplyPodTemplate(&template, override); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if template.Labels["kubedr.type"] != "backup" || template.Annotations["team"] != "infra" {
+		t.Fatalf("unexpected metadata: %v", template.ObjectMeta)
+	}
+	if template.Spec.PriorityClassName != "backup" || template.Spec.RestartPolicy != "Never" {
+		t.Fatalf("unexpected spec: %v", template.Spec)
+	}
+	if len(template.Spec.Containers) != 1 || template.Spec.Containers[0].Image != "kubedrutil" {
+		t.Fatalf("containers are not merged by name: %v", template.Spec.Containers)
+	}
+	if limit := template.Spec.Containers[0].Resources.Limits.Memory().String(); limit != "256Mi" {
+		t.Fatalf("expected memory limit of 256Mi, got %s", limit)
+	}
+	if len(template.Spec.Tolerations) != 1 {
+		t.Fatalf("unexpected tolerations: %v", template.Spec.Tolerations)
+	}
+}
+
+func TestApplyPodTemplateAllContainers(t *testing.T) {
+	template := corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "export"}},
+			Containers:     []corev1.Container{{Name: "backup"}, {Name: "post-hook"}},
+		},
+	}
+
+	override := &runtime.RawExtension{Raw: []byte(`{
+		"spec": {
+			"containers": [
+				{"name": "*", "resources": {"limits": {"cpu": "1", "memory": "256Mi"}}},
+				{"name": "backup", "resources": {"limits": {"memory": "1Gi"}}}
+			]
+		}
+	}`)}
+
+	if err := ApplyPodTemplate(&template, override); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	containers := template.Spec.Containers
+	if len(containers) != 2 || containers[0].Name != "backup" || containers[1].Name != "post-hook" {
+		t.Fatalf("unexpected containers: %v", containers)
+	}
+	if got := containers[0].Resources.Limits.Memory().String(); got != "1Gi" {
+		t.Fatalf("expected the named container to take precedence, got memory limit %s", got)
+	}
+	if got := containers[0].Resources.Limits.Cpu().String(); got != "1" {
+		t.Fatalf("expected cpu limit of 1, got %s", got)
+	}
+	if got := containers[1].Resources.Limits.Memory().String(); got != "256Mi" {
+		t.Fatalf("expected memory limit of 256Mi, got %s", got)
+	}
+	if len(template.Spec.InitContainers[0].Resources.Limits) != 0 {
+		t.Fatalf("init containers are only changed by initContainers: %v", template.Spec.InitContainers)
+	}
+}
+
+func TestValidatePodTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		wantErr  string
+	}{
+		{"valid", `{"spec": {"nodeSelector": {"backup": "true"}}}`, ""},
+		{"unknown field", `{"spec": {"nodeSelecter": {"backup": "true"}}}`, "spec.podTemplate"},
+		{"name", `{"metadata": {"name": "backup"}}`, "spec.podTemplate.metadata"},
+		{"container without name", `{"spec": {"containers": [{"image": "busybox"}]}}`, "spec.podTemplate"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			allErrs := validatePodTemplate(&runtime.RawExtension{Raw: []byte(tc.override)},
+				field.NewPath("spec").Child("podTemplate"))
+
+			if tc.wantErr == "" {
+				if len(allErrs) != 0 {
+					t.Fatalf("unexpected error: %v", allErrs)
+				}
+				return
+			}
+
+			if len(allErrs) == 0 || !strings.Contains(allErrs.ToAggregate().Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, allErrs)
+			}
+		})
+	}
+}
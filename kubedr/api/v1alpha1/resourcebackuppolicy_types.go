@@ -0,0 +1,197 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Kinds of policies that create MetadataBackupRecords.
+const (
+	KindMetadataBackupPolicy = "MetadataBackupPolicy"
+	KindResourceBackupPolicy = "ResourceBackupPolicy"
+)
+
+// Formats in which resources are exported.
+const (
+	ExportFormatYAML = "yaml"
+	ExportFormatJSON = "json"
+)
+
+// GroupVersionKind identifies a kind of API resource.
+type GroupVersionKind struct {
+	// API group. Empty for the core group.
+	// +kubebuilder:validation:Optional
+	Group string `json:"group,omitempty"`
+
+	// If not provided, the preferred version of the group is used. Ignored
+	// in "excludedKinds".
+	// +kubebuilder:validation:Optional
+	Version string `json:"version,omitempty"`
+
+	// kubebuilder:validation:MinLength:=1
+	Kind string `json:"kind"`
+}
+
+// ResourceBackupPolicySpec defines the desired state of ResourceBackupPolicy
+type ResourceBackupPolicySpec struct {
+	// Name of the location in which backups are stored.
+	// kubebuilder:validation:MinLength:=1
+	Destination string `json:"destination"`
+
+	// Kind of the destination, "BackupLocation" (in the namespace of the
+	// policy) or "ClusterBackupLocation". If not provided,
+	// "BackupLocation" is used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=BackupLocation;ClusterBackupLocation
+	DestinationKind string `json:"destinationKind,omitempty"`
+
+	// The value of this field should be same as "schedule" in "cronjob".
+	Schedule string `json:"schedule"`
+
+	// Namespaces whose resources are exported. If not provided, all
+	// namespaces are exported.
+	// +kubebuilder:validation:Optional
+	IncludedNamespaces []string `json:"includedNamespaces,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+
+	// If true, cluster scoped resources (such as namespaces and cluster
+	// roles) are exported too.
+	// +kubebuilder:validation:Optional
+	IncludeClusterResources bool `json:"includeClusterResources,omitempty"`
+
+	// If given, only resources matching the selector are exported.
+	// +kubebuilder:validation:Optional
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+
+	// Kinds of resources that are exported. If not provided, all kinds
+	// that can be listed are exported.
+	// +kubebuilder:validation:Optional
+	IncludedKinds []GroupVersionKind `json:"includedKinds,omitempty"`
+
+	// Kinds of resources that are never exported.
+	// +kubebuilder:validation:Optional
+	ExcludedKinds []GroupVersionKind `json:"excludedKinds,omitempty"`
+
+	// Format of the exported files. If not provided, "yaml" is used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=yaml;json
+	Format string `json:"format,omitempty"`
+
+	// Service account of the backup pod. It must be allowed to list the
+	// exported resources. If not provided, "default" is used.
+	// +kubebuilder:validation:Optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	RetainNumBackups *int64 `json:"retainNumBackups,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Suspend *bool `json:"suspend,omitempty"`
+
+	// Strategic merge patch of a pod template, for example to set
+	// resources, tolerations or annotations, that is applied to the pods
+	// that export and back up the resources selected by this policy. The
+	// "podTemplate" of the backup location is not used for these pods.
+	// Containers are merged by name. Only labels and annotations can be
+	// set in the metadata.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+}
+
+// ResourceBackupPolicyStatus defines the observed state of ResourceBackupPolicy
+type ResourceBackupPolicyStatus struct {
+	// Generation of the spec that was last processed.
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Time at which the last backup finished.
+	// +kubebuilder:validation:Optional
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	BackupStatus string `json:"backupStatus,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	BackupErrorMessage string `json:"backupErrorMessage,omitempty"`
+
+	// Number of resources exported by the last backup.
+	// +kubebuilder:validation:Optional
+	NumResources uint `json:"numResources"`
+
+	// +kubebuilder:validation:Optional
+	DataAdded uint64 `json:"dataAdded"`
+
+	// +kubebuilder:validation:Optional
+	TotalDurationSecs resource.Quantity `json:"totalDurationSecs"`
+
+	// +kubebuilder:validation:Optional
+	SnapshotID string `json:"snapshotId"`
+
+	// Name of the pod that performed the backup.
+	// +kubebuilder:validation:Optional
+	BackupPod string `json:"backupPod"`
+
+	// +kubebuilder:validation:Optional
+	MBRName string `json:"mbrName"`
+
+	// "Ready", "Progressing" and "Failed" conditions.
+	// +kubebuilder:validation:Optional
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Destination",type="string",JSONPath=".spec.destination"
+// +kubebuilder:printcolumn:name="Schedule",type="string",JSONPath=".spec.schedule"
+// +kubebuilder:printcolumn:name="Last Backup",type="date",JSONPath=".status.lastBackupTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ResourceBackupPolicy is the Schema for the resourcebackuppolicies API. It
+// exports API resources as files and backs them up.
+type ResourceBackupPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ResourceBackupPolicySpec   `json:"spec,omitempty"`
+	Status ResourceBackupPolicyStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ResourceBackupPolicyList contains a list of ResourceBackupPolicy
+type ResourceBackupPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ResourceBackupPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ResourceBackupPolicy{}, &ResourceBackupPolicyList{})
+}
+
+// UsesClusterBackupLocation returns true if the destination is a
+// ClusterBackupLocation.
+func (spec *ResourceBackupPolicySpec) UsesClusterBackupLocation() bool {
+	return spec.DestinationKind == KindClusterBackupLocation
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var resourcebackuppolicylog = logf.Log.WithName("resourcebackuppolicy-resource")
+
+// SetupWebhookWithManager configures the web hook with the manager.
+func (r *ResourceBackupPolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-kubedr-catalogicsoftware-com-v1alpha1-resourcebackuppolicy,mutating=true,failurePolicy=fail,groups=kubedr.catalogicsoftware.com,resources=resourcebackuppolicies,verbs=create;update,versions=v1alpha1,name=mresourcebackuppolicy.kb.io
+
+var _ webhook.Defaulter = &ResourceBackupPolicy{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *ResourceBackupPolicy) Default() {
+	resourcebackuppolicylog.Info("default", "name", r.Name)
+
+	if r.Spec.Format == "" {
+		resourcebackuppolicylog.Info("Initializing Format")
+		r.Spec.Format = ExportFormatYAML
+	}
+
+	if r.Spec.RetainNumBackups == nil || *r.Spec.RetainNumBackups == 0 {
+		resourcebackuppolicylog.Info("Initializing RetainNumBackups")
+		r.Spec.RetainNumBackups = new(int64)
+		*r.Spec.RetainNumBackups = 120
+	}
+
+	if r.Spec.Suspend == nil {
+		resourcebackuppolicylog.Info("Initializing 'Suspend'")
+		r.Spec.Suspend = new(bool)
+	}
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-kubedr-catalogicsoftware-com-v1alpha1-resourcebackuppolicy,mutating=false,failurePolicy=fail,groups=kubedr.catalogicsoftware.com,resources=resourcebackuppolicies,versions=v1alpha1,name=vresourcebackuppolicy.kb.io
+
+var _ webhook.Validator = &ResourceBackupPolicy{}
+
+func validateNamespaceList(namespaces []string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for i, namespace := range namespaces {
+		if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), namespace, strings.Join(msgs, ", ")))
+		}
+	}
+
+	return allErrs
+}
+
+func validateKindList(kinds []GroupVersionKind, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for i, gvk := range kinds {
+		if gvk.Kind == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Index(i).Child("kind"), ""))
+		}
+
+		if gvk.Version != "" && gvk.Group == "" && gvk.Version != "v1" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("version"), gvk.Version,
+				"the core group only has version v1"))
+		}
+	}
+
+	return allErrs
+}
+
+func (r *ResourceBackupPolicy) validateSelection() field.ErrorList {
+	specPath := field.NewPath("spec")
+
+	allErrs := validateNamespaceList(r.Spec.IncludedNamespaces, specPath.Child("includedNamespaces"))
+	allErrs = append(allErrs, validateNamespaceList(r.Spec.ExcludedNamespaces,
+		specPath.Child("excludedNamespaces"))...)
+
+	allErrs = append(allErrs, validateKindList(r.Spec.IncludedKinds, specPath.Child("includedKinds"))...)
+	allErrs = append(allErrs, validateKindList(r.Spec.ExcludedKinds, specPath.Child("excludedKinds"))...)
+
+	if r.Spec.LabelSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(r.Spec.LabelSelector); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("labelSelector"), r.Spec.LabelSelector,
+				err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
+func (r *ResourceBackupPolicy) validatePolicy(checkDestination bool) error {
+	var allErrs field.ErrorList
+
+	if err := validateScheduleFormat(r.Spec.Schedule, field.NewPath("spec").Child("schedule")); err != nil {
+		allErrs = append(allErrs, err)
+	}
+
+	allErrs = append(allErrs, r.validateSelection()...)
+	allErrs = append(allErrs, validatePodTemplate(r.Spec.PodTemplate, field.NewPath("spec").Child("podTemplate"))...)
+
+	if checkDestination {
+		if err := validateClusterDestination(r.Namespace, r.Spec.DestinationKind, r.Spec.Destination); err != nil {
+			allErrs = append(allErrs, err)
+		}
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: "kubedr.catalogicsoftware.com/v1alpha1", Kind: "ResourceBackupPolicy"},
+		r.Name, allErrs)
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ResourceBackupPolicy) ValidateCreate() error {
+	resourcebackuppolicylog.Info("validate create", "name", r.Name)
+
+	return r.validatePolicy(true)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ResourceBackupPolicy) ValidateUpdate(old runtime.Object) error {
+	resourcebackuppolicylog.Info("validate update", "name", r.Name)
+
+	checkDestination := true
+	if oldPolicy, ok := old.(*ResourceBackupPolicy); ok {
+		checkDestination = (oldPolicy.Spec.Destination != r.Spec.Destination) ||
+			(oldPolicy.Spec.DestinationKind != r.Spec.DestinationKind)
+	}
+
+	return r.validatePolicy(checkDestination)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ResourceBackupPolicy) ValidateDelete() error {
+	resourcebackuppolicylog.Info("validate delete", "name", r.Name)
+
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResourceBackupPolicyValidateCreate(t *testing.T) {
+	clusterLoc := testClusterBackupLocation("http://10.0.0.1:9000")
+
+	tests := []struct {
+		name    string
+		modify  func(*ResourceBackupPolicy)
+		wantErr string
+	}{
+		{"valid", func(*ResourceBackupPolicy) {}, ""},
+		{"bad schedule", func(policy *ResourceBackupPolicy) {
+			policy.Spec.Schedule = "daily"
+		}, "spec.schedule"},
+		{"bad namespace", func(policy *ResourceBackupPolicy) {
+			policy.Spec.ExcludedNamespaces = []string{"kube-system", "Team_B"}
+		}, "spec.excludedNamespaces[1]"},
+		{"missing kind", func(policy *ResourceBackupPolicy) {
+			policy.Spec.IncludedKinds = []GroupVersionKind{{Group: "apps", Version: "v1"}}
+		}, "spec.includedKinds[0].kind"},
+		{"bad core version", func(policy *ResourceBackupPolicy) {
+			policy.Spec.IncludedKinds = []GroupVersionKind{{Version: "v2", Kind: "ConfigMap"}}
+		}, "spec.includedKinds[0].version"},
+		{"bad selector", func(policy *ResourceBackupPolicy) {
+			policy.Spec.LabelSelector = &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Has"}},
+			}
+		}, "spec.labelSelector"},
+		{"cluster destination not allowed", func(policy *ResourceBackupPolicy) {
+			policy.Namespace = "team-b"
+		}, "not allowed"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setupValidation(BackupLocationValidationOptions{Timeout: 5 * time.Second}, validCreds,
+				clusterLoc)()
+
+			policy := &ResourceBackupPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "resources", Namespace: "team-a"},
+				Spec: ResourceBackupPolicySpec{
+					Destination:     "shared",
+					DestinationKind: KindClusterBackupLocation,
+					Schedule:        "*/30 * * * *",
+					IncludedKinds:   []GroupVersionKind{{Group: "apps", Kind: "Deployment"}},
+				},
+			}
+			tc.modify(policy)
+
+			err := policy.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// retentionRule keeps the latest backup of each of the last "count"
+// periods. Backups in the same period have the same key. If there is no
+// key, each backup is a period of its own.
+type retentionRule struct {
+	count int64
+	key   func(t time.Time) string
+}
+
+func (rp *RetentionPolicy) rules() []retentionRule {
+	return []retentionRule{
+		{rp.KeepLast, nil},
+		{rp.KeepHourly, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{rp.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{rp.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{rp.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{rp.KeepYearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+}
+
+// Retained returns, for each of the given creation times of backups,
+// whether the backup is kept by the policy. The times can be in any order.
+func (rp *RetentionPolicy) Retained(created []time.Time) []bool {
+	retained := make([]bool, len(created))
+	order := newestFirst(created)
+
+	for _, rule := range rp.rules() {
+		remaining := rule.count
+		lastKey := ""
+
+		for _, i := range order {
+			if remaining <= 0 {
+				break
+			}
+
+			key := ""
+			if rule.key != nil {
+				key = rule.key(created[i].UTC())
+				if key == lastKey {
+					continue
+				}
+			}
+
+			retained[i] = true
+			lastKey = key
+			remaining--
+		}
+	}
+
+	return retained
+}
+
+// RetainedWithin returns, for each of the given creation times of backups,
+// whether the backup was created within "within" of "now". The latest
+// "minimum" backups are kept regardless of their age.
+func RetainedWithin(created []time.Time, now time.Time, within time.Duration, minimum int64) []bool {
+	retained := make([]bool, len(created))
+
+	for n, i := range newestFirst(created) {
+		retained[i] = int64(n) < minimum || now.Sub(created[i]) < within
+	}
+
+	return retained
+}
+
+// newestFirst returns the indices of the given times, sorted newest first.
+func newestFirst(created []time.Time) []int {
+	order := make([]int, len(created))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return created[order[i]].After(created[order[j]])
+	})
+
+	return order
+}
+
+// validate checks that the counts are not negative and that at least one
+// backup is kept.
+func (rp *RetentionPolicy) validate(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	counts := []struct {
+		name  string
+		value int64
+	}{
+		{"keepLast", rp.KeepLast},
+		{"keepHourly", rp.KeepHourly},
+		{"keepDaily", rp.KeepDaily},
+		{"keepWeekly", rp.KeepWeekly},
+		{"keepMonthly", rp.KeepMonthly},
+		{"keepYearly", rp.KeepYearly},
+	}
+
+	total := int64(0)
+	for _, count := range counts {
+		if count.value < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(count.name), count.value,
+				"must not be negative"))
+		}
+		total += count.value
+	}
+
+	if len(allErrs) == 0 && total == 0 {
+		allErrs = append(allErrs, field.Required(fldPath, "at least one backup must be kept"))
+	}
+
+	return allErrs
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRetentionPolicyRetained(t *testing.T) {
+	base := time.Date(2020, time.March, 30, 22, 0, 0, 0, time.UTC)
+
+	// Oldest first: 28 Feb 22:00, 29 Mar 22:00, 30 Mar 21:00, 21:30, 22:00.
+	created := []time.Time{
+		base.AddDate(0, 0, -31),
+		base.AddDate(0, 0, -1),
+		base.Add(-time.Hour),
+		base.Add(-30 * time.Minute),
+		base,
+	}
+
+	tests := []struct {
+		name      string
+		retention RetentionPolicy
+		want      []bool
+	}{
+		{"last", RetentionPolicy{KeepLast: 2}, []bool{false, false, false, true, true}},
+		{"hourly", RetentionPolicy{KeepHourly: 2}, []bool{false, false, false, true, true}},
+		{"daily", RetentionPolicy{KeepDaily: 3}, []bool{true, true, false, false, true}},
+		{"monthly", RetentionPolicy{KeepMonthly: 12}, []bool{true, false, false, false, true}},
+		{"combined", RetentionPolicy{KeepLast: 1, KeepDaily: 2, KeepYearly: 1},
+			[]bool{false, true, false, false, true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.retention.Retained(created); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	// Order of the input doesn't matter.
+	reversed := []time.Time{created[4], created[3], created[2], created[1], created[0]}
+	retention := RetentionPolicy{KeepDaily: 3}
+	if got, want := retention.Retained(reversed), []bool{true, false, false, true, true}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestRetainedWithin(t *testing.T) {
+	now := time.Date(2020, time.March, 30, 22, 0, 0, 0, time.UTC)
+	created := []time.Time{now.Add(-72 * time.Hour), now.Add(-48 * time.Hour), now.Add(-time.Hour)}
+
+	tests := []struct {
+		name    string
+		within  time.Duration
+		minimum int64
+		want    []bool
+	}{
+		{"recent", 50 * time.Hour, 1, []bool{false, true, true}},
+		{"all old", 30 * time.Minute, 1, []bool{false, false, true}},
+		{"minimum", 30 * time.Minute, 2, []bool{false, true, true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := RetainedWithin(created, now, tc.within, tc.minimum); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMetadataBackupPolicyValidateRetention(t *testing.T) {
+	tests := []struct {
+		name         string
+		retention    *RetentionPolicy
+		retainWithin time.Duration
+		wantErr      string
+	}{
+		{"not set", nil, 0, ""},
+		{"valid", &RetentionPolicy{KeepDaily: 7, KeepMonthly: 12}, 0, ""},
+		{"negative", &RetentionPolicy{KeepDaily: 7, KeepWeekly: -1}, 0, "spec.retention.keepWeekly"},
+		{"empty", &RetentionPolicy{}, 0, "spec.retention"},
+		{"within", nil, 720 * time.Hour, ""},
+		{"negative within", nil, -time.Hour, "spec.retainWithin"},
+		{"within and retention", &RetentionPolicy{KeepDaily: 7}, 720 * time.Hour, "spec.retainWithin"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := testPolicy()
+			policy.Spec.Retention = tc.retention
+			if tc.retainWithin != 0 {
+				policy.Spec.RetainWithin = &metav1.Duration{Duration: tc.retainWithin}
+			}
+			policy.Default()
+
+			err := policy.ValidateCreate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
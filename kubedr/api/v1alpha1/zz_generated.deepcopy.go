@@ -21,16 +21,105 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupHistory) DeepCopyInto(out *BackupHistory) {
+	*out = *in
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]BackupRun, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastSuccessfulBackupTime != nil {
+		in, out := &in.LastSuccessfulBackupTime, &out.LastSuccessfulBackupTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupHistory.
+func (in *BackupHistory) DeepCopy() *BackupHistory {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupHistory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupHook) DeepCopyInto(out *BackupHook) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]v1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupHook.
+func (in *BackupHook) DeepCopy() *BackupHook {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupHooks) DeepCopyInto(out *BackupHooks) {
+	*out = *in
+	if in.Pre != nil {
+		in, out := &in.Pre, &out.Pre
+		*out = make([]BackupHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Post != nil {
+		in, out := &in.Post, &out.Post
+		*out = make([]BackupHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupHooks.
+func (in *BackupHooks) DeepCopy() *BackupHooks {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupHooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackupLocation) DeepCopyInto(out *BackupLocation) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupLocation.
@@ -86,6 +175,46 @@ func (in *BackupLocationList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackupLocationSpec) DeepCopyInto(out *BackupLocationSpec) {
 	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ObjectLock != nil {
+		in, out := &in.ObjectLock, &out.ObjectLock
+		*out = new(ObjectLock)
+		**out = **in
+	}
+	if in.Filesystem != nil {
+		in, out := &in.Filesystem, &out.Filesystem
+		*out = new(FilesystemTarget)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialKeys != nil {
+		in, out := &in.CredentialKeys, &out.CredentialKeys
+		*out = new(CredentialKeys)
+		**out = **in
+	}
+	if in.RepoPasswordSecret != nil {
+		in, out := &in.RepoPasswordSecret, &out.RepoPasswordSecret
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WebIdentity != nil {
+		in, out := &in.WebIdentity, &out.WebIdentity
+		*out = new(WebIdentity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UnlockStaleLocksAfter != nil {
+		in, out := &in.UnlockStaleLocksAfter, &out.UnlockStaleLocksAfter
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.PodTemplate != nil {
+		in, out := &in.PodTemplate, &out.PodTemplate
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupLocationSpec.
@@ -101,6 +230,36 @@ func (in *BackupLocationSpec) DeepCopy() *BackupLocationSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackupLocationStatus) DeepCopyInto(out *BackupLocationStatus) {
 	*out = *in
+	if in.LastInitTime != nil {
+		in, out := &in.LastInitTime, &out.LastInitTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastCheck != nil {
+		in, out := &in.LastCheck, &out.LastCheck
+		*out = new(RepoCheckResult)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Stats != nil {
+		in, out := &in.Stats, &out.Stats
+		*out = new(RepoStats)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RepoPassword != nil {
+		in, out := &in.RepoPassword, &out.RepoPassword
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PasswordRotationTime != nil {
+		in, out := &in.PasswordRotationTime, &out.PasswordRotationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupLocationStatus.
@@ -114,7 +273,56 @@ func (in *BackupLocationStatus) DeepCopy() *BackupLocationStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataBackupPolicy) DeepCopyInto(out *MetadataBackupPolicy) {
+func (in *BackupRun) DeepCopyInto(out *BackupRun) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	out.DurationSecs = in.DurationSecs.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupRun.
+func (in *BackupRun) DeepCopy() *BackupRun {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupRun)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CABundleSource) DeepCopyInto(out *CABundleSource) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CABundleSource.
+func (in *CABundleSource) DeepCopy() *CABundleSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CABundleSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterBackupLocation) DeepCopyInto(out *ClusterBackupLocation) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
@@ -122,18 +330,18 @@ func (in *MetadataBackupPolicy) DeepCopyInto(out *MetadataBackupPolicy) {
 	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupPolicy.
-func (in *MetadataBackupPolicy) DeepCopy() *MetadataBackupPolicy {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterBackupLocation.
+func (in *ClusterBackupLocation) DeepCopy() *ClusterBackupLocation {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataBackupPolicy)
+	out := new(ClusterBackupLocation)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *MetadataBackupPolicy) DeepCopyObject() runtime.Object {
+func (in *ClusterBackupLocation) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -141,31 +349,31 @@ func (in *MetadataBackupPolicy) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataBackupPolicyList) DeepCopyInto(out *MetadataBackupPolicyList) {
+func (in *ClusterBackupLocationList) DeepCopyInto(out *ClusterBackupLocationList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]MetadataBackupPolicy, len(*in))
+		*out = make([]ClusterBackupLocation, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupPolicyList.
-func (in *MetadataBackupPolicyList) DeepCopy() *MetadataBackupPolicyList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterBackupLocationList.
+func (in *ClusterBackupLocationList) DeepCopy() *ClusterBackupLocationList {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataBackupPolicyList)
+	out := new(ClusterBackupLocationList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *MetadataBackupPolicyList) DeepCopyObject() runtime.Object {
+func (in *ClusterBackupLocationList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -173,163 +381,136 @@ func (in *MetadataBackupPolicyList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataBackupPolicySpec) DeepCopyInto(out *MetadataBackupPolicySpec) {
+func (in *ClusterBackupLocationSpec) DeepCopyInto(out *ClusterBackupLocationSpec) {
 	*out = *in
-	if in.Options != nil {
-		in, out := &in.Options, &out.Options
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
-	if in.RetainNumBackups != nil {
-		in, out := &in.RetainNumBackups, &out.RetainNumBackups
-		*out = new(int64)
-		**out = **in
-	}
-	if in.Suspend != nil {
-		in, out := &in.Suspend, &out.Suspend
-		*out = new(bool)
-		**out = **in
+	in.BackupLocationSpec.DeepCopyInto(&out.BackupLocationSpec)
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupPolicySpec.
-func (in *MetadataBackupPolicySpec) DeepCopy() *MetadataBackupPolicySpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterBackupLocationSpec.
+func (in *ClusterBackupLocationSpec) DeepCopy() *ClusterBackupLocationSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataBackupPolicySpec)
+	out := new(ClusterBackupLocationSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataBackupPolicyStatus) DeepCopyInto(out *MetadataBackupPolicyStatus) {
+func (in *Condition) DeepCopyInto(out *Condition) {
 	*out = *in
-	out.TotalDurationSecs = in.TotalDurationSecs.DeepCopy()
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupPolicyStatus.
-func (in *MetadataBackupPolicyStatus) DeepCopy() *MetadataBackupPolicyStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataBackupPolicyStatus)
+	out := new(Condition)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataBackupRecord) DeepCopyInto(out *MetadataBackupRecord) {
+func (in *CredentialKeys) DeepCopyInto(out *CredentialKeys) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupRecord.
-func (in *MetadataBackupRecord) DeepCopy() *MetadataBackupRecord {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialKeys.
+func (in *CredentialKeys) DeepCopy() *CredentialKeys {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataBackupRecord)
+	out := new(CredentialKeys)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *MetadataBackupRecord) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataBackupRecordList) DeepCopyInto(out *MetadataBackupRecordList) {
+func (in *FilesystemTarget) DeepCopyInto(out *FilesystemTarget) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]MetadataBackupRecord, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.NFS != nil {
+		in, out := &in.NFS, &out.NFS
+		*out = new(v1.NFSVolumeSource)
+		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupRecordList.
-func (in *MetadataBackupRecordList) DeepCopy() *MetadataBackupRecordList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FilesystemTarget.
+func (in *FilesystemTarget) DeepCopy() *FilesystemTarget {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataBackupRecordList)
+	out := new(FilesystemTarget)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *MetadataBackupRecordList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataBackupRecordSpec) DeepCopyInto(out *MetadataBackupRecordSpec) {
+func (in *GroupVersionKind) DeepCopyInto(out *GroupVersionKind) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupRecordSpec.
-func (in *MetadataBackupRecordSpec) DeepCopy() *MetadataBackupRecordSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupVersionKind.
+func (in *GroupVersionKind) DeepCopy() *GroupVersionKind {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataBackupRecordSpec)
+	out := new(GroupVersionKind)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataBackupRecordStatus) DeepCopyInto(out *MetadataBackupRecordStatus) {
+func (in *HookResult) DeepCopyInto(out *HookResult) {
 	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupRecordStatus.
-func (in *MetadataBackupRecordStatus) DeepCopy() *MetadataBackupRecordStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HookResult.
+func (in *HookResult) DeepCopy() *HookResult {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataBackupRecordStatus)
+	out := new(HookResult)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataRestore) DeepCopyInto(out *MetadataRestore) {
+func (in *MetadataBackup) DeepCopyInto(out *MetadataBackup) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataRestore.
-func (in *MetadataRestore) DeepCopy() *MetadataRestore {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackup.
+func (in *MetadataBackup) DeepCopy() *MetadataBackup {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataRestore)
+	out := new(MetadataBackup)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *MetadataRestore) DeepCopyObject() runtime.Object {
+func (in *MetadataBackup) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -337,31 +518,31 @@ func (in *MetadataRestore) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataRestoreList) DeepCopyInto(out *MetadataRestoreList) {
+func (in *MetadataBackupList) DeepCopyInto(out *MetadataBackupList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]MetadataRestore, len(*in))
+		*out = make([]MetadataBackup, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataRestoreList.
-func (in *MetadataRestoreList) DeepCopy() *MetadataRestoreList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupList.
+func (in *MetadataBackupList) DeepCopy() *MetadataBackupList {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataRestoreList)
+	out := new(MetadataBackupList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *MetadataRestoreList) DeepCopyObject() runtime.Object {
+func (in *MetadataBackupList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -369,31 +550,750 @@ func (in *MetadataRestoreList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataRestoreSpec) DeepCopyInto(out *MetadataRestoreSpec) {
+func (in *MetadataBackupPolicy) DeepCopyInto(out *MetadataBackupPolicy) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataRestoreSpec.
-func (in *MetadataRestoreSpec) DeepCopy() *MetadataRestoreSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupPolicy.
+func (in *MetadataBackupPolicy) DeepCopy() *MetadataBackupPolicy {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataRestoreSpec)
+	out := new(MetadataBackupPolicy)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MetadataBackupPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetadataRestoreStatus) DeepCopyInto(out *MetadataRestoreStatus) {
+func (in *MetadataBackupPolicyList) DeepCopyInto(out *MetadataBackupPolicyList) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MetadataBackupPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataRestoreStatus.
-func (in *MetadataRestoreStatus) DeepCopy() *MetadataRestoreStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupPolicyList.
+func (in *MetadataBackupPolicyList) DeepCopy() *MetadataBackupPolicyList {
 	if in == nil {
 		return nil
 	}
-	out := new(MetadataRestoreStatus)
+	out := new(MetadataBackupPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MetadataBackupPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackupPolicySpec) DeepCopyInto(out *MetadataBackupPolicySpec) {
+	*out = *in
+	if in.Options != nil {
+		in, out := &in.Options, &out.Options
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.RetainNumBackups != nil {
+		in, out := &in.RetainNumBackups, &out.RetainNumBackups
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(RetentionPolicy)
+		**out = **in
+	}
+	if in.RetainWithin != nil {
+		in, out := &in.RetainWithin, &out.RetainWithin
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RetainMinBackups != nil {
+		in, out := &in.RetainMinBackups, &out.RetainMinBackups
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Suspend != nil {
+		in, out := &in.Suspend, &out.Suspend
+		*out = new(bool)
+		**out = **in
+	}
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.StartingDeadlineSeconds != nil {
+		in, out := &in.StartingDeadlineSeconds, &out.StartingDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.SuccessfulJobsHistoryLimit != nil {
+		in, out := &in.SuccessfulJobsHistoryLimit, &out.SuccessfulJobsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedJobsHistoryLimit != nil {
+		in, out := &in.FailedJobsHistoryLimit, &out.FailedJobsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = make([]ReplicaSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = new(BackupHooks)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Verify != nil {
+		in, out := &in.Verify, &out.Verify
+		*out = new(SnapshotVerification)
+		**out = **in
+	}
+	if in.PodTemplate != nil {
+		in, out := &in.PodTemplate, &out.PodTemplate
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupPolicySpec.
+func (in *MetadataBackupPolicySpec) DeepCopy() *MetadataBackupPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackupPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackupPolicyStatus) DeepCopyInto(out *MetadataBackupPolicyStatus) {
+	*out = *in
+	if in.LastBackupTime != nil {
+		in, out := &in.LastBackupTime, &out.LastBackupTime
+		*out = (*in).DeepCopy()
+	}
+	out.TotalDurationSecs = in.TotalDurationSecs.DeepCopy()
+	if in.Verification != nil {
+		in, out := &in.Verification, &out.Verification
+		*out = new(SnapshotVerificationResult)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HookResults != nil {
+		in, out := &in.HookResults, &out.HookResults
+		*out = make([]HookResult, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.BackupHistory.DeepCopyInto(&out.BackupHistory)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupPolicyStatus.
+func (in *MetadataBackupPolicyStatus) DeepCopy() *MetadataBackupPolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackupPolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackupRecord) DeepCopyInto(out *MetadataBackupRecord) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupRecord.
+func (in *MetadataBackupRecord) DeepCopy() *MetadataBackupRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackupRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MetadataBackupRecord) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackupRecordList) DeepCopyInto(out *MetadataBackupRecordList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MetadataBackupRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupRecordList.
+func (in *MetadataBackupRecordList) DeepCopy() *MetadataBackupRecordList {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackupRecordList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MetadataBackupRecordList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackupRecordSpec) DeepCopyInto(out *MetadataBackupRecordSpec) {
+	*out = *in
+	if in.Verification != nil {
+		in, out := &in.Verification, &out.Verification
+		*out = new(SnapshotVerificationResult)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LockedUntil != nil {
+		in, out := &in.LockedUntil, &out.LockedUntil
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupRecordSpec.
+func (in *MetadataBackupRecordSpec) DeepCopy() *MetadataBackupRecordSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackupRecordSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackupRecordStatus) DeepCopyInto(out *MetadataBackupRecordStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupRecordStatus.
+func (in *MetadataBackupRecordStatus) DeepCopy() *MetadataBackupRecordStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackupRecordStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackupSpec) DeepCopyInto(out *MetadataBackupSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupSpec.
+func (in *MetadataBackupSpec) DeepCopy() *MetadataBackupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataBackupStatus) DeepCopyInto(out *MetadataBackupStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataBackupStatus.
+func (in *MetadataBackupStatus) DeepCopy() *MetadataBackupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataBackupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataRestore) DeepCopyInto(out *MetadataRestore) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataRestore.
+func (in *MetadataRestore) DeepCopy() *MetadataRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MetadataRestore) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataRestoreList) DeepCopyInto(out *MetadataRestoreList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MetadataRestore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataRestoreList.
+func (in *MetadataRestoreList) DeepCopy() *MetadataRestoreList {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataRestoreList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MetadataRestoreList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataRestoreSpec) DeepCopyInto(out *MetadataRestoreSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataRestoreSpec.
+func (in *MetadataRestoreSpec) DeepCopy() *MetadataRestoreSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataRestoreSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataRestoreStatus) DeepCopyInto(out *MetadataRestoreStatus) {
+	*out = *in
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataRestoreStatus.
+func (in *MetadataRestoreStatus) DeepCopy() *MetadataRestoreStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataRestoreStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ObjectLock) DeepCopyInto(out *ObjectLock) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ObjectLock.
+func (in *ObjectLock) DeepCopy() *ObjectLock {
+	if in == nil {
+		return nil
+	}
+	out := new(ObjectLock)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicaSpec) DeepCopyInto(out *ReplicaSpec) {
+	*out = *in
+	if in.RetainNumBackups != nil {
+		in, out := &in.RetainNumBackups, &out.RetainNumBackups
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicaSpec.
+func (in *ReplicaSpec) DeepCopy() *ReplicaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RepoCheckResult) DeepCopyInto(out *RepoCheckResult) {
+	*out = *in
+	in.CheckTime.DeepCopyInto(&out.CheckTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RepoCheckResult.
+func (in *RepoCheckResult) DeepCopy() *RepoCheckResult {
+	if in == nil {
+		return nil
+	}
+	out := new(RepoCheckResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RepoStats) DeepCopyInto(out *RepoStats) {
+	*out = *in
+	in.StatsTime.DeepCopyInto(&out.StatsTime)
+	if in.OldestSnapshotTime != nil {
+		in, out := &in.OldestSnapshotTime, &out.OldestSnapshotTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NewestSnapshotTime != nil {
+		in, out := &in.NewestSnapshotTime, &out.NewestSnapshotTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RepoStats.
+func (in *RepoStats) DeepCopy() *RepoStats {
+	if in == nil {
+		return nil
+	}
+	out := new(RepoStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceBackupPolicy) DeepCopyInto(out *ResourceBackupPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceBackupPolicy.
+func (in *ResourceBackupPolicy) DeepCopy() *ResourceBackupPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceBackupPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ResourceBackupPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceBackupPolicyList) DeepCopyInto(out *ResourceBackupPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ResourceBackupPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceBackupPolicyList.
+func (in *ResourceBackupPolicyList) DeepCopy() *ResourceBackupPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceBackupPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ResourceBackupPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceBackupPolicySpec) DeepCopyInto(out *ResourceBackupPolicySpec) {
+	*out = *in
+	if in.IncludedNamespaces != nil {
+		in, out := &in.IncludedNamespaces, &out.IncludedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludedNamespaces != nil {
+		in, out := &in.ExcludedNamespaces, &out.ExcludedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LabelSelector != nil {
+		in, out := &in.LabelSelector, &out.LabelSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IncludedKinds != nil {
+		in, out := &in.IncludedKinds, &out.IncludedKinds
+		*out = make([]GroupVersionKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludedKinds != nil {
+		in, out := &in.ExcludedKinds, &out.ExcludedKinds
+		*out = make([]GroupVersionKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.RetainNumBackups != nil {
+		in, out := &in.RetainNumBackups, &out.RetainNumBackups
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Suspend != nil {
+		in, out := &in.Suspend, &out.Suspend
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PodTemplate != nil {
+		in, out := &in.PodTemplate, &out.PodTemplate
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceBackupPolicySpec.
+func (in *ResourceBackupPolicySpec) DeepCopy() *ResourceBackupPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceBackupPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceBackupPolicyStatus) DeepCopyInto(out *ResourceBackupPolicyStatus) {
+	*out = *in
+	if in.LastBackupTime != nil {
+		in, out := &in.LastBackupTime, &out.LastBackupTime
+		*out = (*in).DeepCopy()
+	}
+	out.TotalDurationSecs = in.TotalDurationSecs.DeepCopy()
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceBackupPolicyStatus.
+func (in *ResourceBackupPolicyStatus) DeepCopy() *ResourceBackupPolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceBackupPolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetentionPolicy) DeepCopyInto(out *RetentionPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetentionPolicy.
+func (in *RetentionPolicy) DeepCopy() *RetentionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetentionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotVerification) DeepCopyInto(out *SnapshotVerification) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotVerification.
+func (in *SnapshotVerification) DeepCopy() *SnapshotVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotVerificationResult) DeepCopyInto(out *SnapshotVerificationResult) {
+	*out = *in
+	if in.RestoredKeys != nil {
+		in, out := &in.RestoredKeys, &out.RestoredKeys
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotVerificationResult.
+func (in *SnapshotVerificationResult) DeepCopy() *SnapshotVerificationResult {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotVerificationResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSOptions) DeepCopyInto(out *TLSOptions) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = new(CABundleSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSOptions.
+func (in *TLSOptions) DeepCopy() *TLSOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(TLSOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebIdentity) DeepCopyInto(out *WebIdentity) {
+	*out = *in
+	if in.ExpirationSeconds != nil {
+		in, out := &in.ExpirationSeconds, &out.ExpirationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebIdentity.
+func (in *WebIdentity) DeepCopy() *WebIdentity {
+	if in == nil {
+		return nil
+	}
+	out := new(WebIdentity)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -0,0 +1,263 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
+)
+
+/*
+Integrity checks of a repo are run by a cronjob owned by the BackupLocation.
+
+- The cronjob exists only if "checkSchedule" is given. The hash of the spec
+  used to build it is stored in an annotation so that we can tell if it needs
+  to be rebuilt (for example, when the schedule or the target changes)
+  without comparing against defaults filled in by the API server.
+
+- The kubedrutil "check" command runs the engine's check and sets "lastCheck"
+  in the status of the BackupLocation.
+
+- Similar to the backup status of a policy, we turn the result into a
+  condition and metrics exactly once per check pod. An annotation records
+  the last check pod that was processed.
+*/
+
+const (
+	specHashAnnotation       = "spec-hash.annotations.kubedr.catalogicsoftware.com"
+	processedCheckAnnotation = "processed-check.annotations.kubedr.catalogicsoftware.com"
+)
+
+func (r *BackupLocationReconciler) processCheck(backupLoc *kubedrv1alpha1.BackupLocation,
+	log logr.Logger) (ctrl.Result, error) {
+
+	if result, err := r.reconcileCheckCronJob(backupLoc, log); err != nil {
+		return result, err
+	}
+
+	r.processCheckResult(backupLoc, log)
+
+	return ctrl.Result{}, nil
+}
+
+func (r *BackupLocationReconciler) reconcileCheckCronJob(backupLoc *kubedrv1alpha1.BackupLocation,
+	log logr.Logger) (ctrl.Result, error) {
+
+	cronJobName := backupLoc.Name + "-check-cronjob"
+	if backupLoc.Spec.CheckSchedule == "" {
+		return r.reconcileRepoCronJob(backupLoc, cronJobName, nil, log)
+	}
+
+	checkCronJob, err := buildCheckCronjob(backupLoc, cronJobName, log)
+	if err != nil {
+		log.Error(err, "Error in creating check cronjob")
+		return ctrl.Result{}, err
+	}
+
+	return r.reconcileRepoCronJob(backupLoc, cronJobName, checkCronJob, log)
+}
+
+// reconcileRepoCronJob creates, updates or deletes (if "desired" is nil) a
+// cronjob that runs against the repo of the BackupLocation. It is used for
+// both check and stats cronjobs.
+func (r *BackupLocationReconciler) reconcileRepoCronJob(backupLoc *kubedrv1alpha1.BackupLocation,
+	cronJobName string, desired *batchv1beta1.CronJob, log logr.Logger) (ctrl.Result, error) {
+
+	ctx := context.Background()
+
+	var cronJob batchv1beta1.CronJob
+	err := r.Get(ctx, types.NamespacedName{Namespace: backupLoc.Namespace, Name: cronJobName}, &cronJob)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	exists := (err == nil)
+
+	if desired == nil {
+		if exists {
+			log.Info("Schedule is removed, deleting cronjob", "name", cronJobName)
+			return ctrl.Result{}, ignoreNotFound(r.Delete(ctx, &cronJob))
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	if !exists {
+		if err := ctrl.SetControllerReference(backupLoc, desired, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		log.Info("Creating a new Cronjob", "Namespace", desired.Namespace, "Name", desired.Name)
+		return ctrl.Result{}, ignoreErrors(r.Create(ctx, desired))
+	}
+
+	if cronJob.ObjectMeta.Annotations[specHashAnnotation] == desired.ObjectMeta.Annotations[specHashAnnotation] {
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("Cronjob is out of date, updating it", "name", cronJobName)
+	if cronJob.ObjectMeta.Annotations == nil {
+		cronJob.ObjectMeta.Annotations = make(map[string]string)
+	}
+	cronJob.ObjectMeta.Annotations[specHashAnnotation] = desired.ObjectMeta.Annotations[specHashAnnotation]
+	cronJob.ObjectMeta.Labels = desired.ObjectMeta.Labels
+	setCronJobSpec(&cronJob, desired.Spec)
+
+	return ctrl.Result{}, r.Update(ctx, &cronJob)
+}
+
+// processCheckResult sets the "Healthy" condition and updates metrics
+// based on the result of the last check.
+func (r *BackupLocationReconciler) processCheckResult(backupLoc *kubedrv1alpha1.BackupLocation, log logr.Logger) {
+	result := backupLoc.Status.LastCheck
+	if result == nil || result.CheckPod == "" {
+		return
+	}
+
+	if backupLoc.ObjectMeta.Annotations[processedCheckAnnotation] == result.CheckPod {
+		return
+	}
+
+	log.Info("Processing the check result", "pod", result.CheckPod)
+
+	condition := kubedrv1alpha1.Condition{
+		Type:               kubedrv1alpha1.BackupLocationHealthy,
+		ObservedGeneration: backupLoc.ObjectMeta.Generation,
+	}
+
+	switch {
+	case result.CheckStatus != "Completed":
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "CheckFailed"
+		condition.Message = result.CheckErrorMessage
+
+		if engine.IsLockError(result.CheckErrorMessage) &&
+			setLockedCondition(backupLoc, result.CheckErrorMessage, result.CheckTime.Time) {
+			log.Info("Repo is locked")
+		}
+
+	case result.NumErrors > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ErrorsFound"
+		condition.Message = fmt.Sprintf("Check found %d errors", result.NumErrors)
+
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "CheckPassed"
+		condition.Message = "Check didn't find any errors"
+	}
+
+	r.MetricsInfo.RecordRepoCheck(backupLoc.Namespace, backupLoc.Name, result.CheckTime.Time,
+		result.NumErrors, condition.Status != metav1.ConditionTrue)
+
+	kubedrv1alpha1.SetCondition(&backupLoc.Status.Conditions, condition)
+	if err := r.Status().Update(context.Background(), backupLoc); err != nil {
+		log.Error(err, "unable to update backup location status")
+	}
+
+	if backupLoc.ObjectMeta.Annotations == nil {
+		backupLoc.ObjectMeta.Annotations = make(map[string]string)
+	}
+	backupLoc.ObjectMeta.Annotations[processedCheckAnnotation] = result.CheckPod
+
+	if err := r.Update(context.Background(), backupLoc); err != nil {
+		// There is no point in requeuing the request since we already updated
+		// the metrics.
+		log.Error(err, "Error in updating the check annotation, ignoring...")
+	}
+}
+
+func buildCheckCronjob(cr *kubedrv1alpha1.BackupLocation, cronJobName string,
+	log logr.Logger) (*batchv1beta1.CronJob, error) {
+
+	kubedrUtilImage := os.Getenv("KUBEDR_UTIL_IMAGE")
+	if kubedrUtilImage == "" {
+		// This should really not happen.
+		err := fmt.Errorf("KUBEDR_UTIL_IMAGE is not set")
+		log.Error(err, "")
+		return nil, err
+	}
+
+	driver, err := engine.New(cr, kubedrUtilImage)
+	if err != nil {
+		return nil, err
+	}
+
+	checkContainer := driver.CheckContainer(cr.Name+"-check", cr.Spec.CheckReadDataSubset)
+
+	return buildRepoCronJob(cr, cronJobName, cr.Spec.CheckSchedule, "backuploc-check",
+		checkContainer, driver.Volumes())
+}
+
+// buildRepoCronJob returns a cronjob that runs the given container (built
+// by the driver) as per "schedule".
+func buildRepoCronJob(cr *kubedrv1alpha1.BackupLocation, cronJobName string, schedule string,
+	podType string, container corev1.Container, volumes []corev1.Volume) (*batchv1beta1.CronJob, error) {
+
+	labels := map[string]string{
+		"kubedr.type":  podType,
+		backupLocLabel: cr.Name,
+	}
+
+	container.Env = append(container.Env, corev1.EnvVar{Name: "KDR_BACKUPLOC_NAME", Value: cr.Name})
+
+	spec := batchv1beta1.CronJobSpec{
+		ConcurrencyPolicy: "Forbid",
+		Schedule:          schedule,
+
+		JobTemplate: batchv1beta1.JobTemplateSpec{
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: labels,
+					},
+					Spec: corev1.PodSpec{
+						RestartPolicy: "Never",
+						Containers:    []corev1.Container{container},
+						Volumes:       volumes,
+					},
+				},
+			},
+		},
+	}
+
+	if err := kubedrv1alpha1.ApplyPodTemplate(&spec.JobTemplate.Spec.Template, cr.Spec.PodTemplate); err != nil {
+		return nil, err
+	}
+
+	return &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        cronJobName,
+			Namespace:   cr.Namespace,
+			Labels:      labels,
+			Annotations: map[string]string{specHashAnnotation: hashObject(spec)},
+		},
+		Spec: spec,
+	}, nil
+}
@@ -18,10 +18,14 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 
 	"github.com/go-logr/logr"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -32,18 +36,23 @@ import (
 	//	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
+	"kubedr/metrics"
 )
 
 // BackupLocationReconciler reconciles a BackupLocation object
 type BackupLocationReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log         logr.Logger
+	Scheme      *runtime.Scheme
+	MetricsInfo *metrics.MetricsInfo
 }
 
 // +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=backuplocations,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=backuplocations/status,verbs=get;update;patch
-// +kubebuilder:rbac:groups=core,resources=pods,verbs=create;get
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=create;get;list;watch;delete
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;get;list;watch;update
 
 /*
@@ -53,28 +62,124 @@ won't help.
 
 Top level Reconcile logic:
 
-- If generation number hasn't changed, do nothing. We don't want to process updates
-  unless spec has changed.
-
 - Add a finalizer if not already present. This will convert deletes to updates
   and allows us to perform any actions before the resource is actually deleted.
-  However, there is really no delete logic at present.
+  If the deletion policy is "Purge", all backups are deleted before the
+  finalizer is removed (see backuplocation_purge.go). The validation webhook
+  refuses to delete a location that is still in use.
+
+- Create, update or delete the cronjob that checks the integrity of the repo
+  and process the result of the last check. See backuplocation_check.go.
+
+- Similarly, manage the cronjob that collects usage statistics of the repo
+  and export them as metrics. See backuplocation_stats.go.
+
+- Compute a fingerprint of the target (end point, bucket, credentials etc).
+  If it matches the fingerprint recorded in status, the repo was already
+  initialized or verified for the current target and there is nothing more
+  to do. This replaces an earlier annotation set by "repoinit", which could
+  not detect changes to the target.
 
-- Check if the annotation, which indicates that repo is already initialized, is
-  present. If so, there is nothing more to do. If not, proceed with init logic.
+- The init pod carries the fingerprint of the target it was created for. If
+  such a pod exists for the current target, record the result once it
+  finishes. We watch the pods we own so we get called when that happens.
 
-- Since we don't generate a unique name for init pod, it is possible that pod
-  from a previous attempt still exists. So check for such a pod and delete it.
+- Otherwise, the target changed (or was never initialized). Since we don't
+  generate a unique name for init pod, delete any pod from a previous attempt.
   We may eventually use unique names but that requires clean up of old pods.
   Also note that the name of the pod includes BackupLocation resource name so it
   is not a hard-coded name really.
 
-- Create the pod that will initialize the repo. The kubedrutil "repoinit" command
-  will call restic to initialize the repo and it will then set the annotation to
-  indicate that repo is initialized. It will also set the status both in case of
-  success and failure.
+- Create the pod that will verify or initialize the repo. The kubedrutil
+  "repoinit" command will call the backup engine to open the repo and will
+  initialize it only if it doesn't exist. It will also set the status both
+  in case of success and failure.
+
+- Once the repo is verified, apply any change of the repo password. See
+  backuplocation_password.go.
+
+- Remove stale locks from the repo if it is reported to be locked. See
+  backuplocation_lock.go.
 */
 
+const targetFingerprintAnnotation = "target-fingerprint.annotations.kubedr.catalogicsoftware.com"
+
+// targetFingerprint returns a hash of the fields of the spec that identify
+// the repo and how it is accessed. Changing any of them requires the repo to
+// be verified (and initialized if needed) again.
+func targetFingerprint(backupLoc *kubedrv1alpha1.BackupLocation) string {
+	target := struct {
+		Url         string
+		BucketName  string
+		Filesystem  *kubedrv1alpha1.FilesystemTarget
+		Credentials string
+		Engine      string
+
+		// Fields added later are omitted if not set so that the
+		// fingerprints of existing locations don't change.
+		TLS            *kubedrv1alpha1.TLSOptions     `json:",omitempty"`
+		CredentialKeys *kubedrv1alpha1.CredentialKeys `json:",omitempty"`
+		WebIdentity    *kubedrv1alpha1.WebIdentity    `json:",omitempty"`
+		Prefix         string                         `json:",omitempty"`
+	}{
+		Url:         backupLoc.Spec.Url,
+		BucketName:  backupLoc.Spec.BucketName,
+		Filesystem:  backupLoc.Spec.Filesystem,
+		Credentials: backupLoc.Spec.Credentials,
+		Engine:      backupLoc.Spec.Engine,
+		TLS:         backupLoc.Spec.TLS,
+
+		WebIdentity: backupLoc.Spec.WebIdentity,
+	}
+
+	// Changes to the password don't change the target, they are applied
+	// to the repo by rotating the password.
+	if keys := backupLoc.Spec.CredentialKeys; keys != nil {
+		target.CredentialKeys = keys.DeepCopy()
+		target.CredentialKeys.RepoPassword = ""
+	}
+
+	if target.Engine == "" {
+		target.Engine = kubedrv1alpha1.EngineRestic
+	}
+
+	// The expanded prefix is used so that a change of the cluster name is
+	// also detected. If it can't be expanded, the init pod can't be built
+	// either and the error is reported then.
+	target.Prefix = backupLoc.Spec.Prefix
+	if prefix, err := engine.RepoPrefix(backupLoc); err == nil {
+		target.Prefix = prefix
+	}
+
+	return hashObject(target)
+}
+
+// hashObject returns a short hash of the JSON form of the given object.
+func hashObject(obj interface{}) string {
+	data, _ := json.Marshal(obj)
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// Returns a description of why the pod failed, if one is available.
+func podFailureMessage(pod *corev1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+			if t.Message != "" {
+				return t.Message
+			}
+			return fmt.Sprintf("Container %s exited with code %d (%s)", cs.Name, t.ExitCode, t.Reason)
+		}
+	}
+
+	if pod.Status.Message != "" {
+		return pod.Status.Message
+	}
+
+	return "Pod " + pod.Name + " failed"
+}
+
 func ignoreNotFound(err error) error {
 	if apierrors.IsNotFound(err) {
 		return nil
@@ -97,19 +202,27 @@ func ignoreErrors(err error) error {
 	return err
 }
 
+// Reasons of the conditions set for the result of initialization.
+var initReasons = map[string]string{
+	kubedrv1alpha1.ConditionReady:       "Initialized",
+	kubedrv1alpha1.ConditionProgressing: "Initializing",
+	kubedrv1alpha1.ConditionFailed:      "InitFailed",
+}
+
 func (r *BackupLocationReconciler) setStatus(backupLoc *kubedrv1alpha1.BackupLocation, status string, errmsg string) {
 	// Allows us to check and skip reconciles for only metadata updates.
 	backupLoc.Status.ObservedGeneration = backupLoc.ObjectMeta.Generation
 
 	backupLoc.Status.InitStatus = status
-	if errmsg == "" {
-		// For some reason, empty error string is causing problems even though
-		// the field is marked "optional" in Status struct.
-		errmsg = "."
-	}
 	backupLoc.Status.InitErrorMessage = errmsg
 
-	backupLoc.Status.InitTime = metav1.Now().String()
+	now := metav1.Now()
+	backupLoc.Status.InitTime = now.String()
+	backupLoc.Status.LastInitTime = &now
+
+	phase := kubedrv1alpha1.PhaseOf(status)
+	kubedrv1alpha1.SetPhase(&backupLoc.Status.Conditions, phase, backupLoc.ObjectMeta.Generation,
+		initReasons[phase], errmsg)
 
 	r.Log.Info("Updating status...")
 	if err := r.Status().Update(context.Background(), backupLoc); err != nil {
@@ -135,13 +248,6 @@ func (r *BackupLocationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, err
 		return ctrl.Result{}, err
 	}
 
-	// Skip if spec hasn't changed. This check prevents reconcile on status
-	// updates.
-	if backupLoc.Status.ObservedGeneration == backupLoc.ObjectMeta.Generation {
-		r.Log.Info("Skipping reconcile as generation number hasn't changed")
-		return ctrl.Result{}, nil
-	}
-
 	finalizer := "backuplocation.finalizers.kubedr.catalogicsoftware.com"
 
 	if backupLoc.ObjectMeta.DeletionTimestamp.IsZero() {
@@ -158,6 +264,13 @@ func (r *BackupLocationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, err
 		// The object is being deleted
 		if containsString(backupLoc.ObjectMeta.Finalizers, finalizer) {
 			// our finalizer is present, handle any pre-deletion logic here.
+			if backupLoc.Spec.DeletionPolicy == kubedrv1alpha1.DeletionPolicyPurge {
+				if purged, err := r.purge(&backupLoc, log); err != nil || !purged {
+					return ctrl.Result{}, err
+				}
+			}
+
+			r.MetricsInfo.DeleteRepoStats(backupLoc.Namespace, backupLoc.Name)
 
 			// remove our finalizer from the list and update it.
 			backupLoc.ObjectMeta.Finalizers = removeString(backupLoc.ObjectMeta.Finalizers, finalizer)
@@ -171,42 +284,55 @@ func (r *BackupLocationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, err
 		return ctrl.Result{}, nil
 	}
 
-	// Check annotations to see if repo is already initialized.
-	// Ideally, we should check the repo itself to confirm that it is
-	// initialized, instead of depending on annotation.
-	initAnnotation := "initialized.annotations.kubedr.catalogicsoftware.com"
+	if result, err := r.processCheck(&backupLoc, log); err != nil {
+		return result, err
+	}
 
-	initialized, exists := backupLoc.ObjectMeta.Annotations[initAnnotation]
-	if exists && (initialized == "true") {
-		// No need to initialize the repo.
-		log.Info("Repo is already initialized")
-		return ctrl.Result{}, nil
+	if result, err := r.processStats(&backupLoc, log); err != nil {
+		return result, err
 	}
 
-	// Annotation doesn't exist so we need to initialize the repo.
+	fingerprint := targetFingerprint(&backupLoc)
+	if backupLoc.Status.TargetFingerprint == fingerprint {
+		// Status updates also end up here so nothing is logged.
+		// Stale locks are looked at once rotation is no longer waiting.
+		if result, err := r.processPasswordRotation(&backupLoc, log); err != nil || result.RequeueAfter > 0 {
+			return result, err
+		}
+
+		return r.processStaleLock(&backupLoc, log)
+	}
 
 	initPodName := backupLoc.Name + "-init-pod"
 
-	// Since we don't generate a unique name for the pod that initializes the repo,
-	// we need to explicitly check and delete the pod if it exists. We may eventually
-	// use a unique name but that will also require cleanup of old pods.
 	var pod corev1.Pod
 	if err := r.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: initPodName}, &pod); err == nil {
-		log.Info("Found init pod, will delete it and continue...")
+		if pod.ObjectMeta.Annotations[targetFingerprintAnnotation] == fingerprint {
+			return r.processInitPod(&backupLoc, &pod, fingerprint)
+		}
+
+		// Since we don't generate a unique name for the pod that initializes the repo,
+		// we need to explicitly check and delete the pod if it exists. We may eventually
+		// use a unique name but that will also require cleanup of old pods.
+		log.Info("Found init pod for a different target, will delete it and continue...")
 		if err := r.Delete(ctx, &pod); ignoreNotFound(err) != nil {
 			log.Error(err, "Error in deleting init pod")
 			return ctrl.Result{}, err
 		}
+	} else if !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
 	}
 
+	log.Info("Target is not verified, will verify or initialize the repo", "fingerprint", fingerprint)
 	r.setStatus(&backupLoc, "Initializing", "")
 
 	// Initialize the repo.
-	initPod, err := buildResticRepoInitPod(&backupLoc, log)
+	initPod, err := buildRepoInitPod(&backupLoc, log)
 	if err != nil {
 		log.Error(err, "Error in creating init pod")
 		return ctrl.Result{}, err
 	}
+	initPod.ObjectMeta.Annotations = map[string]string{targetFingerprintAnnotation: fingerprint}
 
 	if err := ctrl.SetControllerReference(&backupLoc, initPod, r.Scheme); err != nil {
 		return ctrl.Result{}, err
@@ -223,7 +349,35 @@ func (r *BackupLocationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, err
 	return ctrl.Result{}, nil
 }
 
-func buildResticRepoInitPod(cr *kubedrv1alpha1.BackupLocation, log logr.Logger) (*corev1.Pod, error) {
+// processInitPod records the result of the init pod that was created for
+// the current target.
+func (r *BackupLocationReconciler) processInitPod(backupLoc *kubedrv1alpha1.BackupLocation,
+	pod *corev1.Pod, fingerprint string) (ctrl.Result, error) {
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		r.Log.Info("Repo is initialized and verified", "fingerprint", fingerprint)
+		backupLoc.Status.TargetFingerprint = fingerprint
+		r.setStatus(backupLoc, "Completed", "")
+
+	case corev1.PodFailed:
+		// kubedrutil may have set "initStatus" already, but not the
+		// conditions, so they decide whether the failure is recorded.
+		message := podFailureMessage(pod)
+		cond := kubedrv1alpha1.FindCondition(backupLoc.Status.Conditions, kubedrv1alpha1.ConditionFailed)
+		if cond == nil || cond.Status != metav1.ConditionTrue ||
+			cond.Reason != initReasons[kubedrv1alpha1.ConditionFailed] || cond.Message != message {
+			r.setStatus(backupLoc, "Failed", message)
+		}
+
+		// Nothing more is done for this target. Changing the spec (or
+		// deleting the init pod) results in another attempt.
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func buildRepoInitPod(cr *kubedrv1alpha1.BackupLocation, log logr.Logger) (*corev1.Pod, error) {
 	kubedrUtilImage := os.Getenv("KUBEDR_UTIL_IMAGE")
 	if kubedrUtilImage == "" {
 		// This should really not happen.
@@ -233,85 +387,44 @@ func buildResticRepoInitPod(cr *kubedrv1alpha1.BackupLocation, log logr.Logger)
 	}
 	log.V(1).Info(fmt.Sprintf("kubedrUtilImage: %s", kubedrUtilImage))
 
-	s3EndPoint := "s3:" + cr.Spec.Url + "/" + cr.Spec.BucketName
+	driver, err := engine.New(cr, kubedrUtilImage)
+	if err != nil {
+		return nil, err
+	}
 
 	labels := map[string]string{
 		"kubedr.type":      "backuploc-init",
 		"kubedr.backuploc": cr.Name,
 	}
 
-	accessKey := corev1.SecretKeySelector{}
-	accessKey.Name = cr.Spec.Credentials
-	accessKey.Key = "access_key"
+	initContainer := driver.InitContainer(cr.Name + "-init")
+	initContainer.Env = append(initContainer.Env, corev1.EnvVar{Name: "KDR_BACKUPLOC_NAME", Value: cr.Name})
 
-	secretKey := corev1.SecretKeySelector{}
-	secretKey.Name = cr.Spec.Credentials
-	secretKey.Key = "secret_key"
-
-	resticPassword := corev1.SecretKeySelector{}
-	resticPassword.Name = cr.Spec.Credentials
-	resticPassword.Key = "restic_repo_password"
-
-	return &corev1.Pod{
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cr.Name + "-init-pod",
 			Namespace: cr.Namespace,
 			Labels:    labels,
 		},
 		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{
-				{
-					Name:  cr.Name + "-init",
-					Image: kubedrUtilImage,
-					Args: []string{
-						"/usr/local/bin/kubedrutil", "repoinit",
-					},
-					Env: []corev1.EnvVar{
-						{
-							Name: "MY_POD_NAME",
-							ValueFrom: &corev1.EnvVarSource{
-								FieldRef: &corev1.ObjectFieldSelector{
-									FieldPath: "metadata.name",
-								},
-							},
-						},
-						{
-							Name: "AWS_ACCESS_KEY",
-							ValueFrom: &corev1.EnvVarSource{
-								SecretKeyRef: &accessKey,
-							},
-						},
-						{
-							Name: "AWS_SECRET_KEY",
-							ValueFrom: &corev1.EnvVarSource{
-								SecretKeyRef: &secretKey,
-							},
-						},
-						{
-							Name: "RESTIC_PASSWORD",
-							ValueFrom: &corev1.EnvVarSource{
-								SecretKeyRef: &resticPassword,
-							},
-						},
-						{
-							Name:  "RESTIC_REPO",
-							Value: s3EndPoint,
-						},
-						{
-							Name:  "KDR_BACKUPLOC_NAME",
-							Value: cr.Name,
-						},
-					},
-				},
-			},
+			Containers:    []corev1.Container{initContainer},
+			Volumes:       driver.Volumes(),
 			RestartPolicy: "Never",
 		},
-	}, nil
+	}
+
+	if err := kubedrv1alpha1.ApplyPodTemplateToPod(pod, cr.Spec.PodTemplate); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
 }
 
 // SetupWithManager hooks up this controller with the manager.
 func (r *BackupLocationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubedrv1alpha1.BackupLocation{}).
+		Owns(&corev1.Pod{}).
+		Owns(&batchv1beta1.CronJob{}).
 		Complete(r)
 }
@@ -0,0 +1,596 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
+)
+
+/*
+Engines such as restic lock the repo while operating on it. If a pod is
+killed, its lock stays behind and later operations fail until it is removed.
+
+- Failures seen by the controllers (backup status of a policy, result of a
+  check and snapshot deletion pods) are passed to reportLockError, which sets
+  the "RepoLocked" condition of the location if the repo is locked.
+
+- If "unlockStaleLocksAfter" is given and the condition has been true for
+  that long, a pod removes all the locks. Since that includes locks that are
+  in use, the pod is only created when no other pod is running against the
+  location. All such pods carry the location in "kubedr.backuploc" (or in
+  "kubedr.source-backuploc" if they only read from it). Pods that use a
+  ClusterBackupLocation run in other namespaces and carry its name in
+  "kubedr.cluster-backuploc" (or "kubedr.source-cluster-backuploc").
+
+- Before that check, the location is marked with an annotation naming the
+  operation (acquireRepo). Other controllers look for it (repoBusy) before
+  they create a pod or a job against the location and try again later if it
+  is there. Since they may not have seen it yet, the repo is only checked on
+  the next attempt and checked again once the unlock pod is created. Jobs
+  that are yet to finish count as in use as they may still create pods.
+
+- So that scheduled jobs don't start between that check and the end of the
+  unlock, all the cronjobs that run against the location (backup, check and
+  stats), which carry the same labels, are suspended as well. Their previous
+  "suspend" is kept in an annotation and restored, along with the removal of
+  the annotation of the location, once the unlock pod is done or when it is
+  no longer needed (releaseRepo). Controllers that update these cronjobs use
+  setCronJobSpec to keep them suspended meanwhile.
+
+- Once the pod succeeds, the condition is set to false. If the pod fails,
+  deleting it results in another attempt.
+*/
+
+const (
+	backupLocLabel       = "kubedr.backuploc"
+	sourceBackupLocLabel = "kubedr.source-backuploc"
+
+	// How often we check if the pods using a location are done, so that
+	// an exclusive operation can start, and if such an operation is over,
+	// so that other pods can start.
+	repoBusyRetryInterval = time.Minute
+
+	// Set on a BackupLocation while an operation that needs exclusive
+	// access to its repo is in progress. The value names the operation.
+	exclusiveOperationAnnotation = "exclusive-operation.annotations.kubedr.catalogicsoftware.com"
+
+	// Set on the cronjobs that are suspended during such an operation. The
+	// value is their "suspend" before that.
+	suspendedAnnotation = "suspended.annotations.kubedr.catalogicsoftware.com"
+
+	operationUnlock = "unlock"
+)
+
+// setLockedCondition marks the repo as locked. It returns false if the
+// repo was already known to be locked or if the failure happened before the
+// condition last changed (that is, before the repo was last unlocked).
+func setLockedCondition(backupLoc *kubedrv1alpha1.BackupLocation, message string, failedAt time.Time) bool {
+	cond := kubedrv1alpha1.FindCondition(backupLoc.Status.Conditions, kubedrv1alpha1.BackupLocationRepoLocked)
+	if cond != nil {
+		if cond.Status == metav1.ConditionTrue || failedAt.Before(cond.LastTransitionTime.Time) {
+			return false
+		}
+	}
+
+	kubedrv1alpha1.SetCondition(&backupLoc.Status.Conditions, kubedrv1alpha1.Condition{
+		Type:               kubedrv1alpha1.BackupLocationRepoLocked,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: backupLoc.ObjectMeta.Generation,
+		Reason:             "LockFound",
+		Message:            message,
+	})
+
+	return true
+}
+
+// reportLockError sets the "RepoLocked" condition of the given location if
+// "message" says that the repo is locked. "failedAt" is the time of the
+// failure. For a ClusterBackupLocation, the condition is set on its
+// BackupLocation.
+func reportLockError(c client.Client, namespace string, kind string, backupLocName string, message string,
+	failedAt time.Time, log logr.Logger) {
+
+	if !engine.IsLockError(message) {
+		return
+	}
+
+	ctx := context.Background()
+
+	backupLocKey, err := repoBackupLocationKey(c, namespace, kind, backupLocName)
+	if err != nil {
+		log.Error(err, "unable to fetch ClusterBackupLocation", "backuploc", backupLocName)
+		return
+	}
+
+	var backupLoc kubedrv1alpha1.BackupLocation
+	if err := c.Get(ctx, backupLocKey, &backupLoc); err != nil {
+		log.Error(err, "unable to fetch BackupLocation", "backuploc", backupLocName)
+		return
+	}
+
+	if !setLockedCondition(&backupLoc, message, failedAt) {
+		return
+	}
+
+	log.Info("Repo is locked", "backuploc", backupLocName)
+	if err := c.Status().Update(ctx, &backupLoc); err != nil {
+		log.Error(err, "unable to update backup location status", "backuploc", backupLocName)
+	}
+}
+
+// podFinishTime returns the time at which the pod finished, as seen by its
+// containers.
+func podFinishTime(pod *corev1.Pod) time.Time {
+	var finishedAt time.Time
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; t != nil && t.FinishedAt.Time.After(finishedAt) {
+			finishedAt = t.FinishedAt.Time
+		}
+	}
+
+	return finishedAt
+}
+
+func (r *BackupLocationReconciler) setUnlockedCondition(backupLoc *kubedrv1alpha1.BackupLocation,
+	status metav1.ConditionStatus, reason string, message string) {
+
+	kubedrv1alpha1.SetCondition(&backupLoc.Status.Conditions, kubedrv1alpha1.Condition{
+		Type:               kubedrv1alpha1.BackupLocationRepoLocked,
+		Status:             status,
+		ObservedGeneration: backupLoc.ObjectMeta.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+
+	if err := r.Status().Update(context.Background(), backupLoc); err != nil {
+		r.Log.Error(err, "unable to update backup location status")
+	}
+}
+
+// locationSelectors returns the options to list the objects (pods and
+// cronjobs) that run against the given location.
+func locationSelectors(backupLoc *kubedrv1alpha1.BackupLocation) [][]client.ListOption {
+	var selectors [][]client.ListOption
+	for _, label := range []string{backupLocLabel, sourceBackupLocLabel} {
+		selectors = append(selectors, []client.ListOption{client.InNamespace(backupLoc.Namespace),
+			client.MatchingLabels{label: backupLoc.Name}})
+	}
+
+	// Pods of a ClusterBackupLocation can be in any namespace.
+	if clusterLocName, ok := backupLoc.ObjectMeta.Labels[kubedrv1alpha1.ClusterBackupLocationLabel]; ok {
+		for _, label := range []string{clusterBackupLocLabel, sourceClusterBackupLocLabel} {
+			selectors = append(selectors, []client.ListOption{client.MatchingLabels{label: clusterLocName}})
+		}
+	}
+
+	return selectors
+}
+
+// repoInUse returns true if any pod, other than "ownPod" in the namespace of
+// the location, is running against the given location or if any job against
+// it is yet to finish.
+func (r *BackupLocationReconciler) repoInUse(backupLoc *kubedrv1alpha1.BackupLocation,
+	ownPod string) (bool, error) {
+
+	for _, opts := range locationSelectors(backupLoc) {
+		var podList corev1.PodList
+		if err := r.List(context.Background(), &podList, opts...); err != nil {
+			return false, err
+		}
+
+		for _, pod := range podList.Items {
+			if pod.Name == ownPod && pod.Namespace == backupLoc.Namespace {
+				continue
+			}
+
+			if pod.Status.Phase == corev1.PodPending || pod.Status.Phase == corev1.PodRunning {
+				return true, nil
+			}
+		}
+
+		// A job may not have created its pod yet, or may create another
+		// one after a failure.
+		var jobList batchv1.JobList
+		if err := r.List(context.Background(), &jobList, opts...); err != nil {
+			return false, err
+		}
+
+		for i := range jobList.Items {
+			if !jobFinished(&jobList.Items[i]) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// jobFinished returns true if the given job has completed or failed.
+func jobFinished(job *batchv1.Job) bool {
+	for _, cond := range job.Status.Conditions {
+		if (cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed) &&
+			cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// acquireRepo starts an operation that needs exclusive access to the repo
+// of the given location. It returns true once no other pod, other than
+// "ownPod" of the operation, is using the repo. Otherwise, or if another
+// operation is in progress, the caller tries again later.
+func (r *BackupLocationReconciler) acquireRepo(backupLoc *kubedrv1alpha1.BackupLocation, operation string,
+	ownPod string, log logr.Logger) (bool, error) {
+
+	current := backupLoc.ObjectMeta.Annotations[exclusiveOperationAnnotation]
+	if current != "" && current != operation {
+		log.Info("Waiting for another operation on the repo", "operation", current)
+		return false, nil
+	}
+
+	if current == "" {
+		if backupLoc.ObjectMeta.Annotations == nil {
+			backupLoc.ObjectMeta.Annotations = make(map[string]string)
+		}
+		backupLoc.ObjectMeta.Annotations[exclusiveOperationAnnotation] = operation
+
+		log.Info("Marking the repo as busy", "operation", operation)
+		if err := r.Update(context.Background(), backupLoc); err != nil {
+			return false, err
+		}
+	}
+
+	active, err := r.suspendCronJobs(backupLoc, log)
+	if err != nil {
+		return false, err
+	}
+
+	// Other controllers may not have seen the annotation yet.
+	if current == "" {
+		return false, nil
+	}
+
+	inUse, err := r.repoInUse(backupLoc, ownPod)
+	if err != nil {
+		return false, err
+	}
+
+	if active || inUse {
+		log.Info("Repo is in use, will try later", "operation", operation)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// releaseRepo ends the given operation, if it is in progress.
+func (r *BackupLocationReconciler) releaseRepo(backupLoc *kubedrv1alpha1.BackupLocation, operation string,
+	log logr.Logger) error {
+
+	if backupLoc.ObjectMeta.Annotations[exclusiveOperationAnnotation] != operation {
+		return nil
+	}
+
+	if err := r.resumeCronJobs(backupLoc, log); err != nil {
+		return err
+	}
+
+	log.Info("Marking the repo as no longer busy", "operation", operation)
+	delete(backupLoc.ObjectMeta.Annotations, exclusiveOperationAnnotation)
+
+	return r.Update(context.Background(), backupLoc)
+}
+
+// repoBusy returns the exclusive operation, if any, that is in progress on
+// a repo used by a pod (or a job) with the given labels. Such a pod must not
+// be created until the operation is over.
+func repoBusy(c client.Client, namespace string, labels map[string]string) (string, error) {
+	kinds := map[string]string{
+		backupLocLabel:              kubedrv1alpha1.KindBackupLocation,
+		sourceBackupLocLabel:        kubedrv1alpha1.KindBackupLocation,
+		clusterBackupLocLabel:       kubedrv1alpha1.KindClusterBackupLocation,
+		sourceClusterBackupLocLabel: kubedrv1alpha1.KindClusterBackupLocation,
+	}
+
+	for label, kind := range kinds {
+		name := labels[label]
+		if name == "" {
+			continue
+		}
+
+		// If the location doesn't exist, the pod fails anyway.
+		key, err := repoBackupLocationKey(c, namespace, kind, name)
+		if err != nil {
+			return "", ignoreNotFound(err)
+		}
+
+		var backupLoc kubedrv1alpha1.BackupLocation
+		if err := c.Get(context.Background(), key, &backupLoc); err != nil {
+			return "", ignoreNotFound(err)
+		}
+
+		if operation := backupLoc.ObjectMeta.Annotations[exclusiveOperationAnnotation]; operation != "" {
+			return operation, nil
+		}
+	}
+
+	return "", nil
+}
+
+// locationCronJobs returns the cronjobs that run against the given location.
+func (r *BackupLocationReconciler) locationCronJobs(backupLoc *kubedrv1alpha1.BackupLocation) (
+	[]batchv1beta1.CronJob, error) {
+
+	var cronJobs []batchv1beta1.CronJob
+	for _, opts := range locationSelectors(backupLoc) {
+		var cronJobList batchv1beta1.CronJobList
+		if err := r.List(context.Background(), &cronJobList, opts...); err != nil {
+			return nil, err
+		}
+
+		cronJobs = append(cronJobs, cronJobList.Items...)
+	}
+
+	return cronJobs, nil
+}
+
+// suspendCronJobs suspends the cronjobs that run against the given location
+// so that they don't start any jobs during an exclusive operation. It returns
+// true if any of them still has active jobs.
+func (r *BackupLocationReconciler) suspendCronJobs(backupLoc *kubedrv1alpha1.BackupLocation,
+	log logr.Logger) (bool, error) {
+
+	cronJobs, err := r.locationCronJobs(backupLoc)
+	if err != nil {
+		return false, err
+	}
+
+	active := false
+	for i := range cronJobs {
+		cronJob := &cronJobs[i]
+		if len(cronJob.Status.Active) > 0 {
+			active = true
+		}
+
+		if _, ok := cronJob.ObjectMeta.Annotations[suspendedAnnotation]; ok {
+			continue
+		}
+
+		if cronJob.ObjectMeta.Annotations == nil {
+			cronJob.ObjectMeta.Annotations = make(map[string]string)
+		}
+		cronJob.ObjectMeta.Annotations[suspendedAnnotation] =
+			strconv.FormatBool(cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend)
+
+		suspend := true
+		cronJob.Spec.Suspend = &suspend
+
+		log.Info("Suspending cronjob until the repo is no longer busy", "cronjob", cronJob.Name,
+			"namespace", cronJob.Namespace)
+		if err := r.Update(context.Background(), cronJob); err != nil {
+			return false, err
+		}
+	}
+
+	return active, nil
+}
+
+// resumeCronJobs undoes suspendCronJobs.
+func (r *BackupLocationReconciler) resumeCronJobs(backupLoc *kubedrv1alpha1.BackupLocation,
+	log logr.Logger) error {
+
+	cronJobs, err := r.locationCronJobs(backupLoc)
+	if err != nil {
+		return err
+	}
+
+	for i := range cronJobs {
+		cronJob := &cronJobs[i]
+		value, ok := cronJob.ObjectMeta.Annotations[suspendedAnnotation]
+		if !ok {
+			continue
+		}
+
+		delete(cronJob.ObjectMeta.Annotations, suspendedAnnotation)
+		suspend := value == "true"
+		cronJob.Spec.Suspend = &suspend
+
+		log.Info("Resuming cronjob", "cronjob", cronJob.Name, "namespace", cronJob.Namespace)
+		if err := r.Update(context.Background(), cronJob); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setCronJobSpec replaces the spec of an existing cronjob. If the cronjob is
+// suspended during an exclusive operation, it stays so and the new "suspend"
+// is applied when it is resumed.
+func setCronJobSpec(cronJob *batchv1beta1.CronJob, spec batchv1beta1.CronJobSpec) {
+	cronJob.Spec = spec
+
+	if _, ok := cronJob.ObjectMeta.Annotations[suspendedAnnotation]; ok {
+		cronJob.ObjectMeta.Annotations[suspendedAnnotation] =
+			strconv.FormatBool(spec.Suspend != nil && *spec.Suspend)
+
+		suspend := true
+		cronJob.Spec.Suspend = &suspend
+	}
+}
+
+// processStaleLock is called only after the repo is verified for the
+// current target.
+func (r *BackupLocationReconciler) processStaleLock(backupLoc *kubedrv1alpha1.BackupLocation,
+	log logr.Logger) (ctrl.Result, error) {
+
+	ctx := context.Background()
+
+	cond := kubedrv1alpha1.FindCondition(backupLoc.Status.Conditions, kubedrv1alpha1.BackupLocationRepoLocked)
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		return ctrl.Result{}, r.releaseRepo(backupLoc, operationUnlock, log)
+	}
+
+	driver, err := engine.New(backupLoc, os.Getenv("KUBEDR_UTIL_IMAGE"))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	unlocker, ok := driver.(engine.Unlocker)
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+
+	podName := backupLoc.Name + "-unlock-pod"
+
+	var pod corev1.Pod
+	if err := r.Get(ctx, types.NamespacedName{Namespace: backupLoc.Namespace, Name: podName}, &pod); err == nil {
+		if !pod.ObjectMeta.CreationTimestamp.Before(&cond.LastTransitionTime) {
+			return r.processUnlockPod(backupLoc, &pod, log)
+		}
+
+		// We get called again once the pod is gone.
+		log.Info("Found unlock pod from an earlier lock, deleting it")
+		return ctrl.Result{}, ignoreNotFound(r.Delete(ctx, &pod))
+	} else if !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	if backupLoc.Spec.UnlockStaleLocksAfter == nil {
+		return ctrl.Result{}, r.releaseRepo(backupLoc, operationUnlock, log)
+	}
+
+	lockedFor := time.Since(cond.LastTransitionTime.Time)
+	if wait := backupLoc.Spec.UnlockStaleLocksAfter.Duration - lockedFor; wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	if acquired, err := r.acquireRepo(backupLoc, operationUnlock, podName, log); err != nil || !acquired {
+		return ctrl.Result{RequeueAfter: repoBusyRetryInterval}, err
+	}
+
+	log.Info("Removing stale locks", "lockedFor", lockedFor.String())
+
+	unlockPod, err := buildUnlockPod(backupLoc, unlocker, driver, podName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := ctrl.SetControllerReference(backupLoc, unlockPod, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Starting a new Pod", "Pod.Namespace", unlockPod.Namespace, "Pod.Name", unlockPod.Name)
+	if err := r.Create(ctx, unlockPod); err != nil {
+		log.Error(err, "Error in starting unlock pod")
+		return ctrl.Result{}, ignoreErrors(err)
+	}
+
+	return r.checkPodAlone(backupLoc, unlockPod, log)
+}
+
+// checkPodAlone deletes the pod of an exclusive operation, if it has not
+// started yet, in case another pod started using the repo before its
+// controller saw that the repo is busy.
+func (r *BackupLocationReconciler) checkPodAlone(backupLoc *kubedrv1alpha1.BackupLocation,
+	pod *corev1.Pod, log logr.Logger) (ctrl.Result, error) {
+
+	inUse, err := r.repoInUse(backupLoc, pod.Name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !inUse {
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("Repo is in use, deleting the pod and will try later", "pod", pod.Name)
+	return ctrl.Result{RequeueAfter: repoBusyRetryInterval}, ignoreNotFound(r.Delete(context.Background(), pod))
+}
+
+func (r *BackupLocationReconciler) processUnlockPod(backupLoc *kubedrv1alpha1.BackupLocation,
+	pod *corev1.Pod, log logr.Logger) (ctrl.Result, error) {
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		log.Info("Stale locks are removed")
+		r.setUnlockedCondition(backupLoc, metav1.ConditionFalse, "Unlocked", "Stale locks are removed")
+
+	case corev1.PodFailed:
+		cond := kubedrv1alpha1.FindCondition(backupLoc.Status.Conditions, kubedrv1alpha1.BackupLocationRepoLocked)
+		if cond == nil || cond.Reason != "UnlockFailed" {
+			r.setUnlockedCondition(backupLoc, metav1.ConditionTrue, "UnlockFailed", podFailureMessage(pod))
+		}
+
+	case corev1.PodPending:
+		return r.checkPodAlone(backupLoc, pod, log)
+
+	default:
+		return ctrl.Result{}, nil
+	}
+
+	// Backups go on even if unlocking failed, they report the lock.
+	return ctrl.Result{}, r.releaseRepo(backupLoc, operationUnlock, log)
+}
+
+// Unlocking doesn't need kubedrutil so its image is not checked here.
+func buildUnlockPod(cr *kubedrv1alpha1.BackupLocation, unlocker engine.Unlocker, driver engine.Driver,
+	podName string) (*corev1.Pod, error) {
+
+	labels := map[string]string{
+		"kubedr.type":  "backuploc-unlock",
+		backupLocLabel: cr.Name,
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: cr.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{
+			Containers:    []corev1.Container{unlocker.UnlockContainer(cr.Name + "-unlock")},
+			Volumes:       driver.Volumes(),
+			RestartPolicy: "Never",
+		},
+	}
+
+	if err := kubedrv1alpha1.ApplyPodTemplateToPod(pod, cr.Spec.PodTemplate); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
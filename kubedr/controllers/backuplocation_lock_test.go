@@ -0,0 +1,289 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/metrics"
+)
+
+func newTestBackupLocationReconciler() *BackupLocationReconciler {
+	return &BackupLocationReconciler{
+		Client:      k8sClient,
+		Log:         ctrl.Log.WithName("test").WithName("BackupLocation"),
+		Scheme:      scheme.Scheme,
+		MetricsInfo: metrics.NewMetricsInfo(),
+	}
+}
+
+// createTestBackupLocation creates a restic location in the "default"
+// namespace.
+func createTestBackupLocation(name string, spec kubedrv1alpha1.BackupLocationSpec) *kubedrv1alpha1.BackupLocation {
+	spec.Url = "http://10.0.0.1:9000"
+	spec.BucketName = "testbucket"
+	spec.Credentials = "minio-creds"
+
+	backupLoc := &kubedrv1alpha1.BackupLocation{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       spec,
+	}
+	Expect(k8sClient.Create(context.Background(), backupLoc)).To(Succeed())
+
+	return backupLoc
+}
+
+// createTestPod creates a pod with the given labels and sets its phase.
+func createTestPod(name string, labels map[string]string, phase corev1.PodPhase) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		Spec: corev1.PodSpec{
+			Containers:    []corev1.Container{{Name: "test", Image: "busybox"}},
+			RestartPolicy: corev1.RestartPolicyNever,
+		},
+	}
+	Expect(k8sClient.Create(context.Background(), pod)).To(Succeed())
+	setTestPodPhase(pod, phase)
+
+	return pod
+}
+
+func setTestPodPhase(pod *corev1.Pod, phase corev1.PodPhase) {
+	pod.Status.Phase = phase
+	Expect(k8sClient.Status().Update(context.Background(), pod)).To(Succeed())
+}
+
+// getTestObject reads the given object, which must exist. Pass a new
+// object as decoding into an existing one keeps map entries that are gone.
+func getTestObject(name string, obj runtime.Object) {
+	Expect(k8sClient.Get(context.Background(),
+		types.NamespacedName{Namespace: "default", Name: name}, obj)).To(Succeed())
+}
+
+func testPodExists(name string) bool {
+	var pod corev1.Pod
+	err := k8sClient.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, &pod)
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	Expect(err).NotTo(HaveOccurred())
+
+	return true
+}
+
+var _ = Describe("Stale lock removal", func() {
+	const name = "lockloc"
+
+	var (
+		r         *BackupLocationReconciler
+		backupLoc *kubedrv1alpha1.BackupLocation
+		backupPod *corev1.Pod
+	)
+
+	refresh := func() {
+		backupLoc = &kubedrv1alpha1.BackupLocation{}
+		getTestObject(name, backupLoc)
+	}
+
+	// processStaleLock is called with the latest version of the location,
+	// as it is by Reconcile.
+	processStaleLock := func() ctrl.Result {
+		refresh()
+		result, err := r.processStaleLock(backupLoc, r.Log)
+		Expect(err).NotTo(HaveOccurred())
+
+		refresh()
+		return result
+	}
+
+	getCronJob := func() *batchv1beta1.CronJob {
+		cronJob := &batchv1beta1.CronJob{}
+		getTestObject(name+"-backup-cronjob", cronJob)
+		return cronJob
+	}
+
+	lockedCondition := func() *kubedrv1alpha1.Condition {
+		return kubedrv1alpha1.FindCondition(backupLoc.Status.Conditions, kubedrv1alpha1.BackupLocationRepoLocked)
+	}
+
+	BeforeEach(func() {
+		r = newTestBackupLocationReconciler()
+
+		backupLoc = createTestBackupLocation(name, kubedrv1alpha1.BackupLocationSpec{
+			UnlockStaleLocksAfter: &metav1.Duration{Duration: time.Hour},
+		})
+
+		backupLoc.Status.Conditions = []kubedrv1alpha1.Condition{{
+			Type:               kubedrv1alpha1.BackupLocationRepoLocked,
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+			Reason:             "LockFound",
+		}}
+		Expect(k8sClient.Status().Update(context.Background(), backupLoc)).To(Succeed())
+
+		labels := map[string]string{"kubedr.type": "backup", backupLocLabel: name}
+
+		suspend := false
+		cronJob := &batchv1beta1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-backup-cronjob", Namespace: "default", Labels: labels},
+			Spec: batchv1beta1.CronJobSpec{
+				Schedule: "*/10 * * * *",
+				Suspend:  &suspend,
+				JobTemplate: batchv1beta1.JobTemplateSpec{
+					Spec: batchv1.JobSpec{
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{
+								Containers:    []corev1.Container{{Name: "test", Image: "busybox"}},
+								RestartPolicy: corev1.RestartPolicyNever,
+							},
+						},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(context.Background(), cronJob)).To(Succeed())
+
+		backupPod = createTestPod(name+"-backup-pod", labels, corev1.PodRunning)
+	})
+
+	AfterEach(func() {
+		ctx := context.Background()
+
+		for _, podName := range []string{backupPod.Name, name + "-unlock-pod"} {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: podName, Namespace: "default"}}
+			Expect(ignoreNotFound(k8sClient.Delete(ctx, pod))).To(Succeed())
+		}
+
+		cronJob := &batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: name + "-backup-cronjob",
+			Namespace: "default"}}
+		Expect(k8sClient.Delete(ctx, cronJob)).To(Succeed())
+
+		Expect(k8sClient.Delete(ctx, backupLoc)).To(Succeed())
+	})
+
+	It("waits for other pods and then unlocks the repo", func() {
+		unlockPodName := name + "-unlock-pod"
+
+		By("marking the repo as busy and suspending the cronjobs")
+		result := processStaleLock()
+		Expect(result.RequeueAfter).To(Equal(repoBusyRetryInterval))
+		Expect(backupLoc.ObjectMeta.Annotations[exclusiveOperationAnnotation]).To(Equal(operationUnlock))
+		Expect(testPodExists(unlockPodName)).To(BeFalse())
+
+		cronJob := getCronJob()
+		Expect(*cronJob.Spec.Suspend).To(BeTrue())
+		Expect(cronJob.ObjectMeta.Annotations[suspendedAnnotation]).To(Equal("false"))
+
+		operation, err := repoBusy(k8sClient, "default", backupPod.ObjectMeta.Labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operation).To(Equal(operationUnlock))
+
+		By("waiting while the backup pod is running")
+		result = processStaleLock()
+		Expect(result.RequeueAfter).To(Equal(repoBusyRetryInterval))
+		Expect(testPodExists(unlockPodName)).To(BeFalse())
+
+		By("starting the unlock pod once the backup pod is done")
+		setTestPodPhase(backupPod, corev1.PodSucceeded)
+		processStaleLock()
+		Expect(testPodExists(unlockPodName)).To(BeTrue())
+		Expect(backupLoc.ObjectMeta.Annotations[exclusiveOperationAnnotation]).To(Equal(operationUnlock))
+
+		By("marking the repo as unlocked once the unlock pod succeeds")
+		var unlockPod corev1.Pod
+		getTestObject(unlockPodName, &unlockPod)
+		setTestPodPhase(&unlockPod, corev1.PodSucceeded)
+
+		processStaleLock()
+		Expect(lockedCondition().Status).To(Equal(metav1.ConditionFalse))
+		Expect(lockedCondition().Reason).To(Equal("Unlocked"))
+		Expect(backupLoc.ObjectMeta.Annotations).NotTo(HaveKey(exclusiveOperationAnnotation))
+
+		cronJob = getCronJob()
+		Expect(*cronJob.Spec.Suspend).To(BeFalse())
+		Expect(cronJob.ObjectMeta.Annotations).NotTo(HaveKey(suspendedAnnotation))
+
+		operation, err = repoBusy(k8sClient, "default", backupPod.ObjectMeta.Labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operation).To(BeEmpty())
+	})
+
+	It("deletes the unlock pod if another pod starts before it", func() {
+		unlockPodName := name + "-unlock-pod"
+		setTestPodPhase(backupPod, corev1.PodSucceeded)
+
+		processStaleLock()
+		processStaleLock()
+		Expect(testPodExists(unlockPodName)).To(BeTrue())
+
+		By("starting a pod that didn't see the annotation")
+		var unlockPod corev1.Pod
+		getTestObject(unlockPodName, &unlockPod)
+		setTestPodPhase(&unlockPod, corev1.PodPending)
+		setTestPodPhase(backupPod, corev1.PodRunning)
+
+		result := processStaleLock()
+		Expect(result.RequeueAfter).To(Equal(repoBusyRetryInterval))
+		Expect(testPodExists(unlockPodName)).To(BeFalse())
+		Expect(backupLoc.ObjectMeta.Annotations[exclusiveOperationAnnotation]).To(Equal(operationUnlock))
+	})
+
+	It("keeps the repo locked if the unlock pod fails", func() {
+		unlockPodName := name + "-unlock-pod"
+		setTestPodPhase(backupPod, corev1.PodSucceeded)
+
+		processStaleLock()
+		processStaleLock()
+
+		var unlockPod corev1.Pod
+		getTestObject(unlockPodName, &unlockPod)
+		setTestPodPhase(&unlockPod, corev1.PodFailed)
+
+		processStaleLock()
+		Expect(lockedCondition().Status).To(Equal(metav1.ConditionTrue))
+		Expect(lockedCondition().Reason).To(Equal("UnlockFailed"))
+		Expect(backupLoc.ObjectMeta.Annotations).NotTo(HaveKey(exclusiveOperationAnnotation))
+
+		cronJob := getCronJob()
+		Expect(*cronJob.Spec.Suspend).To(BeFalse())
+	})
+
+	It("doesn't unlock before unlockStaleLocksAfter", func() {
+		cond := lockedCondition()
+		cond.LastTransitionTime = metav1.Now()
+		Expect(k8sClient.Status().Update(context.Background(), backupLoc)).To(Succeed())
+
+		result := processStaleLock()
+		Expect(result.RequeueAfter).To(BeNumerically(">", 59*time.Minute))
+		Expect(backupLoc.ObjectMeta.Annotations).NotTo(HaveKey(exclusiveOperationAnnotation))
+	})
+})
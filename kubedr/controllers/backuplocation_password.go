@@ -0,0 +1,228 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
+)
+
+/*
+The password of a repo can't simply be changed in the secret as the repo
+stays encrypted with the old one. Instead, the password is rotated as follows.
+
+- Status records the secret (and key) containing the password with which the
+  repo can currently be opened. All pods use that password.
+
+- If the password in the spec refers to a different secret or key, a pod runs
+  the kubedrutil "changepassword" command, which opens the repo with the
+  current password and changes it to the new one. The pod carries a hash of
+  both so that a pod from an earlier rotation is not mistaken for this one.
+
+- Pods started with the current password would fail once it is changed, so
+  the pod is created only when no other pod is using the repo, in the same
+  way as the pod that removes stale locks (see backuplocation_lock.go).
+
+- Once the pod succeeds, the new password is recorded in status. Policies
+  watch their BackupLocation and rebuild their cronjobs to pick it up.
+
+- If the pod fails, it is left in place so that its logs can be looked at,
+  and the error message in status says how to try again: delete the pod or
+  change the password in the spec.
+
+The old secret must not be deleted until rotation is completed.
+*/
+
+const (
+	passwordRotationAnnotation = "password-rotation.annotations.kubedr.catalogicsoftware.com"
+
+	operationRotatePassword = "rotate-password"
+)
+
+func sameSecretKey(a corev1.SecretKeySelector, b corev1.SecretKeySelector) bool {
+	return (a.Name == b.Name) && (a.Key == b.Key)
+}
+
+func (r *BackupLocationReconciler) setRotationStatus(backupLoc *kubedrv1alpha1.BackupLocation,
+	status string, errmsg string) {
+
+	backupLoc.Status.PasswordRotationStatus = status
+	backupLoc.Status.PasswordRotationErrorMessage = errmsg
+
+	r.Log.Info("Updating status...")
+	if err := r.Status().Update(context.Background(), backupLoc); err != nil {
+		r.Log.Error(err, "unable to update backup location status")
+	}
+}
+
+// processPasswordRotation is called only after the repo is verified for
+// the current target.
+func (r *BackupLocationReconciler) processPasswordRotation(backupLoc *kubedrv1alpha1.BackupLocation,
+	log logr.Logger) (ctrl.Result, error) {
+
+	ctx := context.Background()
+
+	driver, err := engine.New(backupLoc, os.Getenv("KUBEDR_UTIL_IMAGE"))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	changer, ok := driver.(engine.PasswordChanger)
+	if !ok {
+		// The engine doesn't use a password.
+		return ctrl.Result{}, nil
+	}
+
+	desired := backupLoc.Spec.RepoPasswordRef()
+	current := backupLoc.Status.RepoPassword
+
+	if current == nil {
+		// The repo was initialized (or verified) with the password in the spec.
+		log.Info("Recording the repo password in status")
+		backupLoc.Status.RepoPassword = &desired
+		return ctrl.Result{}, r.Status().Update(ctx, backupLoc)
+	}
+
+	if sameSecretKey(*current, desired) {
+		return ctrl.Result{}, r.releaseRepo(backupLoc, operationRotatePassword, log)
+	}
+
+	rotation := hashObject([]corev1.SecretKeySelector{*current, desired})
+	podName := backupLoc.Name + "-rotate-pod"
+
+	var pod corev1.Pod
+	if err := r.Get(ctx, types.NamespacedName{Namespace: backupLoc.Namespace, Name: podName}, &pod); err == nil {
+		if pod.ObjectMeta.Annotations[passwordRotationAnnotation] == rotation {
+			return r.processRotationPod(backupLoc, &pod, desired, log)
+		}
+
+		log.Info("Found rotation pod for a different password, will delete it and continue...")
+		if err := r.Delete(ctx, &pod); ignoreNotFound(err) != nil {
+			log.Error(err, "Error in deleting rotation pod")
+			return ctrl.Result{}, err
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	if acquired, err := r.acquireRepo(backupLoc, operationRotatePassword, podName, log); err != nil || !acquired {
+		return ctrl.Result{RequeueAfter: repoBusyRetryInterval}, err
+	}
+
+	log.Info("Repo password is changed, rotating it", "secret", desired.Name, "key", desired.Key)
+
+	rotatePod, err := buildPasswordRotationPod(backupLoc, changer, driver, podName, desired, log)
+	if err != nil {
+		log.Error(err, "Error in creating rotation pod")
+		return ctrl.Result{}, err
+	}
+	rotatePod.ObjectMeta.Annotations = map[string]string{passwordRotationAnnotation: rotation}
+
+	if err := ctrl.SetControllerReference(backupLoc, rotatePod, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Starting a new Pod", "Pod.Namespace", rotatePod.Namespace, "Pod.Name", rotatePod.Name)
+	if err := r.Create(ctx, rotatePod); err != nil {
+		log.Error(err, "Error in starting rotation pod")
+		return ctrl.Result{}, ignoreErrors(err)
+	}
+
+	r.setRotationStatus(backupLoc, "Rotating", "")
+
+	return r.checkPodAlone(backupLoc, rotatePod, log)
+}
+
+func (r *BackupLocationReconciler) processRotationPod(backupLoc *kubedrv1alpha1.BackupLocation,
+	pod *corev1.Pod, desired corev1.SecretKeySelector, log logr.Logger) (ctrl.Result, error) {
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		log.Info("Repo password is rotated", "secret", desired.Name, "key", desired.Key)
+
+		now := metav1.Now()
+		backupLoc.Status.RepoPassword = &desired
+		backupLoc.Status.PasswordRotationTime = &now
+		r.setRotationStatus(backupLoc, "Completed", "")
+
+	case corev1.PodFailed:
+		// The current password keeps working. Changing the password in the
+		// spec (or deleting the rotation pod) results in another attempt.
+		if backupLoc.Status.PasswordRotationStatus != "Failed" {
+			r.setRotationStatus(backupLoc, "Failed", fmt.Sprintf("%s (delete pod %s or change the password to retry)",
+				podFailureMessage(pod), pod.Name))
+		}
+
+	case corev1.PodPending:
+		return r.checkPodAlone(backupLoc, pod, log)
+
+	default:
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{}, r.releaseRepo(backupLoc, operationRotatePassword, log)
+}
+
+func buildPasswordRotationPod(cr *kubedrv1alpha1.BackupLocation, changer engine.PasswordChanger,
+	driver engine.Driver, podName string, newPassword corev1.SecretKeySelector,
+	log logr.Logger) (*corev1.Pod, error) {
+
+	if os.Getenv("KUBEDR_UTIL_IMAGE") == "" {
+		// This should really not happen.
+		err := fmt.Errorf("KUBEDR_UTIL_IMAGE is not set")
+		log.Error(err, "")
+		return nil, err
+	}
+
+	labels := map[string]string{
+		"kubedr.type":      "backuploc-rotate",
+		"kubedr.backuploc": cr.Name,
+	}
+
+	rotateContainer := changer.ChangePasswordContainer(cr.Name+"-rotate", newPassword)
+	rotateContainer.Env = append(rotateContainer.Env, corev1.EnvVar{Name: "KDR_BACKUPLOC_NAME", Value: cr.Name})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: cr.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{
+			Containers:    []corev1.Container{rotateContainer},
+			Volumes:       driver.Volumes(),
+			RestartPolicy: "Never",
+		},
+	}
+
+	if err := kubedrv1alpha1.ApplyPodTemplateToPod(pod, cr.Spec.PodTemplate); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
+)
+
+/*
+If the deletion policy of a BackupLocation is "Purge", the finalizer is not
+removed until all the backups are deleted.
+
+- A pod deletes the repo (or, for "targz", all the archives in the bucket).
+
+- Once it succeeds, MetadataBackupRecords that refer to the location are
+  deleted as they can't be used any more. For the BackupLocation of a
+  ClusterBackupLocation, these are the records of the ClusterBackupLocation
+  in all namespaces.
+
+- If the pod fails, the "Purged" condition says why and the resource stays.
+  Changing the deletion policy to "Retain" releases it without purging.
+*/
+
+func (r *BackupLocationReconciler) setPurgedCondition(backupLoc *kubedrv1alpha1.BackupLocation,
+	reason string, message string) {
+
+	kubedrv1alpha1.SetCondition(&backupLoc.Status.Conditions, kubedrv1alpha1.Condition{
+		Type:               kubedrv1alpha1.BackupLocationPurged,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: backupLoc.ObjectMeta.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+
+	if err := r.Status().Update(context.Background(), backupLoc); err != nil {
+		r.Log.Error(err, "unable to update backup location status")
+	}
+}
+
+// purge returns true once all the backups are deleted.
+func (r *BackupLocationReconciler) purge(backupLoc *kubedrv1alpha1.BackupLocation, log logr.Logger) (bool, error) {
+	ctx := context.Background()
+	podName := backupLoc.Name + "-purge-pod"
+
+	var pod corev1.Pod
+	err := r.Get(ctx, types.NamespacedName{Namespace: backupLoc.Namespace, Name: podName}, &pod)
+	if apierrors.IsNotFound(err) {
+		purgePod, err := buildPurgePod(backupLoc, podName, log)
+		if err != nil {
+			log.Error(err, "Error in creating purge pod")
+			return false, err
+		}
+
+		if err := ctrl.SetControllerReference(backupLoc, purgePod, r.Scheme); err != nil {
+			return false, err
+		}
+
+		log.Info("Starting a new Pod", "Pod.Namespace", purgePod.Namespace, "Pod.Name", purgePod.Name)
+		if err := r.Create(ctx, purgePod); err != nil {
+			log.Error(err, "Error in starting purge pod")
+			return false, ignoreErrors(err)
+		}
+
+		r.setPurgedCondition(backupLoc, "Purging", "Deleting all backups")
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		log.Info("All backups are deleted, deleting backup records")
+		return true, r.deleteBackupRecords(backupLoc, log)
+
+	case corev1.PodFailed:
+		cond := kubedrv1alpha1.FindCondition(backupLoc.Status.Conditions, kubedrv1alpha1.BackupLocationPurged)
+		if cond == nil || cond.Reason != "PurgeFailed" {
+			r.setPurgedCondition(backupLoc, "PurgeFailed", podFailureMessage(&pod))
+		}
+	}
+
+	return false, nil
+}
+
+func (r *BackupLocationReconciler) deleteBackupRecords(backupLoc *kubedrv1alpha1.BackupLocation,
+	log logr.Logger) error {
+
+	ctx := context.Background()
+
+	// Records of a ClusterBackupLocation are in the namespaces of the
+	// policies that use it.
+	clusterLocName, isClusterLoc := backupLoc.ObjectMeta.Labels[kubedrv1alpha1.ClusterBackupLocationLabel]
+
+	var opts []client.ListOption
+	if !isClusterLoc {
+		opts = append(opts, client.InNamespace(backupLoc.Namespace))
+	}
+
+	var mbrList kubedrv1alpha1.MetadataBackupRecordList
+	if err := r.List(ctx, &mbrList, opts...); err != nil {
+		log.Error(err, "unable to list backup records")
+		return err
+	}
+
+	for i := range mbrList.Items {
+		spec := &mbrList.Items[i].Spec
+		if isClusterLoc {
+			if spec.BackuplocKind != kubedrv1alpha1.KindClusterBackupLocation || spec.Backuploc != clusterLocName {
+				continue
+			}
+		} else if spec.Backuploc != backupLoc.Name || spec.BackuplocKind == kubedrv1alpha1.KindClusterBackupLocation {
+			continue
+		}
+
+		if err := r.Delete(ctx, &mbrList.Items[i]); ignoreNotFound(err) != nil {
+			log.Error(err, "unable to delete mbr", "mbr", mbrList.Items[i].Name)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func buildPurgePod(cr *kubedrv1alpha1.BackupLocation, podName string, log logr.Logger) (*corev1.Pod, error) {
+	kubedrUtilImage := os.Getenv("KUBEDR_UTIL_IMAGE")
+	if kubedrUtilImage == "" {
+		// This should really not happen.
+		err := fmt.Errorf("KUBEDR_UTIL_IMAGE is not set")
+		log.Error(err, "")
+		return nil, err
+	}
+
+	driver, err := engine.New(cr, kubedrUtilImage)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		"kubedr.type":      "backuploc-purge",
+		"kubedr.backuploc": cr.Name,
+	}
+
+	purgeContainer := driver.PurgeContainer(cr.Name + "-purge")
+	purgeContainer.Env = append(purgeContainer.Env, corev1.EnvVar{Name: "KDR_BACKUPLOC_NAME", Value: cr.Name})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: cr.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{
+			Containers:    []corev1.Container{purgeContainer},
+			Volumes:       driver.Volumes(),
+			RestartPolicy: "Never",
+		},
+	}
+
+	if err := kubedrv1alpha1.ApplyPodTemplateToPod(pod, cr.Spec.PodTemplate); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+)
+
+func createTestBackupRecord(name string, backupLocName string, backupLocKind string) {
+	mbr := &kubedrv1alpha1.MetadataBackupRecord{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: kubedrv1alpha1.MetadataBackupRecordSpec{
+			SnapshotId:    "f0e1d2c3",
+			Policy:        "test-policy",
+			Backuploc:     backupLocName,
+			BackuplocKind: backupLocKind,
+		},
+	}
+	Expect(k8sClient.Create(context.Background(), mbr)).To(Succeed())
+}
+
+func testBackupRecordExists(name string) bool {
+	var mbr kubedrv1alpha1.MetadataBackupRecord
+	err := k8sClient.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, &mbr)
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	Expect(err).NotTo(HaveOccurred())
+
+	return true
+}
+
+var _ = Describe("Purge", func() {
+	const (
+		name       = "purgeloc"
+		podName    = name + "-purge-pod"
+		ownMBR     = "purge-mbr-own"
+		otherMBR   = "purge-mbr-other"
+		clusterMBR = "purge-mbr-cluster"
+	)
+
+	var (
+		r         *BackupLocationReconciler
+		backupLoc *kubedrv1alpha1.BackupLocation
+	)
+
+	// purge is called with the latest version of the location, as it is
+	// by Reconcile.
+	purge := func() bool {
+		backupLoc = &kubedrv1alpha1.BackupLocation{}
+		getTestObject(name, backupLoc)
+
+		purged, err := r.purge(backupLoc, r.Log)
+		Expect(err).NotTo(HaveOccurred())
+
+		backupLoc = &kubedrv1alpha1.BackupLocation{}
+		getTestObject(name, backupLoc)
+		return purged
+	}
+
+	purgedCondition := func() *kubedrv1alpha1.Condition {
+		return kubedrv1alpha1.FindCondition(backupLoc.Status.Conditions, kubedrv1alpha1.BackupLocationPurged)
+	}
+
+	BeforeEach(func() {
+		os.Setenv("KUBEDR_UTIL_IMAGE", "catalogicsoftware/kubedrutil:test")
+		r = newTestBackupLocationReconciler()
+
+		backupLoc = createTestBackupLocation(name, kubedrv1alpha1.BackupLocationSpec{
+			DeletionPolicy: kubedrv1alpha1.DeletionPolicyPurge,
+		})
+
+		createTestBackupRecord(ownMBR, name, "")
+		createTestBackupRecord(otherMBR, "otherloc", "")
+		createTestBackupRecord(clusterMBR, name, kubedrv1alpha1.KindClusterBackupLocation)
+	})
+
+	AfterEach(func() {
+		ctx := context.Background()
+
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: podName, Namespace: "default"}}
+		Expect(ignoreNotFound(k8sClient.Delete(ctx, pod))).To(Succeed())
+
+		for _, mbrName := range []string{ownMBR, otherMBR, clusterMBR} {
+			mbr := &kubedrv1alpha1.MetadataBackupRecord{ObjectMeta: metav1.ObjectMeta{Name: mbrName,
+				Namespace: "default"}}
+			Expect(ignoreNotFound(k8sClient.Delete(ctx, mbr))).To(Succeed())
+		}
+
+		Expect(k8sClient.Delete(ctx, backupLoc)).To(Succeed())
+		os.Unsetenv("KUBEDR_UTIL_IMAGE")
+	})
+
+	It("deletes the records of the location only after the purge pod succeeds", func() {
+		By("starting the purge pod")
+		Expect(purge()).To(BeFalse())
+		Expect(testPodExists(podName)).To(BeTrue())
+		Expect(purgedCondition().Reason).To(Equal("Purging"))
+
+		By("waiting while the purge pod is running")
+		var pod corev1.Pod
+		getTestObject(podName, &pod)
+		setTestPodPhase(&pod, corev1.PodRunning)
+
+		Expect(purge()).To(BeFalse())
+		Expect(testBackupRecordExists(ownMBR)).To(BeTrue())
+
+		By("deleting the records once the purge pod succeeds")
+		setTestPodPhase(&pod, corev1.PodSucceeded)
+
+		Expect(purge()).To(BeTrue())
+		Expect(testBackupRecordExists(ownMBR)).To(BeFalse())
+		Expect(testBackupRecordExists(otherMBR)).To(BeTrue())
+		Expect(testBackupRecordExists(clusterMBR)).To(BeTrue())
+	})
+
+	It("keeps the records and reports the error if the purge pod fails", func() {
+		Expect(purge()).To(BeFalse())
+
+		var pod corev1.Pod
+		getTestObject(podName, &pod)
+		pod.Status.Message = "Repo not found"
+		setTestPodPhase(&pod, corev1.PodFailed)
+
+		Expect(purge()).To(BeFalse())
+		Expect(purgedCondition().Status).To(Equal(metav1.ConditionFalse))
+		Expect(purgedCondition().Reason).To(Equal("PurgeFailed"))
+		Expect(purgedCondition().Message).To(Equal("Repo not found"))
+		Expect(testBackupRecordExists(ownMBR)).To(BeTrue())
+
+		By("not starting another purge pod")
+		Expect(purge()).To(BeFalse())
+		Expect(purgedCondition().Reason).To(Equal("PurgeFailed"))
+	})
+})
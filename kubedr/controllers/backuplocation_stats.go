@@ -0,0 +1,97 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
+)
+
+/*
+Usage statistics of a repo are collected by a cronjob owned by the
+BackupLocation, in the same way as integrity checks.
+
+- The cronjob exists only if "statsSchedule" is given.
+
+- The kubedrutil "stats" command sets "stats" in the status of the
+  BackupLocation.
+
+- The statistics are exported as gauges. Unlike the result of a check,
+  setting them again doesn't change anything so there is no need to
+  remember which stats pod was processed.
+*/
+
+func (r *BackupLocationReconciler) processStats(backupLoc *kubedrv1alpha1.BackupLocation,
+	log logr.Logger) (ctrl.Result, error) {
+
+	if result, err := r.reconcileStatsCronJob(backupLoc, log); err != nil {
+		return result, err
+	}
+
+	if stats := backupLoc.Status.Stats; stats != nil && stats.StatsStatus == "Completed" {
+		r.MetricsInfo.SetRepoStats(backupLoc.Namespace, backupLoc.Name, stats.TotalSize,
+			stats.DeduplicatedSize, stats.NumSnapshots, stats.OldestSnapshotTime, stats.NewestSnapshotTime)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *BackupLocationReconciler) reconcileStatsCronJob(backupLoc *kubedrv1alpha1.BackupLocation,
+	log logr.Logger) (ctrl.Result, error) {
+
+	cronJobName := backupLoc.Name + "-stats-cronjob"
+	if backupLoc.Spec.StatsSchedule == "" {
+		return r.reconcileRepoCronJob(backupLoc, cronJobName, nil, log)
+	}
+
+	statsCronJob, err := buildStatsCronjob(backupLoc, cronJobName, log)
+	if err != nil {
+		log.Error(err, "Error in creating stats cronjob")
+		return ctrl.Result{}, err
+	}
+
+	return r.reconcileRepoCronJob(backupLoc, cronJobName, statsCronJob, log)
+}
+
+func buildStatsCronjob(cr *kubedrv1alpha1.BackupLocation, cronJobName string,
+	log logr.Logger) (*batchv1beta1.CronJob, error) {
+
+	kubedrUtilImage := os.Getenv("KUBEDR_UTIL_IMAGE")
+	if kubedrUtilImage == "" {
+		// This should really not happen.
+		err := fmt.Errorf("KUBEDR_UTIL_IMAGE is not set")
+		log.Error(err, "")
+		return nil, err
+	}
+
+	driver, err := engine.New(cr, kubedrUtilImage)
+	if err != nil {
+		return nil, err
+	}
+
+	statsContainer := driver.StatsContainer(cr.Name + "-stats")
+
+	return buildRepoCronJob(cr, cronJobName, cr.Spec.StatsSchedule, "backuploc-stats",
+		statsContainer, driver.Volumes())
+}
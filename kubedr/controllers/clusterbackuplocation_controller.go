@@ -0,0 +1,543 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
+)
+
+// ClusterBackupLocationReconciler reconciles a ClusterBackupLocation object
+type ClusterBackupLocationReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=clusterbackuplocations,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=clusterbackuplocations/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=create;get;list;watch;update;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=create;get;list;watch;update;delete
+
+/*
+A ClusterBackupLocation doesn't manage the repo itself.
+
+- A BackupLocation with the same name is created in "secretsNamespace" and
+  kept in sync with the spec. It initializes, checks and purges the repo
+  just like any other BackupLocation. Its status is copied to the
+  ClusterBackupLocation.
+
+- Pods that back up to, restore from or delete snapshots in the location
+  run in the namespace of the policy. They are built from a copy of the
+  BackupLocation, returned by backupLocationFor, that refers to copies of
+  the secrets (and config maps) in that namespace. The copies are owned by
+  the ClusterBackupLocation and carry its name in a label. As they expose
+  the credentials, namespaces other than "secretsNamespace" are only
+  allowed if "copySecrets" is set.
+
+- Copies in namespaces that are no longer allowed are deleted.
+
+- Pods built from such a copy carry the name of the ClusterBackupLocation in
+  "kubedr.cluster-backuploc" (or "kubedr.source-cluster-backuploc") instead
+  of "kubedr.backuploc".
+*/
+
+const (
+	clusterBackupLocLabel       = "kubedr.cluster-backuploc"
+	sourceClusterBackupLocLabel = "kubedr.source-cluster-backuploc"
+)
+
+// Reconcile is the the main entry point called by the framework.
+func (r *ClusterBackupLocationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("clusterbackuplocation", req.NamespacedName)
+
+	var clusterLoc kubedrv1alpha1.ClusterBackupLocation
+	if err := r.Get(ctx, req.NamespacedName, &clusterLoc); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("ClusterBackupLocation (" + req.NamespacedName.Name + ") is not found")
+			return ctrl.Result{}, nil
+		}
+
+		log.Error(err, "unable to fetch ClusterBackupLocation")
+		return ctrl.Result{}, err
+	}
+
+	if !clusterLoc.ObjectMeta.DeletionTimestamp.IsZero() {
+		// The BackupLocation and the copies of the secrets are deleted
+		// by the garbage collector.
+		return ctrl.Result{}, nil
+	}
+
+	backupLoc, err := r.reconcileBackupLocation(&clusterLoc, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if backupLoc == nil {
+		return ctrl.Result{}, r.setConflictStatus(&clusterLoc, log)
+	}
+
+	// Generations of the BackupLocation are translated to those of the
+	// ClusterBackupLocation.
+	status := backupLoc.Status.DeepCopy()
+	status.ObservedGeneration = clusterLoc.Status.ObservedGeneration
+	if backupLoc.Status.ObservedGeneration == backupLoc.ObjectMeta.Generation {
+		status.ObservedGeneration = clusterLoc.ObjectMeta.Generation
+	}
+	for i := range status.Conditions {
+		status.Conditions[i].ObservedGeneration = status.ObservedGeneration
+	}
+
+	if !reflect.DeepEqual(&clusterLoc.Status, status) {
+		clusterLoc.Status = *status
+		if err := r.Status().Update(ctx, &clusterLoc); err != nil {
+			log.Error(err, "unable to update cluster backup location status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, r.deleteDisallowedCopies(&clusterLoc, log)
+}
+
+// reconcileBackupLocation creates or updates the BackupLocation that manages
+// the repo. It returns nil if a BackupLocation with the same name exists but
+// doesn't belong to this ClusterBackupLocation.
+func (r *ClusterBackupLocationReconciler) reconcileBackupLocation(clusterLoc *kubedrv1alpha1.ClusterBackupLocation,
+	log logr.Logger) (*kubedrv1alpha1.BackupLocation, error) {
+
+	ctx := context.Background()
+	desired := clusterLoc.BackupLocation()
+
+	var backupLoc kubedrv1alpha1.BackupLocation
+	err := r.Get(ctx, types.NamespacedName{Namespace: desired.Namespace, Name: desired.Name}, &backupLoc)
+	if apierrors.IsNotFound(err) {
+		if err := ctrl.SetControllerReference(clusterLoc, desired, r.Scheme); err != nil {
+			return nil, err
+		}
+
+		log.Info("Creating BackupLocation", "Namespace", desired.Namespace, "Name", desired.Name)
+		return desired, ignoreErrors(r.Create(ctx, desired))
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !metav1.IsControlledBy(&backupLoc, clusterLoc) {
+		log.Error(fmt.Errorf("BackupLocation %s/%s already exists", backupLoc.Namespace, backupLoc.Name),
+			"not managing the repo")
+		return nil, nil
+	}
+
+	if reflect.DeepEqual(backupLoc.Spec, desired.Spec) &&
+		backupLoc.ObjectMeta.Annotations[kubedrv1alpha1.ForceDeleteAnnotation] ==
+			desired.ObjectMeta.Annotations[kubedrv1alpha1.ForceDeleteAnnotation] {
+
+		return &backupLoc, nil
+	}
+
+	log.Info("BackupLocation is out of date, updating it")
+	backupLoc.Spec = desired.Spec
+	if value, ok := desired.ObjectMeta.Annotations[kubedrv1alpha1.ForceDeleteAnnotation]; ok {
+		if backupLoc.ObjectMeta.Annotations == nil {
+			backupLoc.ObjectMeta.Annotations = make(map[string]string)
+		}
+		backupLoc.ObjectMeta.Annotations[kubedrv1alpha1.ForceDeleteAnnotation] = value
+	} else {
+		delete(backupLoc.ObjectMeta.Annotations, kubedrv1alpha1.ForceDeleteAnnotation)
+	}
+
+	return &backupLoc, r.Update(ctx, &backupLoc)
+}
+
+// setConflictStatus reports that the ClusterBackupLocation can't be used
+// because a BackupLocation with its name, that it doesn't own, already
+// exists in "secretsNamespace".
+func (r *ClusterBackupLocationReconciler) setConflictStatus(clusterLoc *kubedrv1alpha1.ClusterBackupLocation,
+	log logr.Logger) error {
+
+	status := clusterLoc.Status.DeepCopy()
+	status.ObservedGeneration = clusterLoc.ObjectMeta.Generation
+	kubedrv1alpha1.SetPhase(&status.Conditions, kubedrv1alpha1.ConditionFailed, status.ObservedGeneration,
+		"BackupLocationConflict", fmt.Sprintf("BackupLocation %s/%s already exists and is not managed by "+
+			"this ClusterBackupLocation", clusterLoc.Spec.SecretsNamespace, clusterLoc.Name))
+
+	if reflect.DeepEqual(&clusterLoc.Status, status) {
+		return nil
+	}
+
+	clusterLoc.Status = *status
+	if err := r.Status().Update(context.Background(), clusterLoc); err != nil {
+		log.Error(err, "unable to update cluster backup location status")
+		return err
+	}
+
+	return nil
+}
+
+// deleteDisallowedCopies deletes the copies of the secrets in namespaces that
+// are no longer allowed to use the location.
+func (r *ClusterBackupLocationReconciler) deleteDisallowedCopies(clusterLoc *kubedrv1alpha1.ClusterBackupLocation,
+	log logr.Logger) error {
+
+	ctx := context.Background()
+	selector := client.MatchingLabels{kubedrv1alpha1.ClusterBackupLocationLabel: clusterLoc.Name}
+
+	var secretList corev1.SecretList
+	if err := r.List(ctx, &secretList, selector); err != nil {
+		return err
+	}
+
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		if clusterLoc.AllowsNamespace(secret.Namespace) {
+			continue
+		}
+
+		log.Info("Deleting secret from namespace that is no longer allowed", "namespace", secret.Namespace)
+		if err := r.Delete(ctx, secret); ignoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	var configMapList corev1.ConfigMapList
+	if err := r.List(ctx, &configMapList, selector); err != nil {
+		return err
+	}
+
+	for i := range configMapList.Items {
+		configMap := &configMapList.Items[i]
+		if clusterLoc.AllowsNamespace(configMap.Namespace) {
+			continue
+		}
+
+		log.Info("Deleting config map from namespace that is no longer allowed", "namespace", configMap.Namespace)
+		if err := r.Delete(ctx, configMap); ignoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetupWithManager hooks up this controller with the manager.
+func (r *ClusterBackupLocationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kubedrv1alpha1.ClusterBackupLocation{}).
+		Watches(&source.Kind{Type: &kubedrv1alpha1.BackupLocation{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(clusterLocationForBackupLocation),
+			}).
+		Complete(r)
+}
+
+// clusterLocationForBackupLocation returns a request for the
+// ClusterBackupLocation with the name of the given BackupLocation. Besides
+// the BackupLocation that it owns, this includes one that it clashes with,
+// so that the clash is noticed once that is deleted.
+func clusterLocationForBackupLocation(obj handler.MapObject) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.Meta.GetName()}}}
+}
+
+// copyName returns the name of the copy of a secret (or config map) of the
+// given ClusterBackupLocation.
+func copyName(clusterLocName string, name string) string {
+	return "kubedr-" + clusterLocName + "-" + name
+}
+
+// checkCopyOwner returns an error if an object with the name of a copy was
+// not created by the given ClusterBackupLocation. Such an object belongs to
+// someone else and is never overwritten. The error is "Forbidden" so that
+// policies report it instead of retrying.
+func checkCopyOwner(clusterLoc *kubedrv1alpha1.ClusterBackupLocation, obj metav1.Object, resource string) error {
+	if metav1.IsControlledBy(obj, clusterLoc) &&
+		obj.GetLabels()[kubedrv1alpha1.ClusterBackupLocationLabel] == clusterLoc.Name {
+		return nil
+	}
+
+	return apierrors.NewForbidden(schema.GroupResource{Resource: resource}, obj.GetName(),
+		fmt.Errorf("it already exists in namespace %q and is not managed by ClusterBackupLocation %q",
+			obj.GetNamespace(), clusterLoc.Name))
+}
+
+// syncSecret copies the given secret from "secretsNamespace" to "namespace".
+func syncSecret(c client.Client, scheme *runtime.Scheme, clusterLoc *kubedrv1alpha1.ClusterBackupLocation,
+	namespace string, name string) error {
+
+	ctx := context.Background()
+
+	var src corev1.Secret
+	if err := c.Get(ctx, types.NamespacedName{Namespace: clusterLoc.Spec.SecretsNamespace, Name: name},
+		&src); err != nil {
+		return err
+	}
+
+	var dest corev1.Secret
+	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: copyName(clusterLoc.Name, name)}, &dest)
+	if err == nil {
+		if err := checkCopyOwner(clusterLoc, &dest, "secrets"); err != nil {
+			return err
+		}
+
+		if reflect.DeepEqual(dest.Data, src.Data) {
+			return nil
+		}
+
+		dest.Data = src.Data
+		return c.Update(ctx, &dest)
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	dest = corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      copyName(clusterLoc.Name, name),
+			Namespace: namespace,
+			Labels:    map[string]string{kubedrv1alpha1.ClusterBackupLocationLabel: clusterLoc.Name},
+		},
+		Type: src.Type,
+		Data: src.Data,
+	}
+
+	if err := ctrl.SetControllerReference(clusterLoc, &dest, scheme); err != nil {
+		return err
+	}
+
+	return ignoreErrors(c.Create(ctx, &dest))
+}
+
+// syncConfigMap copies the given config map from "secretsNamespace" to
+// "namespace".
+func syncConfigMap(c client.Client, scheme *runtime.Scheme, clusterLoc *kubedrv1alpha1.ClusterBackupLocation,
+	namespace string, name string) error {
+
+	ctx := context.Background()
+
+	var src corev1.ConfigMap
+	if err := c.Get(ctx, types.NamespacedName{Namespace: clusterLoc.Spec.SecretsNamespace, Name: name},
+		&src); err != nil {
+		return err
+	}
+
+	var dest corev1.ConfigMap
+	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: copyName(clusterLoc.Name, name)}, &dest)
+	if err == nil {
+		if err := checkCopyOwner(clusterLoc, &dest, "configmaps"); err != nil {
+			return err
+		}
+
+		if reflect.DeepEqual(dest.Data, src.Data) {
+			return nil
+		}
+
+		dest.Data = src.Data
+		return c.Update(ctx, &dest)
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	dest = corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      copyName(clusterLoc.Name, name),
+			Namespace: namespace,
+			Labels:    map[string]string{kubedrv1alpha1.ClusterBackupLocationLabel: clusterLoc.Name},
+		},
+		Data: src.Data,
+	}
+
+	if err := ctrl.SetControllerReference(clusterLoc, &dest, scheme); err != nil {
+		return err
+	}
+
+	return ignoreErrors(c.Create(ctx, &dest))
+}
+
+// localizeBackupLocation copies the secrets and config maps referred to by
+// "backupLoc" to "namespace" and changes the references to point to the
+// copies.
+func localizeBackupLocation(c client.Client, scheme *runtime.Scheme,
+	clusterLoc *kubedrv1alpha1.ClusterBackupLocation, backupLoc *kubedrv1alpha1.BackupLocation,
+	namespace string) error {
+
+	secretRefs := []*string{&backupLoc.Spec.Credentials}
+	if ref := backupLoc.Spec.RepoPasswordSecret; ref != nil {
+		secretRefs = append(secretRefs, &ref.Name)
+	}
+	if ref := backupLoc.Status.RepoPassword; ref != nil {
+		secretRefs = append(secretRefs, &ref.Name)
+	}
+
+	var configMapRefs []*string
+	if tls := backupLoc.Spec.TLS; tls != nil && tls.CABundle != nil {
+		if ref := tls.CABundle.SecretKeyRef; ref != nil {
+			secretRefs = append(secretRefs, &ref.Name)
+		}
+		if ref := tls.CABundle.ConfigMapKeyRef; ref != nil {
+			configMapRefs = append(configMapRefs, &ref.Name)
+		}
+	}
+
+	for _, name := range secretRefs {
+		if *name == "" {
+			continue
+		}
+
+		if err := syncSecret(c, scheme, clusterLoc, namespace, *name); err != nil {
+			return err
+		}
+		*name = copyName(clusterLoc.Name, *name)
+	}
+
+	for _, name := range configMapRefs {
+		if err := syncConfigMap(c, scheme, clusterLoc, namespace, *name); err != nil {
+			return err
+		}
+		*name = copyName(clusterLoc.Name, *name)
+	}
+
+	return nil
+}
+
+// repoBackupLocationKey returns the key of the BackupLocation that manages the
+// repo of the given location.
+func repoBackupLocationKey(c client.Client, namespace string, kind string,
+	name string) (types.NamespacedName, error) {
+
+	if kind != kubedrv1alpha1.KindClusterBackupLocation {
+		return types.NamespacedName{Namespace: namespace, Name: name}, nil
+	}
+
+	var clusterLoc kubedrv1alpha1.ClusterBackupLocation
+	if err := c.Get(context.Background(), types.NamespacedName{Name: name}, &clusterLoc); err != nil {
+		return types.NamespacedName{}, err
+	}
+
+	return types.NamespacedName{Namespace: clusterLoc.Spec.SecretsNamespace, Name: name}, nil
+}
+
+// backupLocationFor returns the BackupLocation to be used by pods in the
+// given namespace. If "kind" is "ClusterBackupLocation", it is a copy of the
+// BackupLocation of that ClusterBackupLocation with its secrets copied to
+// the namespace. The copy must not be saved.
+func backupLocationFor(c client.Client, scheme *runtime.Scheme, namespace string, kind string,
+	name string) (*kubedrv1alpha1.BackupLocation, error) {
+
+	ctx := context.Background()
+
+	if kind != kubedrv1alpha1.KindClusterBackupLocation {
+		backupLoc := &kubedrv1alpha1.BackupLocation{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, backupLoc); err != nil {
+			return nil, err
+		}
+
+		return backupLoc, nil
+	}
+
+	var clusterLoc kubedrv1alpha1.ClusterBackupLocation
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, &clusterLoc); err != nil {
+		return nil, err
+	}
+
+	if !clusterLoc.AllowsNamespace(namespace) {
+		return nil, apierrors.NewForbidden(
+			schema.GroupResource{Group: kubedrv1alpha1.GroupVersion.Group, Resource: "clusterbackuplocations"},
+			name, fmt.Errorf("namespace %q is not allowed to use it", namespace))
+	}
+
+	backupLoc := &kubedrv1alpha1.BackupLocation{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: clusterLoc.Spec.SecretsNamespace, Name: name},
+		backupLoc); err != nil {
+		return nil, err
+	}
+
+	if !metav1.IsControlledBy(backupLoc, &clusterLoc) {
+		return nil, apierrors.NewNotFound(
+			schema.GroupResource{Group: kubedrv1alpha1.GroupVersion.Group, Resource: "backuplocations"}, name)
+	}
+
+	if backupLoc.Namespace == namespace {
+		return backupLoc, nil
+	}
+
+	// The prefix refers to the namespace of the BackupLocation that
+	// initialized the repo, not to the namespace of the pods.
+	prefix, err := engine.RepoPrefix(backupLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	backupLoc = backupLoc.DeepCopy()
+	backupLoc.Spec.Prefix = prefix
+	backupLoc.Namespace = namespace
+
+	if err := localizeBackupLocation(c, scheme, &clusterLoc, backupLoc, namespace); err != nil {
+		return nil, err
+	}
+
+	return backupLoc, nil
+}
+
+// locationLabels returns the labels that identify the location used by a
+// pod. "source" is true if the pod only reads from it.
+func locationLabels(backupLoc *kubedrv1alpha1.BackupLocation, source bool) map[string]string {
+	if clusterLocName, ok := backupLoc.ObjectMeta.Labels[kubedrv1alpha1.ClusterBackupLocationLabel]; ok {
+		if source {
+			return map[string]string{sourceClusterBackupLocLabel: clusterLocName}
+		}
+		return map[string]string{clusterBackupLocLabel: clusterLocName}
+	}
+
+	if source {
+		return map[string]string{sourceBackupLocLabel: backupLoc.Name}
+	}
+	return map[string]string{backupLocLabel: backupLoc.Name}
+}
+
+// podLocation returns the kind and the name of the location to which a pod
+// writes, as per its labels.
+func podLocation(pod *corev1.Pod) (string, string) {
+	if name := pod.ObjectMeta.Labels[clusterBackupLocLabel]; name != "" {
+		return kubedrv1alpha1.KindClusterBackupLocation, name
+	}
+
+	return kubedrv1alpha1.KindBackupLocation, pod.ObjectMeta.Labels[backupLocLabel]
+}
+
+// mergeLabels adds the labels in "extra" to "labels" and returns it.
+func mergeLabels(labels map[string]string, extra map[string]string) map[string]string {
+	for k, v := range extra {
+		labels[k] = v
+	}
+
+	return labels
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+)
+
+// MetadataBackupReconciler reconciles a MetadataBackup object
+type MetadataBackupReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+func (r *MetadataBackupReconciler) setStatus(mb *kubedrv1alpha1.MetadataBackup, status string, errmsg string) {
+	mb.Status.ObservedGeneration = mb.ObjectMeta.Generation
+	mb.Status.BackupStatus = status
+	mb.Status.BackupErrorMessage = errmsg
+
+	now := metav1.Now()
+	if status == "InProgress" {
+		mb.Status.StartTime = &now
+	} else {
+		mb.Status.CompletionTime = &now
+	}
+
+	setBackupConditions(&mb.Status, mb.ObjectMeta.Generation)
+
+	r.Log.Info("Updating status...")
+	if err := r.Status().Update(context.Background(), mb); err != nil {
+		r.Log.Error(err, "unable to update MetadataBackup status")
+	}
+}
+
+// +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=metadatabackups,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=metadatabackups/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=create;get;list;watch;delete
+
+/*
+ * Top level Reconcile logic
+ *
+ * - Once the backup is over (status is "Completed" or "Failed"), there
+ *   is nothing more to do. The status is set by the kubedrutil "backup"
+ *   command, just as it is for the policy.
+ *
+ * - If the job doesn't exist yet, create it from the job template of the
+ *   policy's cronjob. This makes sure that a manual backup is the same as
+ *   a scheduled one, except that the MetadataBackupRecord refers to this
+ *   resource. The job is not created while an operation that needs
+ *   exclusive access to the repo is in progress (see backuplocation_lock.go)
+ *   or while another backup job of the policy, scheduled or manual, is yet
+ *   to finish, as the cronjob doesn't run concurrent jobs either.
+ *
+ * - If the job failed without kubedrutil reporting the result (for
+ *   example, if the pod couldn't be started), set the status here.
+ *
+ * - There is nothing to do for deletion. The job is owned by this resource
+ *   and the snapshot is managed by the MetadataBackupRecord.
+ */
+
+// Reconcile is the the main entry point called by the framework.
+func (r *MetadataBackupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+
+	var mb kubedrv1alpha1.MetadataBackup
+	if err := r.Get(ctx, req.NamespacedName, &mb); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Log.Info("MetadataBackup (" + req.NamespacedName.Name + ") is not found")
+			return ctrl.Result{}, nil
+		}
+
+		r.Log.Error(err, "unable to fetch MetadataBackup")
+		return ctrl.Result{}, err
+	}
+
+	if !mb.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	if isFinished(mb.Status.BackupStatus) {
+		// The result is set by kubedrutil, without the conditions.
+		status := mb.Status.DeepCopy()
+		setBackupConditions(status, status.ObservedGeneration)
+		if !reflect.DeepEqual(&mb.Status, status) {
+			mb.Status = *status
+			if err := r.Status().Update(ctx, &mb); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	jobName := mb.Name + "-backup-job"
+
+	var job batchv1.Job
+	if err := r.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: jobName}, &job); err == nil {
+		if jobDeadlineExceeded(&job) != nil {
+			r.setStatus(&mb, "TimedOut", timedOutMessage(&job))
+		} else if job.Status.Failed > 0 && job.Status.Active == 0 {
+			r.setStatus(&mb, "Failed", "Backup job failed before reporting its result")
+		}
+
+		return ctrl.Result{}, nil
+	} else if !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	backupJob, err := r.buildBackupJob(&mb, jobName)
+	if err != nil {
+		r.Log.Error(err, "Error in building backup job")
+		if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+			// Either the policy or its location doesn't exist, or the
+			// location can't be used. Retrying won't help.
+			r.setStatus(&mb, "Failed", fmt.Sprintf("Error in creating backup job, reason (%s)", err.Error()))
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	operation, err := repoBusy(r.Client, mb.Namespace, backupJob.ObjectMeta.Labels)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if operation != "" {
+		r.Log.Info("Repo is busy, will start the backup later", "operation", operation)
+		return ctrl.Result{RequeueAfter: repoBusyRetryInterval}, nil
+	}
+
+	running, err := r.policyJobRunning(mb.Namespace, mb.Spec.Policy)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if running != "" {
+		r.Log.Info("Another backup of the policy is running, will start the backup later", "job", running)
+		return ctrl.Result{RequeueAfter: repoBusyRetryInterval}, nil
+	}
+
+	if err := ctrl.SetControllerReference(&mb, backupJob, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	r.Log.Info("Starting a new Job", "Job.Namespace", backupJob.Namespace, "Job.Name", backupJob.Name)
+	if err := r.Create(ctx, backupJob); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return ctrl.Result{}, nil
+		}
+
+		r.Log.Error(err, "Error in starting backup job")
+		r.setStatus(&mb, "Failed", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	mb.Status.JobName = jobName
+	r.setStatus(&mb, "InProgress", "")
+
+	return ctrl.Result{}, nil
+}
+
+// isFinished returns true if the backup is over, whether it succeeded or not.
+func isFinished(backupStatus string) bool {
+	return backupStatus == "Completed" || backupStatus == "Failed" || backupStatus == "TimedOut"
+}
+
+// policyJobRunning returns the name of a backup job of the given policy
+// that is yet to finish, if there is one.
+func (r *MetadataBackupReconciler) policyJobRunning(namespace string, policyName string) (string, error) {
+	var jobList batchv1.JobList
+	if err := r.List(context.Background(), &jobList, client.InNamespace(namespace),
+		client.MatchingLabels{"kubedr.type": "backup", "kubedr.backup-policy": policyName}); err != nil {
+		return "", err
+	}
+
+	for i := range jobList.Items {
+		if !jobFinished(&jobList.Items[i]) {
+			return jobList.Items[i].Name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// setBackupConditions sets the conditions that correspond to the status of
+// the backup.
+func setBackupConditions(status *kubedrv1alpha1.MetadataBackupStatus, generation int64) {
+	phase, reason := policyPhase(status.BackupStatus)
+	if status.BackupStatus == "" {
+		phase, reason = kubedrv1alpha1.ConditionProgressing, "BackupInProgress"
+	}
+
+	kubedrv1alpha1.SetPhase(&status.Conditions, phase, generation, reason, status.BackupErrorMessage)
+}
+
+// buildBackupJob returns the job that backs up as per the policy of the
+// given MetadataBackup.
+func (r *MetadataBackupReconciler) buildBackupJob(mb *kubedrv1alpha1.MetadataBackup,
+	jobName string) (*batchv1.Job, error) {
+
+	var policy kubedrv1alpha1.MetadataBackupPolicy
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: mb.Namespace, Name: mb.Spec.Policy},
+		&policy); err != nil {
+		return nil, err
+	}
+
+	policyReconciler := &MetadataBackupPolicyReconciler{Client: r.Client, Log: r.Log, Scheme: r.Scheme}
+	cronJob, err := policyReconciler.buildBackupCronjob(&policy, mb.Namespace, policy.Name+"-backup-cronjob")
+	if err != nil {
+		return nil, err
+	}
+
+	template := cronJob.Spec.JobTemplate
+	podSpec := &template.Spec.Template.Spec
+
+	// With hooks, the backup container can be an init container.
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			containers[i].Env = append(containers[i].Env, corev1.EnvVar{Name: "KDR_BACKUP_NAME", Value: mb.Name})
+		}
+	}
+
+	labels := mergeLabels(map[string]string{"kubedr.manual-backup": mb.Name}, template.Spec.Template.Labels)
+	template.Spec.Template.Labels = labels
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: mb.Namespace,
+			Labels:    labels,
+		},
+		Spec: template.Spec,
+	}, nil
+}
+
+// SetupWithManager hooks up this controller with the manager.
+func (r *MetadataBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kubedrv1alpha1.MetadataBackup{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
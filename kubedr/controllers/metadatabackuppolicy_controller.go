@@ -18,8 +18,10 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -32,11 +34,25 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
 	"kubedr/metrics"
 )
 
+const (
+	// The history of a policy is kept in the config map "<policy><suffix>",
+	// as JSON under the key "historyKey".
+	historyConfigMapSuffix = "-backup-history"
+	historyKey             = "history.json"
+
+	// Name of the last backup job whose timeout was reported.
+	reportedTimeoutAnnotation = "reported-timeout.annotations.kubedr.catalogicsoftware.com"
+)
+
 // MetadataBackupPolicyReconciler reconciles a MetadataBackupPolicy object
 type MetadataBackupPolicyReconciler struct {
 	client.Client
@@ -54,6 +70,9 @@ func (r *MetadataBackupPolicyReconciler) newPolicy(policy *kubedrv1alpha1.Metada
 	backupCronjob, err := r.buildBackupCronjob(policy, namespace, cronJobName)
 	if err != nil {
 		r.Log.Error(err, "Error in creating backup cronjob")
+		if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
+			r.updateConditions(policy, err)
+		}
 		return ctrl.Result{}, err
 	}
 
@@ -85,34 +104,96 @@ func (r *MetadataBackupPolicyReconciler) newPolicy(policy *kubedrv1alpha1.Metada
 }
 
 // Policy and Cronjob already exist. Make any required changes to the cronjob.
-// If retention is changed, there is nothing to be done here. The retention
-// logic in in MetadataBackupRecord controller.
+// Besides changes to the policy, this includes changes to the BackupLocation
+// (such as a new repo password) that affect the backup pod. If retention is
+// changed, there is nothing to be done here. The retention logic in in
+// MetadataBackupRecord controller.
 func (r *MetadataBackupPolicyReconciler) processUpdate(policy *kubedrv1alpha1.MetadataBackupPolicy,
 	cronJob *batchv1beta1.CronJob) (ctrl.Result, error) {
 
-	updateCron := false
+	backupCronjob, err := r.buildBackupCronjob(policy, cronJob.Namespace, cronJob.Name)
+	if err != nil {
+		r.Log.Error(err, "Error in building backup cronjob")
+		if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
+			// The location doesn't exist, the namespace is no longer
+			// allowed to use it or a copy of its secrets clashes with an
+			// existing secret. Retrying won't help until that is changed.
+			r.updateConditions(policy, err)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
 
-	if cronJob.Spec.Schedule != policy.Spec.Schedule {
-		r.Log.Info("Schedule changed")
-		cronJob.Spec.Schedule = policy.Spec.Schedule
-		updateCron = true
+	if cronJob.ObjectMeta.Annotations[specHashAnnotation] == backupCronjob.ObjectMeta.Annotations[specHashAnnotation] {
+		r.updateConditions(policy, nil)
+		return ctrl.Result{}, nil
 	}
 
-	if *cronJob.Spec.Suspend != *policy.Spec.Suspend {
-		r.Log.V(1).Info("suspend status changed")
-		cronJob.Spec.Suspend = policy.Spec.Suspend
-		updateCron = true
+	r.Log.Info("Backup cronjob is out of date, updating it")
+	if cronJob.ObjectMeta.Annotations == nil {
+		cronJob.ObjectMeta.Annotations = make(map[string]string)
 	}
+	cronJob.ObjectMeta.Annotations[specHashAnnotation] = backupCronjob.ObjectMeta.Annotations[specHashAnnotation]
+	setCronJobSpec(cronJob, backupCronjob.Spec)
 
-	if updateCron {
-		if err := r.Update(context.Background(), cronJob); err != nil {
-			return ctrl.Result{}, err
-		}
+	if err := r.Update(context.Background(), cronJob); err != nil {
+		return ctrl.Result{}, err
 	}
 
+	r.updateConditions(policy, nil)
+
 	return ctrl.Result{}, nil
 }
 
+// policyPhase returns the type of the condition, and its reason, that
+// correspond to the status of the last backup of a policy. A policy is
+// not ready until its first backup completes.
+func policyPhase(backupStatus string) (string, string) {
+	switch backupStatus {
+	case "", "Initializing":
+		return kubedrv1alpha1.ConditionProgressing, "WaitingForBackup"
+
+	case "Completed":
+		return kubedrv1alpha1.ConditionReady, "BackupCompleted"
+
+	case "Failed":
+		return kubedrv1alpha1.ConditionFailed, "BackupFailed"
+
+	case "TimedOut":
+		return kubedrv1alpha1.ConditionFailed, "BackupTimedOut"
+	}
+
+	return kubedrv1alpha1.ConditionProgressing, "BackupInProgress"
+}
+
+// updateConditions sets the conditions of the policy as per the status of
+// the last backup, which is set by kubedrutil, or as per the error in
+// using the destination. The status is updated only if it changed.
+func (r *MetadataBackupPolicyReconciler) updateConditions(policy *kubedrv1alpha1.MetadataBackupPolicy,
+	destErr error) {
+
+	status := policy.Status.DeepCopy()
+	status.ObservedGeneration = policy.ObjectMeta.Generation
+
+	if destErr != nil {
+		kubedrv1alpha1.SetPhase(&status.Conditions, kubedrv1alpha1.ConditionFailed, status.ObservedGeneration,
+			"DestinationUnavailable", destErr.Error())
+	} else {
+		phase, reason := policyPhase(status.BackupStatus)
+		kubedrv1alpha1.SetPhase(&status.Conditions, phase, status.ObservedGeneration, reason,
+			status.BackupErrorMessage)
+	}
+
+	if reflect.DeepEqual(&policy.Status, status) {
+		return
+	}
+
+	policy.Status = *status
+	if err := r.Status().Update(context.Background(), policy); err != nil {
+		r.Log.Error(err, "unable to update policy status")
+	}
+}
+
 // We use information in "Status" field to export metrics.
 // Since reconcile can be called multiple times, we need a way to check
 // whether we already processed a given status. So after processing a
@@ -135,7 +216,9 @@ func (r *MetadataBackupPolicyReconciler) processStatus(policy *kubedrv1alpha1.Me
 
 	if exists && (processedBackupPod == currentBackupPod) {
 		r.Log.Info("Already processed the backup...")
-		return ctrl.Result{}, nil
+
+		// In case the history was overwritten without a new backup.
+		return ctrl.Result{}, r.syncHistory(policy, nil)
 	}
 
 	r.Log.Info("Processing the backup...")
@@ -157,8 +240,13 @@ func (r *MetadataBackupPolicyReconciler) processStatus(policy *kubedrv1alpha1.Me
 	} else {
 		// backup failed
 		r.MetricsInfo.RecordFailedBackup(policyName)
+
+		reportLockError(r.Client, policy.Namespace, policy.Spec.DestinationKind, policy.Spec.Destination,
+			policy.Status.BackupErrorMessage, time.Now(), r.Log)
 	}
 
+	r.recordRun(policy)
+
 	// Set the annotation
 	if policy.ObjectMeta.Annotations == nil {
 		policy.ObjectMeta.Annotations = make(map[string]string)
@@ -175,6 +263,113 @@ func (r *MetadataBackupPolicyReconciler) processStatus(policy *kubedrv1alpha1.Me
 	return ctrl.Result{}, nil
 }
 
+// recordRun adds the backup in the status to the history of the policy.
+// kubedrutil doesn't report when the backup started so it is taken from
+// the backup pod (or job), if it still exists.
+func (r *MetadataBackupPolicyReconciler) recordRun(policy *kubedrv1alpha1.MetadataBackupPolicy) {
+	run := kubedrv1alpha1.BackupRun{
+		CompletionTime: policy.Status.LastBackupTime,
+		Result:         "Failed",
+		ErrorMessage:   policy.Status.BackupErrorMessage,
+		Pod:            policy.Status.BackupPod,
+	}
+
+	if policy.Status.BackupStatus == "TimedOut" {
+		run.Result = "TimedOut"
+	} else if policy.Status.BackupStatus == "Completed" {
+		run.Result = "Completed"
+		run.SnapshotID = policy.Status.SnapshotID
+		run.DataAdded = policy.Status.DataAdded
+		run.DurationSecs = policy.Status.TotalDurationSecs
+	}
+
+	key := types.NamespacedName{Namespace: policy.Namespace, Name: policy.Status.BackupPod}
+
+	var pod corev1.Pod
+	var job batchv1.Job
+	if err := r.Get(context.Background(), key, &pod); err == nil {
+		run.StartTime = pod.Status.StartTime
+	} else if err := r.Get(context.Background(), key, &job); err == nil {
+		// The backup timed out. See processTimeouts().
+		run.StartTime = job.Status.StartTime
+	}
+
+	if err := r.syncHistory(policy, &run); err != nil {
+		r.Log.Error(err, "Error in updating the backup history, ignoring...")
+	}
+}
+
+// syncHistory sets the history in the status of the policy to the one kept
+// in its config map, which kubedrutil doesn't overwrite. If "run" is given,
+// it is added to the history first. Policies that don't have the config map
+// yet start with the history in their status.
+func (r *MetadataBackupPolicyReconciler) syncHistory(policy *kubedrv1alpha1.MetadataBackupPolicy,
+	run *kubedrv1alpha1.BackupRun) error {
+
+	ctx := context.Background()
+
+	history := policy.Status.BackupHistory.DeepCopy()
+	changed := false
+
+	var configMap corev1.ConfigMap
+	err := r.Get(ctx, types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name + historyConfigMapSuffix},
+		&configMap)
+	if err == nil {
+		if !metav1.IsControlledBy(&configMap, policy) {
+			return fmt.Errorf("config map %s exists and is not owned by the policy", configMap.Name)
+		}
+
+		history = &kubedrv1alpha1.BackupHistory{}
+		if data := configMap.Data[historyKey]; data != "" {
+			if err := json.Unmarshal([]byte(data), history); err != nil {
+				return err
+			}
+		}
+	} else if apierrors.IsNotFound(err) {
+		configMap = corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      policy.Name + historyConfigMapSuffix,
+				Namespace: policy.Namespace,
+			},
+		}
+		if err := ctrl.SetControllerReference(policy, &configMap, r.Scheme); err != nil {
+			return err
+		}
+		changed = true
+	} else {
+		return err
+	}
+
+	if run != nil {
+		history.RecordRun(*run)
+		changed = true
+	}
+
+	if changed {
+		data, err := json.Marshal(history)
+		if err != nil {
+			return err
+		}
+		configMap.Data = map[string]string{historyKey: string(data)}
+
+		if configMap.ObjectMeta.ResourceVersion == "" {
+			err = r.Create(ctx, &configMap)
+		} else {
+			err = r.Update(ctx, &configMap)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if reflect.DeepEqual(&policy.Status.BackupHistory, history) {
+		return nil
+	}
+
+	policy.Status.BackupHistory = *history
+	return r.Status().Update(ctx, policy)
+}
+
 // Process spec and make sure it matches status of the world.
 func (r *MetadataBackupPolicyReconciler) processSpecAndStatus(policy *kubedrv1alpha1.MetadataBackupPolicy,
 	namespace string) (ctrl.Result, error) {
@@ -199,13 +394,110 @@ func (r *MetadataBackupPolicyReconciler) processSpecAndStatus(policy *kubedrv1al
 		return result, err
 	}
 
+	if err := r.processTimeouts(policy); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	return r.processStatus(policy)
 }
 
+// jobDeadlineExceeded returns the condition of the job that says that it
+// failed because it ran longer than its deadline, if there is one.
+func jobDeadlineExceeded(job *batchv1.Job) *batchv1.JobCondition {
+	for i, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue &&
+			cond.Reason == "DeadlineExceeded" {
+			return &job.Status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+// processTimeouts reports a backup job that was stopped because it hit its
+// deadline. Its pods are killed so kubedrutil doesn't get to report the
+// result. The status is set as kubedrutil would, with the job in place of
+// the pod, so that processStatus() handles it like any other backup. Only
+// the latest finished job is considered as the status is that of the latest
+// backup. The status itself is not used to decide, as kubedrutil overwrites
+// it (and older versions don't set "lastBackupTime").
+func (r *MetadataBackupPolicyReconciler) processTimeouts(policy *kubedrv1alpha1.MetadataBackupPolicy) error {
+	var jobs batchv1.JobList
+	if err := r.List(context.Background(), &jobs, client.InNamespace(policy.Namespace),
+		client.MatchingLabels{"kubedr.type": "backup", "kubedr.backup-policy": policy.Name}); err != nil {
+		return err
+	}
+
+	var latest *batchv1.Job
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if jobFinished(job) && (latest == nil || latest.CreationTimestamp.Before(&job.CreationTimestamp)) {
+			latest = job
+		}
+	}
+
+	if latest == nil {
+		return nil
+	}
+
+	if _, manual := latest.Labels["kubedr.manual-backup"]; manual {
+		// Reported in the status of the MetadataBackup.
+		return nil
+	}
+
+	cond := jobDeadlineExceeded(latest)
+	if cond == nil || policy.ObjectMeta.Annotations[reportedTimeoutAnnotation] == latest.Name {
+		return nil
+	}
+	timedOut, timedOutAt := latest, cond.LastTransitionTime
+
+	r.Log.Info("Backup job timed out", "job", timedOut.Name)
+
+	// Only the result of the backup is set, as kubedrutil would. The rest
+	// (such as the snapshot of the last successful backup, hook results and
+	// the history) is kept.
+	status := policy.Status.DeepCopy()
+	status.BackupTime = timedOutAt.String()
+	status.LastBackupTime = &timedOutAt
+	status.BackupStatus = "TimedOut"
+	status.BackupErrorMessage = timedOutMessage(timedOut)
+	status.BackupPod = timedOut.Name
+
+	phase, reason := policyPhase(status.BackupStatus)
+	kubedrv1alpha1.SetPhase(&status.Conditions, phase, status.ObservedGeneration, reason,
+		status.BackupErrorMessage)
+
+	policy.Status = *status
+	if err := r.Status().Update(context.Background(), policy); err != nil {
+		return err
+	}
+
+	if policy.ObjectMeta.Annotations == nil {
+		policy.ObjectMeta.Annotations = make(map[string]string)
+	}
+	policy.ObjectMeta.Annotations[reportedTimeoutAnnotation] = timedOut.Name
+
+	return r.Update(context.Background(), policy)
+}
+
+// timedOutMessage returns the error message for a job that hit its deadline.
+func timedOutMessage(job *batchv1.Job) string {
+	if job.Spec.ActiveDeadlineSeconds == nil {
+		return fmt.Sprintf("Backup job %s exceeded its deadline", job.Name)
+	}
+
+	return fmt.Sprintf("Backup job %s exceeded its deadline of %d seconds", job.Name,
+		*job.Spec.ActiveDeadlineSeconds)
+}
+
 func (r *MetadataBackupPolicyReconciler) setStatus(policy *kubedrv1alpha1.MetadataBackupPolicy) {
 	policy.Status.MBRName = ""
 	policy.Status.BackupStatus = "Initializing"
 	policy.Status.BackupTime = metav1.Now().String()
+	policy.Status.ObservedGeneration = policy.ObjectMeta.Generation
+
+	phase, reason := policyPhase(policy.Status.BackupStatus)
+	kubedrv1alpha1.SetPhase(&policy.Status.Conditions, phase, policy.ObjectMeta.Generation, reason, "")
 
 	r.Log.Info("Updating status...")
 	if err := r.Status().Update(context.Background(), policy); err != nil {
@@ -217,6 +509,8 @@ func (r *MetadataBackupPolicyReconciler) setStatus(policy *kubedrv1alpha1.Metada
 // +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=metadatabackuppolicies/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=create;get;list;update;patch;delete;watch
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=create;get;list;update;patch;delete;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
 
 // Reconcile is the the main entry point called by the framework.
 func (r *MetadataBackupPolicyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
@@ -267,11 +561,96 @@ func (r *MetadataBackupPolicyReconciler) Reconcile(req ctrl.Request) (ctrl.Resul
 	return r.processSpecAndStatus(&policy, req.Namespace)
 }
 
+// policyForJob returns a request for the policy of a backup job. Jobs are
+// owned by the cronjob, not by the policy.
+func policyForJob(obj handler.MapObject) []reconcile.Request {
+	labels := obj.Meta.GetLabels()
+	if labels["kubedr.type"] != "backup" || labels["kubedr.backup-policy"] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Namespace: obj.Meta.GetNamespace(),
+		Name:      labels["kubedr.backup-policy"],
+	}}}
+}
+
+// destinationIndexKey returns the key under which policies are indexed by
+// their destination.
+func destinationIndexKey(kind string, name string) string {
+	if kind == kubedrv1alpha1.KindClusterBackupLocation {
+		return kind + "/" + name
+	}
+
+	return name
+}
+
+// policiesForBackupLocation returns requests for all the policies that
+// store backups in the given BackupLocation. For the BackupLocation of a
+// ClusterBackupLocation, these are the policies, in all namespaces, that
+// use the ClusterBackupLocation.
+func (r *MetadataBackupPolicyReconciler) policiesForBackupLocation(obj handler.MapObject) []reconcile.Request {
+	if clusterLocName, ok := obj.Meta.GetLabels()[kubedrv1alpha1.ClusterBackupLocationLabel]; ok {
+		return r.policiesForDestination(kubedrv1alpha1.KindClusterBackupLocation, clusterLocName)
+	}
+
+	return r.policiesForDestination(kubedrv1alpha1.KindBackupLocation, obj.Meta.GetName(),
+		client.InNamespace(obj.Meta.GetNamespace()))
+}
+
+// policiesForClusterBackupLocation returns requests for all the policies
+// that use the given ClusterBackupLocation.
+func (r *MetadataBackupPolicyReconciler) policiesForClusterBackupLocation(obj handler.MapObject) []reconcile.Request {
+	return r.policiesForDestination(kubedrv1alpha1.KindClusterBackupLocation, obj.Meta.GetName())
+}
+
+func (r *MetadataBackupPolicyReconciler) policiesForDestination(kind string, name string,
+	opts ...client.ListOption) []reconcile.Request {
+
+	opts = append(opts, client.MatchingFields{"destination": destinationIndexKey(kind, name)})
+
+	var policyList kubedrv1alpha1.MetadataBackupPolicyList
+	if err := r.List(context.Background(), &policyList, opts...); err != nil {
+		r.Log.Error(err, "unable to list policies", "backuploc", name)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, policy := range policyList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name},
+		})
+	}
+
+	return requests
+}
+
 // SetupWithManager hooks up this controller with the manager.
 func (r *MetadataBackupPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(&kubedrv1alpha1.MetadataBackupPolicy{},
+		"destination", func(rawObj runtime.Object) []string {
+			policy := rawObj.(*kubedrv1alpha1.MetadataBackupPolicy)
+
+			return []string{destinationIndexKey(policy.Spec.DestinationKind, policy.Spec.Destination)}
+		}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubedrv1alpha1.MetadataBackupPolicy{}).
 		Owns(&batchv1beta1.CronJob{}).
+		Watches(&source.Kind{Type: &batchv1.Job{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(policyForJob),
+			}).
+		Watches(&source.Kind{Type: &kubedrv1alpha1.BackupLocation{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.policiesForBackupLocation),
+			}).
+		Watches(&source.Kind{Type: &kubedrv1alpha1.ClusterBackupLocation{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.policiesForClusterBackupLocation),
+			}).
 		Complete(r)
 }
 
@@ -336,11 +715,6 @@ func (r *MetadataBackupPolicyReconciler) getMasterNodeLabelName(policy *kubedrv1
 func (r *MetadataBackupPolicyReconciler) buildBackupCronjob(cr *kubedrv1alpha1.MetadataBackupPolicy,
 	namespace string, cronJobName string) (*batchv1beta1.CronJob, error) {
 
-	labels := map[string]string{
-		"kubedr.type":          "backup",
-		"kubedr.backup-policy": cr.Name,
-	}
-
 	kubedrUtilImage := os.Getenv("KUBEDR_UTIL_IMAGE")
 	if kubedrUtilImage == "" {
 		// This should really not happen.
@@ -350,27 +724,22 @@ func (r *MetadataBackupPolicyReconciler) buildBackupCronjob(cr *kubedrv1alpha1.M
 	}
 	r.Log.V(1).Info(fmt.Sprintf("kubedrUtilImage: %s", kubedrUtilImage))
 
-	backupLocation := &kubedrv1alpha1.BackupLocation{}
-	backupLocKey := types.NamespacedName{Namespace: namespace, Name: cr.Spec.Destination}
-	err := r.Get(context.TODO(), backupLocKey, backupLocation)
+	backupLocation, err := backupLocationFor(r.Client, r.Scheme, namespace, cr.Spec.DestinationKind,
+		cr.Spec.Destination)
 	if err != nil {
 		// If the error is "not found", there is no point in retrying.
 		return nil, err
 	}
 
-	s3EndPoint := "s3:" + backupLocation.Spec.Url + "/" + backupLocation.Spec.BucketName
-
-	accessKey := corev1.SecretKeySelector{}
-	accessKey.Name = backupLocation.Spec.Credentials
-	accessKey.Key = "access_key"
-
-	secretKey := corev1.SecretKeySelector{}
-	secretKey.Name = backupLocation.Spec.Credentials
-	secretKey.Key = "secret_key"
+	labels := mergeLabels(map[string]string{
+		"kubedr.type":          "backup",
+		"kubedr.backup-policy": cr.Name,
+	}, locationLabels(backupLocation, false))
 
-	resticPassword := corev1.SecretKeySelector{}
-	resticPassword.Name = backupLocation.Spec.Credentials
-	resticPassword.Key = "restic_repo_password"
+	driver, err := engine.New(backupLocation, kubedrUtilImage)
+	if err != nil {
+		return nil, err
+	}
 
 	targetDirVolume := corev1.Volume{Name: "target-dir"}
 	targetDirVolume.EmptyDir = &corev1.EmptyDirVolumeSource{}
@@ -384,34 +753,11 @@ func (r *MetadataBackupPolicyReconciler) buildBackupCronjob(cr *kubedrv1alpha1.M
 		targetDirVolume,
 		etcdCredsVolume,
 	}
+	volumes = append(volumes, driver.Volumes()...)
+
+	backupContainer := driver.BackupContainer(cr.Name+"-kcx-backup", "/data")
 
 	env := []corev1.EnvVar{
-		{
-			Name: "MY_POD_NAME",
-			ValueFrom: &corev1.EnvVarSource{
-				FieldRef: &corev1.ObjectFieldSelector{
-					FieldPath: "metadata.name",
-				},
-			},
-		},
-		{
-			Name: "AWS_ACCESS_KEY",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &accessKey,
-			},
-		},
-		{
-			Name: "AWS_SECRET_KEY",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &secretKey,
-			},
-		},
-		{
-			Name: "RESTIC_PASSWORD",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &resticPassword,
-			},
-		},
 		{
 			Name:  "KDR_POLICY_NAME",
 			Value: cr.Name,
@@ -428,14 +774,6 @@ func (r *MetadataBackupPolicyReconciler) buildBackupCronjob(cr *kubedrv1alpha1.M
 			Name:  "ETCD_SNAP_PATH",
 			Value: "/data/etcd-snapshot.db",
 		},
-		{
-			Name:  "RESTIC_REPO",
-			Value: s3EndPoint,
-		},
-		{
-			Name:  "BACKUP_SRC",
-			Value: "/data",
-		},
 	}
 
 	volumeMounts := []corev1.VolumeMount{
@@ -468,9 +806,37 @@ func (r *MetadataBackupPolicyReconciler) buildBackupCronjob(cr *kubedrv1alpha1.M
 		env = append(env, corev1.EnvVar{Name: "CERTS_SRC_DIR", Value: "/certs_dir"})
 	}
 
+	if verify := cr.Spec.Verify; verify != nil {
+		backupContainer.Env = append(backupContainer.Env, corev1.EnvVar{Name: "KDR_VERIFY_SNAPSHOT", Value: "true"})
+
+		if verify.Restore {
+			volumes = append(volumes, corev1.Volume{
+				Name:         "verify-scratch",
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			})
+			backupContainer.VolumeMounts = append(backupContainer.VolumeMounts,
+				corev1.VolumeMount{Name: "verify-scratch", MountPath: "/verify"})
+			backupContainer.Env = append(backupContainer.Env,
+				corev1.EnvVar{Name: "KDR_VERIFY_RESTORE_DIR", Value: "/verify"})
+		}
+	}
+
+	backupContainer.Env = append(backupContainer.Env, env...)
+	backupContainer.VolumeMounts = append(backupContainer.VolumeMounts, volumeMounts...)
+
+	var initContainers []corev1.Container
+	containers := []corev1.Container{backupContainer}
+	if cr.Spec.Hooks != nil {
+		volumes = append(volumes, corev1.Volume{
+			Name:         "hooks-util",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		initContainers, containers = hookContainers(cr, kubedrUtilImage, backupContainer, env, volumeMounts)
+	}
+
 	masterNodeLabelName := r.getMasterNodeLabelName(cr)
 
-	return &batchv1beta1.CronJob{
+	cronJob := &batchv1beta1.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cronJobName,
 			Namespace: cr.Namespace,
@@ -478,17 +844,24 @@ func (r *MetadataBackupPolicyReconciler) buildBackupCronjob(cr *kubedrv1alpha1.M
 		},
 
 		Spec: batchv1beta1.CronJobSpec{
-			ConcurrencyPolicy: "Forbid",
-			Schedule:          cr.Spec.Schedule,
-			Suspend:           cr.Spec.Suspend,
+			ConcurrencyPolicy:          "Forbid",
+			Schedule:                   cr.Spec.Schedule,
+			Suspend:                    cr.Spec.Suspend,
+			StartingDeadlineSeconds:    cr.Spec.StartingDeadlineSeconds,
+			SuccessfulJobsHistoryLimit: cr.Spec.SuccessfulJobsHistoryLimit,
+			FailedJobsHistoryLimit:     cr.Spec.FailedJobsHistoryLimit,
 
 			JobTemplate: batchv1beta1.JobTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      cr.Name + "-backup-job",
 					Namespace: cr.Namespace,
+					// Used to find the jobs of the policy.
+					Labels: labels,
 				},
 				Spec: batchv1.JobSpec{
-					// TODO: Set backoffLimit to 2.
+					BackoffLimit:          cr.Spec.BackoffLimit,
+					ActiveDeadlineSeconds: cr.Spec.ActiveDeadlineSeconds,
+
 					Template: corev1.PodTemplateSpec{
 						ObjectMeta: metav1.ObjectMeta{
 							Name:      cr.Name + "-backup-pod-template",
@@ -527,22 +900,76 @@ func (r *MetadataBackupPolicyReconciler) buildBackupCronjob(cr *kubedrv1alpha1.M
 
 							Volumes: volumes,
 
-							Containers: []corev1.Container{
-								{
-									Name:         cr.Name + "-kcx-backup",
-									Image:        kubedrUtilImage,
-									VolumeMounts: volumeMounts,
-									Env:          env,
-
-									Args: []string{
-										"/usr/local/bin/kubedrutil", "backup",
-									},
-								},
-							},
+							InitContainers: initContainers,
+							Containers:     containers,
 						},
 					},
 				},
 			},
 		},
-	}, nil
+	}
+
+	podTemplate := &cronJob.Spec.JobTemplate.Spec.Template
+	if err := kubedrv1alpha1.ApplyPodTemplate(podTemplate, cr.Spec.PodTemplate); err != nil {
+		return nil, err
+	}
+
+	// Used to detect changes that need the cronjob to be updated.
+	cronJob.ObjectMeta.Annotations = map[string]string{specHashAnnotation: hashObject(cronJob.Spec)}
+
+	return cronJob, nil
+}
+
+// hookContainers returns the init containers and the containers of a backup
+// pod with hooks. Hooks need to run one after the other, before or after
+// the backup, so all but the last of them are init containers. The hooks
+// get the same environment and volumes as the backup container.
+func hookContainers(cr *kubedrv1alpha1.MetadataBackupPolicy, kubedrUtilImage string,
+	backupContainer corev1.Container, env []corev1.EnvVar,
+	volumeMounts []corev1.VolumeMount) ([]corev1.Container, []corev1.Container) {
+
+	utilDir := "/kubedr_hooks"
+	utilMount := corev1.VolumeMount{Name: "hooks-util", MountPath: utilDir}
+
+	installContainer := engine.InstallUtilContainer("hooks-install", kubedrUtilImage, utilDir)
+	installContainer.VolumeMounts = append(installContainer.VolumeMounts, utilMount)
+
+	hookContainer := func(hook kubedrv1alpha1.BackupHook, phase string) corev1.Container {
+		// Defaults are normally set by the webhook.
+		timeoutSeconds := int64(300)
+		if hook.TimeoutSeconds != nil {
+			timeoutSeconds = *hook.TimeoutSeconds
+		}
+
+		onError := hook.OnError
+		if onError == "" {
+			onError = kubedrv1alpha1.HookOnErrorFail
+		}
+
+		hookEnv := append([]corev1.EnvVar{
+			{Name: "KDR_POLICY_NAME", Value: cr.Name},
+			{Name: "KDR_HOOK_NAME", Value: hook.Name},
+			{Name: "KDR_HOOK_PHASE", Value: phase},
+			{Name: "KDR_HOOK_ON_ERROR", Value: onError},
+			{Name: "KDR_HOOK_TIMEOUT_SECONDS", Value: fmt.Sprintf("%d", timeoutSeconds)},
+		}, env...)
+		hookEnv = append(hookEnv, hook.Env...)
+
+		container := engine.HookContainer("hook-"+hook.Name, hook.Image, utilDir, hook.Command, hookEnv)
+		container.VolumeMounts = append(append(container.VolumeMounts, volumeMounts...), utilMount)
+
+		return container
+	}
+
+	ordered := []corev1.Container{installContainer}
+	for _, hook := range cr.Spec.Hooks.Pre {
+		ordered = append(ordered, hookContainer(hook, kubedrv1alpha1.HookPhasePre))
+	}
+	ordered = append(ordered, backupContainer)
+	for _, hook := range cr.Spec.Hooks.Post {
+		ordered = append(ordered, hookContainer(hook, kubedrv1alpha1.HookPhasePost))
+	}
+
+	last := len(ordered) - 1
+	return ordered[:last], ordered[last:]
 }
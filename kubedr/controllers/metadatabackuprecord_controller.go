@@ -20,17 +20,22 @@ import (
 	"context"
 	"fmt"
 	"k8s.io/apimachinery/pkg/types"
+	"os"
 	"sort"
+	"strings"
+	"time"
 
 	//	batchv1 "k8s.io/api/batch/v1"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
 )
 
 // MetadataBackupRecordReconciler reconciles a MetadataBackupRecord object
@@ -44,6 +49,19 @@ type MetadataBackupRecordReconciler struct {
 // +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=metadatabackuprecords/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=create;get;list;update;patch;delete;watch
 
+const (
+	snapDeletionPodLabel = "kubedr.catalogicsoftware.com/snap-deletion-pod"
+	replicationPodLabel  = "kubedr.catalogicsoftware.com/replication-pod"
+
+	// Comma separated list of locations to which a snapshot has been
+	// replicated.
+	replicatedToAnnotation = "replicated-to.annotations.kubedr.catalogicsoftware.com"
+
+	// Number of pods started to copy a snapshot to a replica before
+	// giving up.
+	maxReplicationAttempts = 3
+)
+
 // Reconcile is the the main entry point called by the framework.
 func (r *MetadataBackupRecordReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -89,72 +107,149 @@ func (r *MetadataBackupRecordReconciler) Reconcile(req ctrl.Request) (ctrl.Resul
 		return ctrl.Result{}, nil
 	}
 
-	var policy kubedrv1alpha1.MetadataBackupPolicy
-	log.Info("Getting policy...")
-	if err := r.Get(ctx,
-		types.NamespacedName{Namespace: req.Namespace, Name: record.Spec.Policy},
-		&policy); err != nil {
+	// A record is only created once its snapshot is available.
+	if kubedrv1alpha1.FindCondition(record.Status.Conditions, kubedrv1alpha1.ConditionReady) == nil {
+		record.Status.ObservedGeneration = record.ObjectMeta.Generation
+		kubedrv1alpha1.SetPhase(&record.Status.Conditions, kubedrv1alpha1.ConditionReady,
+			record.ObjectMeta.Generation, "SnapshotAvailable", "")
+		if err := r.Status().Update(ctx, &record); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
-		log.Error(err, "unable to fetch MetadataBackupPolicy, no retention processing")
+	log.Info("Getting policy...")
+	policy, err := r.recordPolicy(&record)
+	if err != nil {
+		log.Error(err, "unable to fetch policy, no retention processing")
 		// we'll ignore not-found errors, since they can't be fixed by an immediate
 		// requeue (we'll need to wait for a new notification).
 		return ctrl.Result{}, ignoreNotFound(err)
 	}
 
+	// Replication and deletion of snapshots wait while an operation that
+	// needs exclusive access to the repo is in progress.
+	var requeueAfter time.Duration
+
+	if record.Spec.ReplicaOf == "" && len(policy.Spec.Replicas) > 0 {
+		busy, err := r.replicate(&record, policy, log)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if busy {
+			requeueAfter = repoBusyRetryInterval
+		}
+	}
+
+	// Retention is applied separately at each location. Replicas of a
+	// snapshot are not deleted along with it.
+	backupLocKind, backupLocName := recordLocation(&record, policy)
+
+	retained := policyRetention(&policy.Spec, time.Now())
+	for _, replica := range policy.Spec.Replicas {
+		if backupLocKind == kubedrv1alpha1.KindBackupLocation && replica.Destination == backupLocName &&
+			replica.RetainNumBackups != nil {
+			retained = countRetention(*replica.RetainNumBackups)
+		}
+	}
+
 	// Now, make sure spec matches the status of world.
 	log.Info("Getting MBR list...")
 	var mbrList kubedrv1alpha1.MetadataBackupRecordList
 	if err := r.List(ctx, &mbrList, client.InNamespace(req.Namespace),
-		client.MatchingFields{"policy": record.Spec.Policy}); err != nil {
+		client.MatchingFields{"policy": policyIndexKey(record.Spec.PolicyKind, record.Spec.Policy)}); err != nil {
 
 		log.Error(err, "unable to list child Jobs")
 		return ctrl.Result{}, err
 	}
 
-	log.Info(fmt.Sprintf("Number of MBR entries: %d", len(mbrList.Items)))
+	// Records that are being deleted were already processed. Events of our
+	// pods can bring us here again before the cache catches up.
+	var records []kubedrv1alpha1.MetadataBackupRecord
+	for i := range mbrList.Items {
+		if !mbrList.Items[i].ObjectMeta.DeletionTimestamp.IsZero() {
+			continue
+		}
 
-	sort.Slice(mbrList.Items, func(i, j int) bool {
-		return mbrList.Items[i].ObjectMeta.CreationTimestamp.Before(&mbrList.Items[j].ObjectMeta.CreationTimestamp)
+		if itemKind, itemLoc := recordLocation(&mbrList.Items[i], policy); itemKind == backupLocKind &&
+			itemLoc == backupLocName {
+			records = append(records, mbrList.Items[i])
+		}
+	}
+
+	log.Info(fmt.Sprintf("Number of MBR entries: %d", len(records)), "backuploc", backupLocName)
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ObjectMeta.CreationTimestamp.Before(&records[j].ObjectMeta.CreationTimestamp)
 	})
 
-	log.Info(fmt.Sprintf("retention: %d", *policy.Spec.RetainNumBackups))
+	expired := expiredRecords(records, retained)
+	log.Info(fmt.Sprintf("Number of expired MBR entries: %d", len(expired)))
 
-	if int64(len(mbrList.Items)) <= *policy.Spec.RetainNumBackups {
-		log.Info("Number of backups is less than retention...")
-		return ctrl.Result{}, nil
+	// Failures of earlier deletions are checked even if nothing needs to
+	// be deleted now.
+	r.reportSnapDeletionFailures(req.Namespace, log)
+
+	if len(expired) == 0 {
+		log.Info("No backups to delete as per retention...")
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
 
-	backupLoc := &kubedrv1alpha1.BackupLocation{}
-	backupLocKey := types.NamespacedName{Namespace: req.Namespace, Name: policy.Spec.Destination}
-	err := r.Get(context.TODO(), backupLocKey, backupLoc)
+	backupLoc, err := backupLocationFor(r.Client, r.Scheme, req.Namespace, backupLocKind, backupLocName)
 	if err != nil {
 		// If the error is "not found", there is no point in retrying.
 		return ctrl.Result{}, err
 	}
 
+	operation, err := repoBusy(r.Client, req.Namespace, locationLabels(backupLoc, false))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if operation != "" {
+		log.Info("Repo is busy, will delete expired backups later", "operation", operation)
+		return ctrl.Result{RequeueAfter: repoBusyRetryInterval}, nil
+	}
+
+	// Snapshots that are still locked are kept until the lock expires, at
+	// which point we need to be called again.
+	now := time.Now()
+
 	// There are some snapshots that need to be deleted.
-	for i := 0; int64(i) < (int64(len(mbrList.Items)) - *policy.Spec.RetainNumBackups); i++ {
-		log.Info("Need to delete: " + mbrList.Items[i].Spec.SnapshotId)
+	records = expired
+	for i := range records {
+		if lockedUntil := recordLockedUntil(&records[i], backupLoc); lockedUntil.After(now) {
+			log.Info("Snapshot is locked, not deleting it", "snapshot", records[i].Spec.SnapshotId,
+				"lockedUntil", lockedUntil)
+			r.setHeldCondition(&records[i], lockedUntil, log)
+
+			if wait := lockedUntil.Sub(now); requeueAfter == 0 || wait < requeueAfter {
+				requeueAfter = wait
+			}
+			continue
+		}
+
+		log.Info("Need to delete: " + records[i].Spec.SnapshotId)
 
 		// Delete the record first.
-		if err := r.Delete(ctx, &mbrList.Items[i]); ignoreNotFound(err) != nil {
-			log.Error(err, "unable to delete mbr", "mbr", mbrList.Items[i])
+		if err := r.Delete(ctx, &records[i]); ignoreNotFound(err) != nil {
+			log.Error(err, "unable to delete mbr", "mbr", records[i])
 		} else {
-			log.V(0).Info("deleted mbr", "mbr", mbrList.Items[i])
+			log.V(0).Info("deleted mbr", "mbr", records[i])
 		}
 
-		pod, err := createResticSnapDeletePod(backupLoc, log, mbrList.Items[i].Spec.SnapshotId,
-			mbrList.Items[i].Name, mbrList.Items[i].Namespace)
+		pod, err := createSnapDeletePod(backupLoc, log, records[i].Spec.SnapshotId,
+			records[i].Name, records[i].Namespace)
 
 		if err != nil {
 			log.Error(err, "Error in creating snapshot deletion pod")
 			return ctrl.Result{}, err
 		}
 
-		// Delete restic snapshot
+		// Delete the snapshot from the repo. The pod may already exist if
+		// the record was processed before but still shows up as expired.
 		log.Info("Starting a new Pod", "Pod.Namespace", pod.Namespace, "Pod.Name", pod.Name)
-		err = r.Create(ctx, pod)
-		if err != nil {
+		if err := ignoreErrors(r.Create(ctx, pod)); err != nil {
 			log.Error(err, "Error in starting snap delete pod")
 			return ctrl.Result{}, err
 		}
@@ -163,22 +258,214 @@ func (r *MetadataBackupRecordReconciler) Reconcile(req ctrl.Request) (ctrl.Resul
 	// Keep last 3 snap deletetion pods and clean up the rest.
 	// Make this number configurable. We need global options. This is not related
 	// to individual policies.
-	r.cleanupOldSnapDeletionPods(req.Namespace, log)
+	r.cleanupOldPods(req.Namespace, snapDeletionPodLabel, false, log)
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
-func (r *MetadataBackupRecordReconciler) cleanupOldSnapDeletionPods(namespace string, log logr.Logger) {
+// retentionFunc returns, for each of the given creation times of
+// backups, whether the backup is kept.
+type retentionFunc func(created []time.Time) []bool
+
+// policyRetention returns the retention of the given policy. Retention
+// rules take precedence over "retainWithin", which in turn takes precedence
+// over "retainNumBackups".
+func policyRetention(spec *kubedrv1alpha1.MetadataBackupPolicySpec, now time.Time) retentionFunc {
+	if spec.Retention != nil {
+		return spec.Retention.Retained
+	}
+
+	if spec.RetainWithin != nil {
+		minimum := int64(1)
+		if spec.RetainMinBackups != nil {
+			minimum = *spec.RetainMinBackups
+		}
+
+		return func(created []time.Time) []bool {
+			return kubedrv1alpha1.RetainedWithin(created, now, spec.RetainWithin.Duration, minimum)
+		}
+	}
+
+	return countRetention(*spec.RetainNumBackups)
+}
+
+// countRetention keeps the latest "retainNumBackups" backups.
+func countRetention(retainNumBackups int64) retentionFunc {
+	retention := &kubedrv1alpha1.RetentionPolicy{KeepLast: retainNumBackups}
+	return retention.Retained
+}
+
+// expiredRecords returns the records, in the given order, that are not
+// kept by the retention.
+func expiredRecords(records []kubedrv1alpha1.MetadataBackupRecord,
+	retained retentionFunc) []kubedrv1alpha1.MetadataBackupRecord {
+
+	created := make([]time.Time, len(records))
+	for i := range records {
+		created[i] = records[i].ObjectMeta.CreationTimestamp.Time
+	}
+
+	var expired []kubedrv1alpha1.MetadataBackupRecord
+	for i, keep := range retained(created) {
+		if !keep {
+			expired = append(expired, records[i])
+		}
+	}
+
+	return expired
+}
+
+// policyIndexKey returns the key under which records are indexed by the
+// policy that created them.
+func policyIndexKey(kind string, name string) string {
+	if kind == kubedrv1alpha1.KindResourceBackupPolicy {
+		return kind + "/" + name
+	}
+
+	return name
+}
+
+// recordPolicy returns the policy that created the given record. Records
+// of a ResourceBackupPolicy are processed in the same way, so it is
+// returned as a MetadataBackupPolicy with the fields used here.
+func (r *MetadataBackupRecordReconciler) recordPolicy(
+	record *kubedrv1alpha1.MetadataBackupRecord) (*kubedrv1alpha1.MetadataBackupPolicy, error) {
+
+	key := types.NamespacedName{Namespace: record.Namespace, Name: record.Spec.Policy}
+
+	if record.Spec.PolicyKind != kubedrv1alpha1.KindResourceBackupPolicy {
+		var policy kubedrv1alpha1.MetadataBackupPolicy
+		if err := r.Get(context.Background(), key, &policy); err != nil {
+			return nil, err
+		}
+
+		return &policy, nil
+	}
+
+	var resourcePolicy kubedrv1alpha1.ResourceBackupPolicy
+	if err := r.Get(context.Background(), key, &resourcePolicy); err != nil {
+		return nil, err
+	}
+
+	return &kubedrv1alpha1.MetadataBackupPolicy{
+		ObjectMeta: resourcePolicy.ObjectMeta,
+		Spec: kubedrv1alpha1.MetadataBackupPolicySpec{
+			Destination:      resourcePolicy.Spec.Destination,
+			DestinationKind:  resourcePolicy.Spec.DestinationKind,
+			RetainNumBackups: resourcePolicy.Spec.RetainNumBackups,
+		},
+	}, nil
+}
+
+// recordLocation returns the kind and the name of the location of the
+// snapshot of the given record.
+func recordLocation(record *kubedrv1alpha1.MetadataBackupRecord,
+	policy *kubedrv1alpha1.MetadataBackupPolicy) (string, string) {
+
+	// Records created by earlier versions don't have the location.
+	if record.Spec.Backuploc == "" {
+		if policy.Spec.UsesClusterBackupLocation() {
+			return kubedrv1alpha1.KindClusterBackupLocation, policy.Spec.Destination
+		}
+		return kubedrv1alpha1.KindBackupLocation, policy.Spec.Destination
+	}
+
+	if record.Spec.BackuplocKind == kubedrv1alpha1.KindClusterBackupLocation {
+		return kubedrv1alpha1.KindClusterBackupLocation, record.Spec.Backuploc
+	}
+	return kubedrv1alpha1.KindBackupLocation, record.Spec.Backuploc
+}
+
+// recordLockedUntil returns the time until which the snapshot of the given
+// record can't be deleted because of S3 Object Lock. It is zero if the
+// snapshot is not locked.
+func recordLockedUntil(record *kubedrv1alpha1.MetadataBackupRecord,
+	backupLoc *kubedrv1alpha1.BackupLocation) time.Time {
+
+	if record.Spec.LockedUntil != nil {
+		return record.Spec.LockedUntil.Time
+	}
+
+	// Records created before the lock time was recorded.
+	if lock := backupLoc.Spec.ObjectLock; lock != nil {
+		return record.ObjectMeta.CreationTimestamp.Add(time.Duration(lock.RetentionDays) * 24 * time.Hour)
+	}
+
+	return time.Time{}
+}
+
+// setHeldCondition reports that the snapshot of the given record is due to
+// be deleted but is held because it is locked.
+func (r *MetadataBackupRecordReconciler) setHeldCondition(record *kubedrv1alpha1.MetadataBackupRecord,
+	lockedUntil time.Time, log logr.Logger) {
+
+	cond := kubedrv1alpha1.FindCondition(record.Status.Conditions, kubedrv1alpha1.MetadataBackupRecordHeld)
+	if cond != nil && cond.Status == metav1.ConditionTrue {
+		return
+	}
+
+	kubedrv1alpha1.SetCondition(&record.Status.Conditions, kubedrv1alpha1.Condition{
+		Type:               kubedrv1alpha1.MetadataBackupRecordHeld,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: record.ObjectMeta.Generation,
+		Reason:             "ObjectLocked",
+		Message:            "Snapshot is locked until " + lockedUntil.UTC().Format(time.RFC3339),
+	})
+
+	if err := r.Status().Update(context.Background(), record); err != nil {
+		log.Error(err, "unable to update mbr status", "mbr", record.Name)
+	}
+}
+
+// reportSnapDeletionFailures checks if any of the snapshot deletion pods
+// failed because the repo is locked. This is done before the old pods are
+// cleaned up so that their failures are not missed.
+func (r *MetadataBackupRecordReconciler) reportSnapDeletionFailures(namespace string, log logr.Logger) {
+	var podList corev1.PodList
+	if err := r.List(context.Background(), &podList, client.InNamespace(namespace),
+		client.MatchingLabels{snapDeletionPodLabel: "true"}); err != nil {
+		log.Error(err, "unable to list pods", "label", snapDeletionPodLabel)
+		return
+	}
+
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		kind, backupLocName := podLocation(pod)
+
+		// Pods created by earlier versions don't have the label.
+		if pod.Status.Phase != corev1.PodFailed || backupLocName == "" {
+			continue
+		}
+
+		reportLockError(r.Client, namespace, kind, backupLocName, podFailureMessage(pod), podFinishTime(pod), log)
+	}
+}
+
+// cleanupOldPods deletes all but the last 3 pods that have the given label.
+// If "succeededOnly" is set, other pods are neither deleted nor counted.
+func (r *MetadataBackupRecordReconciler) cleanupOldPods(namespace string, podLabel string, succeededOnly bool,
+	log logr.Logger) {
+
 	ctx := context.Background()
 
 	var podList corev1.PodList
 	if err := r.List(ctx, &podList, client.InNamespace(namespace),
-		client.MatchingLabels{"kubedr.catalogicsoftware.com/snap-deletion-pod": "true"}); err != nil {
-		log.Error(err, "unable to list snap deletion pods")
+		client.MatchingLabels{podLabel: "true"}); err != nil {
+		log.Error(err, "unable to list pods", "label", podLabel)
 		return
 	}
 
-	log.Info(fmt.Sprintf("Number of snap deletion pods: %d", len(podList.Items)))
+	if succeededOnly {
+		pods := podList.Items[:0]
+		for _, pod := range podList.Items {
+			if pod.Status.Phase == corev1.PodSucceeded {
+				pods = append(pods, pod)
+			}
+		}
+		podList.Items = pods
+	}
+
+	log.Info(fmt.Sprintf("Number of pods with label %s: %d", podLabel, len(podList.Items)))
 
 	sort.Slice(podList.Items, func(i, j int) bool {
 		return podList.Items[i].ObjectMeta.CreationTimestamp.Before(&podList.Items[j].ObjectMeta.CreationTimestamp)
@@ -198,6 +485,218 @@ func (r *MetadataBackupRecordReconciler) cleanupOldSnapDeletionPods(namespace st
 	}
 }
 
+// replicate starts a pod to copy the snapshot of the given record to each
+// replica of the policy, unless it is already done. "kubedrutil" creates a
+// MetadataBackupRecord for each copy, which in turn will trigger retention
+// processing at the replica location. A replica is only recorded as done
+// once that record exists. Failed pods are kept, to be deleted along with
+// the record, and retried up to "maxReplicationAttempts" times. It returns
+// true if a pod could not be started because a repo is busy.
+func (r *MetadataBackupRecordReconciler) replicate(record *kubedrv1alpha1.MetadataBackupRecord,
+	policy *kubedrv1alpha1.MetadataBackupPolicy, log logr.Logger) (bool, error) {
+
+	ctx := context.Background()
+
+	var replicatedTo []string
+	if value := record.ObjectMeta.Annotations[replicatedToAnnotation]; value != "" {
+		replicatedTo = strings.Split(value, ",")
+	}
+
+	srcLocKind, srcLocName := recordLocation(record, policy)
+
+	var pending []string
+	for _, replica := range policy.Spec.Replicas {
+		if !containsString(replicatedTo, replica.Destination) {
+			pending = append(pending, replica.Destination)
+		}
+	}
+
+	if len(pending) == 0 {
+		return false, nil
+	}
+
+	copies, err := r.replicaRecords(record)
+	if err != nil {
+		return false, err
+	}
+
+	var podList corev1.PodList
+	if err := r.List(ctx, &podList, client.InNamespace(record.Namespace),
+		client.MatchingLabels{replicationPodLabel: "true"}); err != nil {
+		return false, err
+	}
+
+	var srcLoc *kubedrv1alpha1.BackupLocation
+	var failures []string
+	done := true
+	busy := false
+
+	for _, destLocName := range pending {
+		if containsString(copies, destLocName) {
+			replicatedTo = append(replicatedTo, destLocName)
+			continue
+		}
+
+		running, failed := replicationPods(podList.Items, record, destLocName)
+		if failed != nil {
+			failures = append(failures, fmt.Sprintf("%s (attempt %d of %d): %s", destLocName,
+				len(failed), maxReplicationAttempts, podFailureMessage(failed[len(failed)-1])))
+		}
+
+		if running || len(failed) >= maxReplicationAttempts {
+			done = done && !running
+			continue
+		}
+
+		destLoc := &kubedrv1alpha1.BackupLocation{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: record.Namespace, Name: destLocName}, destLoc); err != nil {
+			// Retrying won't help if the location doesn't exist. A later backup
+			// will be replicated once it is created.
+			log.Error(err, "unable to fetch replica BackupLocation", "backuploc", destLocName)
+			if apierrors.IsNotFound(err) {
+				failures = append(failures, fmt.Sprintf("%s: BackupLocation not found", destLocName))
+				continue
+			}
+			return false, err
+		}
+
+		if srcLoc == nil {
+			if srcLoc, err = backupLocationFor(r.Client, r.Scheme, record.Namespace, srcLocKind, srcLocName); err != nil {
+				return false, err
+			}
+		}
+
+		pod, err := createReplicationPod(srcLoc, destLoc, record, len(failed)+1, log)
+		if err != nil {
+			log.Error(err, "Error in creating replication pod")
+			return false, err
+		}
+
+		operation, err := repoBusy(r.Client, record.Namespace, pod.ObjectMeta.Labels)
+		if err != nil {
+			return false, err
+		}
+
+		if operation != "" {
+			log.Info("Repo is busy, will replicate later", "operation", operation, "backuploc", destLocName)
+			busy = true
+			done = false
+			continue
+		}
+
+		if err := ctrl.SetControllerReference(record, pod, r.Scheme); err != nil {
+			return false, err
+		}
+
+		log.Info("Starting a new Pod", "Pod.Namespace", pod.Namespace, "Pod.Name", pod.Name)
+		if err := ignoreErrors(r.Create(ctx, pod)); err != nil {
+			log.Error(err, "Error in starting replication pod")
+			return false, err
+		}
+
+		done = false
+	}
+
+	if record.ObjectMeta.Annotations == nil {
+		record.ObjectMeta.Annotations = make(map[string]string)
+	}
+	if value := strings.Join(replicatedTo, ","); value != record.ObjectMeta.Annotations[replicatedToAnnotation] {
+		record.ObjectMeta.Annotations[replicatedToAnnotation] = value
+		if err := r.Update(ctx, record); err != nil {
+			return false, err
+		}
+	}
+
+	if failures != nil || done {
+		r.setReplicatedCondition(record, failures, log)
+	}
+
+	// Failed pods are kept as they are counted as attempts. They are
+	// deleted along with the record.
+	r.cleanupOldPods(record.Namespace, replicationPodLabel, true, log)
+
+	return busy, nil
+}
+
+// replicaRecords returns the names of the locations to which the snapshot
+// of the given record has been copied.
+func (r *MetadataBackupRecordReconciler) replicaRecords(record *kubedrv1alpha1.MetadataBackupRecord) ([]string, error) {
+	var mbrList kubedrv1alpha1.MetadataBackupRecordList
+	if err := r.List(context.Background(), &mbrList, client.InNamespace(record.Namespace),
+		client.MatchingFields{"policy": policyIndexKey(record.Spec.PolicyKind, record.Spec.Policy)}); err != nil {
+		return nil, err
+	}
+
+	var copies []string
+	for _, item := range mbrList.Items {
+		if item.Spec.ReplicaOf == record.Name {
+			copies = append(copies, item.Spec.Backuploc)
+		}
+	}
+
+	return copies, nil
+}
+
+// replicationPods returns whether a pod that copies the snapshot of the
+// given record to the given location is still running (or has succeeded
+// and the copy is yet to show up), and the pods that failed to do so.
+func replicationPods(pods []corev1.Pod, record *kubedrv1alpha1.MetadataBackupRecord,
+	destLocName string) (bool, []*corev1.Pod) {
+
+	var running bool
+	var failed []*corev1.Pod
+
+	for i := range pods {
+		pod := &pods[i]
+		if !metav1.IsControlledBy(pod, record) || pod.ObjectMeta.Labels[backupLocLabel] != destLocName {
+			continue
+		}
+
+		if pod.Status.Phase == corev1.PodFailed {
+			failed = append(failed, pod)
+		} else {
+			running = true
+		}
+	}
+
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].ObjectMeta.CreationTimestamp.Before(&failed[j].ObjectMeta.CreationTimestamp)
+	})
+
+	return running, failed
+}
+
+// setReplicatedCondition sets the "Replicated" condition of the given record,
+// which is false if copying to any of the replicas failed.
+func (r *MetadataBackupRecordReconciler) setReplicatedCondition(record *kubedrv1alpha1.MetadataBackupRecord,
+	failures []string, log logr.Logger) {
+
+	cond := kubedrv1alpha1.Condition{
+		Type:               kubedrv1alpha1.MetadataBackupRecordReplicated,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: record.ObjectMeta.Generation,
+		Reason:             "Replicated",
+	}
+
+	if failures != nil {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "ReplicationFailed"
+		cond.Message = strings.Join(failures, "; ")
+	}
+
+	existing := kubedrv1alpha1.FindCondition(record.Status.Conditions, cond.Type)
+	if existing != nil && existing.Status == cond.Status && existing.Reason == cond.Reason &&
+		existing.Message == cond.Message {
+		return
+	}
+
+	kubedrv1alpha1.SetCondition(&record.Status.Conditions, cond)
+
+	if err := r.Status().Update(context.Background(), record); err != nil {
+		log.Error(err, "unable to update mbr status", "mbr", record.Name)
+	}
+}
+
 // SetupWithManager hooks up this controller with the manager.
 func (r *MetadataBackupRecordReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if err := mgr.GetFieldIndexer().IndexField(&kubedrv1alpha1.MetadataBackupRecord{},
@@ -205,71 +704,107 @@ func (r *MetadataBackupRecordReconciler) SetupWithManager(mgr ctrl.Manager) erro
 			// grab the job object, extract the owner...
 			record := rawObj.(*kubedrv1alpha1.MetadataBackupRecord)
 
-			return []string{record.Spec.Policy}
+			return []string{policyIndexKey(record.Spec.PolicyKind, record.Spec.Policy)}
 		}); err != nil {
 		return err
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubedrv1alpha1.MetadataBackupRecord{}).
+		Owns(&corev1.Pod{}).
 		Complete(r)
 }
 
-func createResticSnapDeletePod(backupLocation *kubedrv1alpha1.BackupLocation, log logr.Logger,
+func createSnapDeletePod(backupLocation *kubedrv1alpha1.BackupLocation, log logr.Logger,
 	snapshotId string, mbrName string, namespace string) (*corev1.Pod, error) {
 
-	s3EndPoint := "s3:" + backupLocation.Spec.Url + "/" + backupLocation.Spec.BucketName
-
-	accessKey := corev1.SecretKeySelector{}
-	accessKey.Name = backupLocation.Spec.Credentials
-	accessKey.Key = "access_key"
-
-	secretKey := corev1.SecretKeySelector{}
-	secretKey.Name = backupLocation.Spec.Credentials
-	secretKey.Key = "secret_key"
+	kubedrUtilImage := os.Getenv("KUBEDR_UTIL_IMAGE")
+	if kubedrUtilImage == "" {
+		// This should really not happen.
+		err := fmt.Errorf("KUBEDR_UTIL_IMAGE is not set")
+		log.Error(err, "")
+		return nil, err
+	}
 
-	resticPassword := corev1.SecretKeySelector{}
-	resticPassword.Name = backupLocation.Spec.Credentials
-	resticPassword.Key = "restic_repo_password"
+	driver, err := engine.New(backupLocation, kubedrUtilImage)
+	if err != nil {
+		return nil, err
+	}
 
-	return &corev1.Pod{
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      mbrName + "-snapdel-pod-" + snapshotId,
 			Namespace: namespace,
-			Labels: map[string]string{
-				"kubedr.catalogicsoftware.com/snap-deletion-pod": "true",
-			},
+			Labels: mergeLabels(map[string]string{snapDeletionPodLabel: "true"},
+				locationLabels(backupLocation, false)),
 		},
 
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
-				{
-					Name:  mbrName + "-del",
-					Image: "restic/restic",
-					Args:  []string{"-r", s3EndPoint, "forget", "--prune", snapshotId},
-					Env: []corev1.EnvVar{
-						{
-							Name: "AWS_ACCESS_KEY",
-							ValueFrom: &corev1.EnvVarSource{
-								SecretKeyRef: &accessKey,
-							},
-						},
-						{
-							Name: "AWS_SECRET_KEY",
-							ValueFrom: &corev1.EnvVarSource{
-								SecretKeyRef: &secretKey,
-							},
-						},
-						{
-							Name: "RESTIC_PASSWORD",
-							ValueFrom: &corev1.EnvVarSource{
-								SecretKeyRef: &resticPassword,
-							},
-						},
-					},
-				},
+				driver.ForgetContainer(mbrName+"-del", snapshotId),
 			},
+			Volumes:       driver.Volumes(),
 			RestartPolicy: "Never",
 		},
-	}, nil
+	}
+
+	if err := kubedrv1alpha1.ApplyPodTemplateToPod(pod, backupLocation.Spec.PodTemplate); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
+
+func createReplicationPod(srcLoc *kubedrv1alpha1.BackupLocation, destLoc *kubedrv1alpha1.BackupLocation,
+	record *kubedrv1alpha1.MetadataBackupRecord, attempt int, log logr.Logger) (*corev1.Pod, error) {
+
+	kubedrUtilImage := os.Getenv("KUBEDR_UTIL_IMAGE")
+	if kubedrUtilImage == "" {
+		// This should really not happen.
+		err := fmt.Errorf("KUBEDR_UTIL_IMAGE is not set")
+		log.Error(err, "")
+		return nil, err
+	}
+
+	replicator, err := engine.NewReplicator(srcLoc, destLoc, kubedrUtilImage)
+	if err != nil {
+		return nil, err
+	}
+
+	scratchVolumeName := "replication-scratch"
+	scratchDir := "/replicate"
+
+	replicateContainer := replicator.ReplicateContainer(record.Name+"-repl", record.Spec.SnapshotId, scratchDir)
+	replicateContainer.Env = append(replicateContainer.Env,
+		corev1.EnvVar{Name: "KDR_MBR_NAME", Value: record.Name},
+		corev1.EnvVar{Name: "KDR_POLICY_NAME", Value: record.Spec.Policy},
+		corev1.EnvVar{Name: "KDR_BACKUPLOC_NAME", Value: destLoc.Name})
+	replicateContainer.VolumeMounts = append(replicateContainer.VolumeMounts,
+		corev1.VolumeMount{Name: scratchVolumeName, MountPath: scratchDir})
+
+	volumes := append(replicator.Volumes(), corev1.Volume{
+		Name:         scratchVolumeName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-repl-pod-%s-%d", record.Name, destLoc.Name, attempt),
+			Namespace: record.Namespace,
+			Labels: mergeLabels(mergeLabels(map[string]string{replicationPodLabel: "true"},
+				locationLabels(destLoc, false)), locationLabels(srcLoc, true)),
+		},
+
+		Spec: corev1.PodSpec{
+			Containers:    []corev1.Container{replicateContainer},
+			Volumes:       volumes,
+			RestartPolicy: "Never",
+		},
+	}
+
+	if err := kubedrv1alpha1.ApplyPodTemplateToPod(pod, destLoc.Spec.PodTemplate); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
 }
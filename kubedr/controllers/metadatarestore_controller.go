@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"reflect"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
@@ -31,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
 )
 
 // MetadataRestoreReconciler reconciles a MetadataRestore object
@@ -45,7 +47,14 @@ func (r *MetadataRestoreReconciler) setStatus(mr *kubedrv1alpha1.MetadataRestore
 
 	mr.Status.RestoreStatus = status
 	mr.Status.RestoreErrorMessage = errmsg
-	mr.Status.RestoreTime = metav1.Now().String()
+
+	now := metav1.Now()
+	mr.Status.RestoreTime = now.String()
+	if status == "Completed" || status == "Failed" {
+		mr.Status.CompletionTime = &now
+	}
+
+	setRestoreConditions(&mr.Status, mr.ObjectMeta.Generation)
 
 	r.Log.Info("Updating status...")
 	if err := r.Status().Update(context.Background(), mr); err != nil {
@@ -73,9 +82,12 @@ func (r *MetadataRestoreReconciler) setStatus(mr *kubedrv1alpha1.MetadataRestore
  *
  * - If there is a previous restore pod for this resource, delete the pod.
  *
+ * - Wait while an operation that needs exclusive access to the repo (such as
+ *   removing stale locks) is in progress. See backuplocation_lock.go.
+ *
  * - Create the pod that will restore the data. The kubedrutil "restore" command
- *   will call restic to restore the data and then, it will set the annotation to
- *   indicate that this resource is processed.
+ *   will call the backup engine (restic by default) to restore the data and
+ *   then, it will set the annotation to indicate that this resource is processed.
  *
  * - The "restore" command will also set the status both in case of success and
  *   failure.
@@ -98,6 +110,19 @@ func (r *MetadataRestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, er
 		return ctrl.Result{}, err
 	}
 
+	// The result of the restore is set by kubedrutil, without the
+	// conditions.
+	status := mr.Status.DeepCopy()
+	if status.RestoreStatus != "" {
+		setRestoreConditions(status, status.ObservedGeneration)
+	}
+	if !reflect.DeepEqual(&mr.Status, status) {
+		mr.Status = *status
+		if err := r.Status().Update(ctx, &mr); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Skip if spec hasn't changed. This check prevents reconcile on status
 	// updates.
 	if mr.Status.ObservedGeneration == mr.ObjectMeta.Generation {
@@ -151,6 +176,16 @@ func (r *MetadataRestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, er
 		return ctrl.Result{}, err
 	}
 
+	operation, err := repoBusy(r.Client, req.Namespace, pod.ObjectMeta.Labels)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if operation != "" {
+		r.Log.Info("Repo is busy, will restore later", "operation", operation)
+		return ctrl.Result{RequeueAfter: repoBusyRetryInterval}, nil
+	}
+
 	if err := ctrl.SetControllerReference(&mr, pod, r.Scheme); err != nil {
 		return ctrl.Result{}, err
 	}
@@ -163,9 +198,24 @@ func (r *MetadataRestoreReconciler) Reconcile(req ctrl.Request) (ctrl.Result, er
 		return ctrl.Result{}, err
 	}
 
+	r.setStatus(&mr, "InProgress", "")
+
 	return ctrl.Result{}, nil
 }
 
+// setRestoreConditions sets the conditions that correspond to the status of
+// the restore.
+func setRestoreConditions(status *kubedrv1alpha1.MetadataRestoreStatus, generation int64) {
+	reasons := map[string]string{
+		kubedrv1alpha1.ConditionReady:       "Restored",
+		kubedrv1alpha1.ConditionProgressing: "Restoring",
+		kubedrv1alpha1.ConditionFailed:      "RestoreFailed",
+	}
+
+	phase := kubedrv1alpha1.PhaseOf(status.RestoreStatus)
+	kubedrv1alpha1.SetPhase(&status.Conditions, phase, generation, reasons[phase], status.RestoreErrorMessage)
+}
+
 // SetupWithManager hooks up this controller with the manager.
 func (r *MetadataRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -173,26 +223,6 @@ func (r *MetadataRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(r)
 }
 
-func getRepoData(backupLocation *kubedrv1alpha1.BackupLocation) (string, *corev1.SecretKeySelector,
-	*corev1.SecretKeySelector, *corev1.SecretKeySelector) {
-
-	s3EndPoint := "s3:" + backupLocation.Spec.Url + "/" + backupLocation.Spec.BucketName
-
-	accessKey := corev1.SecretKeySelector{}
-	accessKey.Name = backupLocation.Spec.Credentials
-	accessKey.Key = "access_key"
-
-	secretKey := corev1.SecretKeySelector{}
-	secretKey.Name = backupLocation.Spec.Credentials
-	secretKey.Key = "secret_key"
-
-	resticPassword := corev1.SecretKeySelector{}
-	resticPassword.Name = backupLocation.Spec.Credentials
-	resticPassword.Key = "restic_repo_password"
-
-	return s3EndPoint, &accessKey, &secretKey, &resticPassword
-}
-
 func (r *MetadataRestoreReconciler) buildRestorePod(cr *kubedrv1alpha1.MetadataRestore,
 	namespace string, podName string) (*corev1.Pod, error) {
 
@@ -210,17 +240,21 @@ func (r *MetadataRestoreReconciler) buildRestorePod(cr *kubedrv1alpha1.MetadataR
 		return nil, err
 	}
 
-	backupLocation := &kubedrv1alpha1.BackupLocation{}
-	backupLocKey := types.NamespacedName{Namespace: namespace, Name: mbr.Spec.Backuploc}
-	if err := r.Get(context.TODO(), backupLocKey, backupLocation); err != nil {
+	backupLocation, err := backupLocationFor(r.Client, r.Scheme, namespace, mbr.Spec.BackuplocKind,
+		mbr.Spec.Backuploc)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := engine.New(backupLocation, kubedrUtilImage)
+	if err != nil {
 		return nil, err
 	}
-	s3EndPoint, accessKey, secretKey, resticPassword := getRepoData(backupLocation)
 
-	labels := map[string]string{
+	labels := mergeLabels(map[string]string{
 		"kubedr.type":        "restore",
 		"kubedr.restore-mbr": mbr.Name,
-	}
+	}, locationLabels(backupLocation, false))
 
 	targetDirVolume := corev1.Volume{Name: "restore-target"}
 	targetDirVolume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
@@ -229,56 +263,14 @@ func (r *MetadataRestoreReconciler) buildRestorePod(cr *kubedrv1alpha1.MetadataR
 	volumes := []corev1.Volume{
 		targetDirVolume,
 	}
+	volumes = append(volumes, driver.Volumes()...)
 
-	env := []corev1.EnvVar{
-		{
-			Name: "MY_POD_NAME",
-			ValueFrom: &corev1.EnvVarSource{
-				FieldRef: &corev1.ObjectFieldSelector{
-					FieldPath: "metadata.name",
-				},
-			},
-		},
-		{
-			Name: "AWS_ACCESS_KEY",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: accessKey,
-			},
-		},
-		{
-			Name: "AWS_SECRET_KEY",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: secretKey,
-			},
-		},
-		{
-			Name: "RESTIC_PASSWORD",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: resticPassword,
-			},
-		},
-		{
-			Name:  "KDR_MR_NAME",
-			Value: cr.Name,
-		},
-		{
-			Name:  "RESTIC_REPO",
-			Value: s3EndPoint,
-		},
-		{
-			Name:  "KDR_RESTORE_DEST",
-			Value: "/restore",
-		},
-	}
-
-	volumeMounts := []corev1.VolumeMount{
-		{
-			Name:      "restore-target",
-			MountPath: "/restore",
-		},
-	}
+	restoreContainer := driver.RestoreContainer(cr.Name, "/restore")
+	restoreContainer.Env = append(restoreContainer.Env, corev1.EnvVar{Name: "KDR_MR_NAME", Value: cr.Name})
+	restoreContainer.VolumeMounts = append(restoreContainer.VolumeMounts,
+		corev1.VolumeMount{Name: "restore-target", MountPath: "/restore"})
 
-	return &corev1.Pod{
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      podName,
 			Namespace: cr.Namespace,
@@ -290,18 +282,13 @@ func (r *MetadataRestoreReconciler) buildRestorePod(cr *kubedrv1alpha1.MetadataR
 
 			Volumes: volumes,
 
-			Containers: []corev1.Container{
-				{
-					Name:         cr.Name,
-					Image:        kubedrUtilImage,
-					VolumeMounts: volumeMounts,
-					Env:          env,
-
-					Args: []string{
-						"/usr/local/bin/kubedrutil", "restore",
-					},
-				},
-			},
+			Containers: []corev1.Container{restoreContainer},
 		},
-	}, nil
+	}
+
+	if err := kubedrv1alpha1.ApplyPodTemplateToPod(pod, backupLocation.Spec.PodTemplate); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
 }
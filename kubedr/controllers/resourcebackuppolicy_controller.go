@@ -0,0 +1,327 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+	"kubedr/engine"
+)
+
+// ResourceBackupPolicyReconciler reconciles a ResourceBackupPolicy object
+type ResourceBackupPolicyReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=resourcebackuppolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=kubedr.catalogicsoftware.com,resources=resourcebackuppolicies/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=create;get;list;update;patch;delete;watch
+
+// Reconcile creates, and keeps up to date, the cronjob that backs up the
+// resources selected by the policy. The cronjob is owned by the policy so
+// there is nothing to be done when the policy is deleted.
+func (r *ResourceBackupPolicyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("resourcebackuppolicy", req.NamespacedName)
+
+	var policy kubedrv1alpha1.ResourceBackupPolicy
+	if err := r.Get(ctx, req.NamespacedName, &policy); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("ResourceBackupPolicy is not found")
+			return ctrl.Result{}, nil
+		}
+
+		log.Error(err, "unable to fetch ResourceBackupPolicy")
+		return ctrl.Result{}, err
+	}
+
+	if !policy.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	backupCronjob, err := r.buildBackupCronjob(&policy)
+	if err != nil {
+		log.Error(err, "Error in building backup cronjob")
+		if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
+			// The location doesn't exist, the namespace is not allowed to
+			// use it or a copy of its secrets clashes with an existing
+			// secret. Retrying won't help until that is changed.
+			r.updateConditions(&policy, err, log)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	var cronJob batchv1beta1.CronJob
+	err = r.Get(ctx, types.NamespacedName{Namespace: backupCronjob.Namespace, Name: backupCronjob.Name}, &cronJob)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		if err := ctrl.SetControllerReference(&policy, backupCronjob, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		log.Info("Creating a new Cronjob", "Name", backupCronjob.Name)
+		return ctrl.Result{}, ignoreErrors(r.Create(ctx, backupCronjob))
+	}
+
+	if cronJob.ObjectMeta.Annotations[specHashAnnotation] != backupCronjob.ObjectMeta.Annotations[specHashAnnotation] {
+		log.Info("Backup cronjob is out of date, updating it")
+		if cronJob.ObjectMeta.Annotations == nil {
+			cronJob.ObjectMeta.Annotations = make(map[string]string)
+		}
+		cronJob.ObjectMeta.Annotations[specHashAnnotation] = backupCronjob.ObjectMeta.Annotations[specHashAnnotation]
+		setCronJobSpec(&cronJob, backupCronjob.Spec)
+
+		if err := r.Update(ctx, &cronJob); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	r.updateConditions(&policy, nil, log)
+	r.processStatus(&policy, log)
+
+	return ctrl.Result{}, nil
+}
+
+// updateConditions sets the conditions of the policy in the same way as for
+// MetadataBackupPolicy.
+func (r *ResourceBackupPolicyReconciler) updateConditions(policy *kubedrv1alpha1.ResourceBackupPolicy,
+	destErr error, log logr.Logger) {
+
+	status := policy.Status.DeepCopy()
+	status.ObservedGeneration = policy.ObjectMeta.Generation
+
+	if destErr != nil {
+		kubedrv1alpha1.SetPhase(&status.Conditions, kubedrv1alpha1.ConditionFailed, status.ObservedGeneration,
+			"DestinationUnavailable", destErr.Error())
+	} else {
+		phase, reason := policyPhase(status.BackupStatus)
+		kubedrv1alpha1.SetPhase(&status.Conditions, phase, status.ObservedGeneration, reason,
+			status.BackupErrorMessage)
+	}
+
+	if reflect.DeepEqual(&policy.Status, status) {
+		return
+	}
+
+	policy.Status = *status
+	if err := r.Status().Update(context.Background(), policy); err != nil {
+		log.Error(err, "unable to update policy status")
+	}
+}
+
+// processStatus reports lock errors of a failed backup. As with
+// MetadataBackupPolicy, an annotation records the backup pod whose status
+// has already been processed.
+func (r *ResourceBackupPolicyReconciler) processStatus(policy *kubedrv1alpha1.ResourceBackupPolicy,
+	log logr.Logger) {
+
+	backupAnnotation := "processed-backup.annotations.kubedr.catalogicsoftware.com"
+	currentBackupPod := policy.Status.BackupPod
+
+	if currentBackupPod == "" || policy.ObjectMeta.Annotations[backupAnnotation] == currentBackupPod {
+		return
+	}
+
+	if policy.Status.BackupStatus != "Completed" {
+		reportLockError(r.Client, policy.Namespace, policy.Spec.DestinationKind, policy.Spec.Destination,
+			policy.Status.BackupErrorMessage, time.Now(), log)
+	}
+
+	if policy.ObjectMeta.Annotations == nil {
+		policy.ObjectMeta.Annotations = make(map[string]string)
+	}
+	policy.ObjectMeta.Annotations[backupAnnotation] = currentBackupPod
+
+	if err := r.Update(context.Background(), policy); err != nil {
+		log.Error(err, "Error in updating the backup annotation, ignoring...")
+	}
+}
+
+func (r *ResourceBackupPolicyReconciler) buildBackupCronjob(
+	policy *kubedrv1alpha1.ResourceBackupPolicy) (*batchv1beta1.CronJob, error) {
+
+	kubedrUtilImage := os.Getenv("KUBEDR_UTIL_IMAGE")
+	if kubedrUtilImage == "" {
+		return nil, fmt.Errorf("KUBEDR_UTIL_IMAGE is not set")
+	}
+
+	backupLocation, err := backupLocationFor(r.Client, r.Scheme, policy.Namespace, policy.Spec.DestinationKind,
+		policy.Spec.Destination)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := engine.New(backupLocation, kubedrUtilImage)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := mergeLabels(map[string]string{
+		"kubedr.type":          "resource-backup",
+		"kubedr.backup-policy": policy.Name,
+	}, locationLabels(backupLocation, false))
+
+	exportDirVolume := corev1.Volume{Name: "export-dir"}
+	exportDirVolume.EmptyDir = &corev1.EmptyDirVolumeSource{}
+
+	volumes := append([]corev1.Volume{exportDirVolume}, driver.Volumes()...)
+	exportDirMount := corev1.VolumeMount{Name: "export-dir", MountPath: "/data"}
+
+	// Resources are exported before the backup container starts so that a
+	// failed export doesn't result in an incomplete backup.
+	exportContainer := engine.ExportContainer(policy.Name+"-export", kubedrUtilImage, policy.Name, "/data")
+	exportContainer.VolumeMounts = append(exportContainer.VolumeMounts, exportDirMount)
+
+	backupContainer := driver.BackupContainer(policy.Name+"-backup", "/data")
+	backupContainer.VolumeMounts = append(backupContainer.VolumeMounts, exportDirMount)
+	backupContainer.Env = append(backupContainer.Env,
+		corev1.EnvVar{Name: "KDR_POLICY_NAME", Value: policy.Name},
+		corev1.EnvVar{Name: "KDR_POLICY_KIND", Value: kubedrv1alpha1.KindResourceBackupPolicy})
+
+	cronJob := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      policy.Name + "-resource-backup-cronjob",
+			Namespace: policy.Namespace,
+			Labels:    labels,
+		},
+
+		Spec: batchv1beta1.CronJobSpec{
+			ConcurrencyPolicy: "Forbid",
+			Schedule:          policy.Spec.Schedule,
+			Suspend:           policy.Spec.Suspend,
+
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      policy.Name + "-resource-backup-job",
+					Namespace: policy.Namespace,
+				},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      policy.Name + "-resource-backup-pod-template",
+							Namespace: policy.Namespace,
+							Labels:    labels,
+						},
+						Spec: corev1.PodSpec{
+							RestartPolicy:      "Never",
+							ServiceAccountName: policy.Spec.ServiceAccountName,
+							Volumes:            volumes,
+							InitContainers:     []corev1.Container{exportContainer},
+							Containers:         []corev1.Container{backupContainer},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	podTemplate := &cronJob.Spec.JobTemplate.Spec.Template
+	if err := kubedrv1alpha1.ApplyPodTemplate(podTemplate, policy.Spec.PodTemplate); err != nil {
+		return nil, err
+	}
+
+	// Used to detect changes that need the cronjob to be updated.
+	cronJob.ObjectMeta.Annotations = map[string]string{specHashAnnotation: hashObject(cronJob.Spec)}
+
+	return cronJob, nil
+}
+
+// policiesForBackupLocation returns requests for all the resource policies
+// that store backups in the given BackupLocation.
+func (r *ResourceBackupPolicyReconciler) policiesForBackupLocation(obj handler.MapObject) []reconcile.Request {
+	if clusterLocName, ok := obj.Meta.GetLabels()[kubedrv1alpha1.ClusterBackupLocationLabel]; ok {
+		return r.policiesForDestination(kubedrv1alpha1.KindClusterBackupLocation, clusterLocName)
+	}
+
+	return r.policiesForDestination(kubedrv1alpha1.KindBackupLocation, obj.Meta.GetName(),
+		client.InNamespace(obj.Meta.GetNamespace()))
+}
+
+func (r *ResourceBackupPolicyReconciler) policiesForClusterBackupLocation(obj handler.MapObject) []reconcile.Request {
+	return r.policiesForDestination(kubedrv1alpha1.KindClusterBackupLocation, obj.Meta.GetName())
+}
+
+func (r *ResourceBackupPolicyReconciler) policiesForDestination(kind string, name string,
+	opts ...client.ListOption) []reconcile.Request {
+
+	opts = append(opts, client.MatchingFields{"destination": destinationIndexKey(kind, name)})
+
+	var policyList kubedrv1alpha1.ResourceBackupPolicyList
+	if err := r.List(context.Background(), &policyList, opts...); err != nil {
+		r.Log.Error(err, "unable to list resource policies", "backuploc", name)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, policy := range policyList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name},
+		})
+	}
+
+	return requests
+}
+
+// SetupWithManager hooks up this controller with the manager.
+func (r *ResourceBackupPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(&kubedrv1alpha1.ResourceBackupPolicy{},
+		"destination", func(rawObj runtime.Object) []string {
+			policy := rawObj.(*kubedrv1alpha1.ResourceBackupPolicy)
+
+			return []string{destinationIndexKey(policy.Spec.DestinationKind, policy.Spec.Destination)}
+		}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kubedrv1alpha1.ResourceBackupPolicy{}).
+		Owns(&batchv1beta1.CronJob{}).
+		Watches(&source.Kind{Type: &kubedrv1alpha1.BackupLocation{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.policiesForBackupLocation),
+			}).
+		Watches(&source.Kind{Type: &kubedrv1alpha1.ClusterBackupLocation{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.policiesForClusterBackupLocation),
+			}).
+		Complete(r)
+}
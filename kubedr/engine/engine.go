@@ -0,0 +1,191 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package engine hides the tool that is used to store backups in a
+// BackupLocation.
+//
+// Controllers build their pods out of the containers returned by a Driver.
+// Only the driver knows how the repo is addressed, which credentials the
+// tool needs and how the tool is invoked. Operations that need to report
+// their results in the status of a resource (init, backup, restore, check
+// and stats) run "kubedrutil", which is told about the engine through the
+// "KDR_ENGINE" environment variable. The rest run the tool directly.
+package engine
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+)
+
+const kubedrUtilPath = "/usr/local/bin/kubedrutil"
+
+// ClusterName is the name of the cluster in which KubeDR is running. It is
+// used to expand the prefix of a BackupLocation and is set once at start up.
+var ClusterName string
+
+// RepoPrefix returns the expanded prefix of the given location, which is
+// empty if no prefix is configured.
+func RepoPrefix(backupLocation *kubedrv1alpha1.BackupLocation) (string, error) {
+	return backupLocation.ExpandPrefix(ClusterName)
+}
+
+// Driver builds containers that operate on the repo of a single
+// BackupLocation.
+//
+// Callers are free to add environment variables and volume mounts to the
+// returned containers. Any volumes returned by Volumes() must be added to
+// the pod that runs the containers.
+type Driver interface {
+	// Name of the engine as given in BackupLocation spec.
+	Name() string
+
+	// InitContainer verifies that the repo can be opened and initializes it
+	// if it doesn't exist yet.
+	InitContainer(name string) corev1.Container
+
+	// BackupContainer backs up the contents of the directory "src".
+	BackupContainer(name string, src string) corev1.Container
+
+	// ForgetContainer deletes the given snapshot and its data from the repo.
+	ForgetContainer(name string, snapshotID string) corev1.Container
+
+	// RestoreContainer restores a snapshot into the directory "dest".
+	RestoreContainer(name string, dest string) corev1.Container
+
+	// ListContainer lists snapshots in the repo.
+	ListContainer(name string) corev1.Container
+
+	// CheckContainer verifies integrity of the repo. If "readDataSubset" is
+	// not empty, that subset of the data (such as "1/5" or "10%") is also
+	// read and verified.
+	CheckContainer(name string, readDataSubset string) corev1.Container
+
+	// StatsContainer collects usage statistics of the repo, such as its
+	// size and the number of snapshots.
+	StatsContainer(name string) corev1.Container
+
+	// PurgeContainer deletes all the snapshots, and the repo itself, from
+	// the target.
+	PurgeContainer(name string) corev1.Container
+
+	// Volumes needed by the containers.
+	Volumes() []corev1.Volume
+}
+
+// PasswordChanger is implemented by drivers of engines that encrypt the repo
+// with a password.
+type PasswordChanger interface {
+	// ChangePasswordContainer changes the password of the repo from the
+	// current one to the one in the given secret.
+	ChangePasswordContainer(name string, newPassword corev1.SecretKeySelector) corev1.Container
+}
+
+// Unlocker is implemented by drivers of engines that lock the repo while
+// operating on it.
+type Unlocker interface {
+	// UnlockContainer removes all the locks from the repo. It must only be
+	// run when nothing else is using the repo.
+	UnlockContainer(name string) corev1.Container
+}
+
+// New returns the driver for the engine configured in the given BackupLocation.
+// "utilImage" is the image containing "kubedrutil".
+func New(backupLocation *kubedrv1alpha1.BackupLocation, utilImage string) (Driver, error) {
+	return newDriver(backupLocation, utilImage, defaultRepoMount)
+}
+
+func newDriver(backupLocation *kubedrv1alpha1.BackupLocation, utilImage string, mount repoMount) (Driver, error) {
+	switch backupLocation.Spec.Engine {
+	case "", kubedrv1alpha1.EngineRestic:
+		return newResticDriver(backupLocation, utilImage, mount)
+
+	case kubedrv1alpha1.EngineTarGz:
+		return newTarGzDriver(backupLocation, utilImage, mount)
+	}
+
+	return nil, fmt.Errorf("Unknown backup engine (%s)", backupLocation.Spec.Engine)
+}
+
+// utilContainer runs the given "kubedrutil" command. "kubedrutil" uses the
+// name of the pod to report results so it is always passed.
+func utilContainer(name string, image string, command string, env []corev1.EnvVar,
+	volumeMounts []corev1.VolumeMount) corev1.Container {
+
+	podNameEnv := corev1.EnvVar{
+		Name: "MY_POD_NAME",
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{
+				FieldPath: "metadata.name",
+			},
+		},
+	}
+
+	return corev1.Container{
+		Name:  name,
+		Image: image,
+		Args: []string{
+			kubedrUtilPath, command,
+		},
+		Env:          append([]corev1.EnvVar{podNameEnv}, env...),
+		VolumeMounts: volumeMounts,
+	}
+}
+
+// ExportContainer exports the API resources selected by the
+// ResourceBackupPolicy "policyName" as files in the directory "dest", from
+// where they can be backed up by the container returned by BackupContainer.
+// It doesn't depend on the engine.
+func ExportContainer(name string, utilImage string, policyName string, dest string) corev1.Container {
+	return utilContainer(name, utilImage, "exportresources", []corev1.EnvVar{
+		{
+			Name:  "KDR_RESOURCE_POLICY_NAME",
+			Value: policyName,
+		},
+		{
+			Name:  "KDR_EXPORT_DIR",
+			Value: dest,
+		},
+	}, nil)
+}
+
+// InstallUtilContainer copies "kubedrutil" to the directory "dest" so that
+// HookContainer can run it in images that don't have it.
+func InstallUtilContainer(name string, utilImage string, dest string) corev1.Container {
+	return utilContainer(name, utilImage, "install", []corev1.EnvVar{
+		{
+			Name:  "KDR_INSTALL_DIR",
+			Value: dest,
+		},
+	}, nil)
+}
+
+// HookContainer runs "command" in "image" through the copy of "kubedrutil"
+// in the directory "utilDir", which enforces the timeout of the hook and
+// reports its result. The hook is described by "env", which must include
+// the name, phase, failure policy and timeout.
+func HookContainer(name string, image string, utilDir string, command []string,
+	env []corev1.EnvVar) corev1.Container {
+
+	// Unlike the util image, the image of a hook may have an entrypoint.
+	container := utilContainer(name, image, "runhook", env, nil)
+	container.Command = append([]string{utilDir + "/kubedrutil", "runhook", "--"}, command...)
+	container.Args = nil
+
+	return container
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+)
+
+const testUtilImage = "kubedrutil:test"
+
+func testBackupLocation(engine string) *kubedrv1alpha1.BackupLocation {
+	return &kubedrv1alpha1.BackupLocation{
+		ObjectMeta: metav1.ObjectMeta{Name: "loc", Namespace: "kubedr-system"},
+		Spec: kubedrv1alpha1.BackupLocationSpec{
+			Url:         "http://minio:9000",
+			BucketName:  "testbucket",
+			Credentials: "s3-creds",
+			Engine:      engine,
+		},
+	}
+}
+
+// findEnv returns the variable with the given name, or nil.
+func findEnv(env []corev1.EnvVar, name string) *corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == name {
+			return &env[i]
+		}
+	}
+
+	return nil
+}
+
+func TestResticRepo(t *testing.T) {
+	defer func(name string) { ClusterName = name }(ClusterName)
+	ClusterName = "prod"
+
+	tests := []struct {
+		name   string
+		prefix string
+		fs     *kubedrv1alpha1.FilesystemTarget
+		want   string
+	}{
+		{"s3", "", nil, "s3:http://minio:9000/testbucket"},
+		{"s3 with prefix", "/{{.ClusterName}}/{{.Namespace}}/", nil,
+			"s3:http://minio:9000/testbucket/prod/kubedr-system"},
+		{"filesystem", "", &kubedrv1alpha1.FilesystemTarget{PVCName: "backups"}, "/backup_repo"},
+		{"filesystem with path", "{{.Name}}", &kubedrv1alpha1.FilesystemTarget{PVCName: "backups", Path: "repos/"},
+			"/backup_repo/repos/loc"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := testBackupLocation(kubedrv1alpha1.EngineRestic)
+			loc.Spec.Prefix = tc.prefix
+			if tc.fs != nil {
+				loc.Spec.Url = ""
+				loc.Spec.BucketName = ""
+				loc.Spec.Filesystem = tc.fs
+			}
+
+			driver, err := New(loc, testUtilImage)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			c := driver.ListContainer("list")
+			if len(c.Args) < 2 || c.Args[0] != "-r" || c.Args[1] != tc.want {
+				t.Fatalf("expected repo %q, got args %v", tc.want, c.Args)
+			}
+			if env := findEnv(c.Env, "RESTIC_REPO"); env == nil || env.Value != tc.want {
+				t.Fatalf("expected RESTIC_REPO %q, got %v", tc.want, env)
+			}
+			if env := findEnv(c.Env, "AWS_ACCESS_KEY"); (env != nil) != (tc.fs == nil) {
+				t.Fatalf("unexpected S3 credentials: %v", env)
+			}
+		})
+	}
+}
+
+func TestCredentialsEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		engine       string
+		sessionToken string
+		want         []string
+	}{
+		{"restic", kubedrv1alpha1.EngineRestic, "", []string{"AWS_ACCESS_KEY", "AWS_SECRET_KEY"}},
+		{"restic with session token", kubedrv1alpha1.EngineRestic, "token",
+			[]string{"AWS_ACCESS_KEY", "AWS_SECRET_KEY", "AWS_SESSION_TOKEN"}},
+		{"targz", kubedrv1alpha1.EngineTarGz, "", []string{"AWS_ACCESS_KEY", "AWS_SECRET_KEY"}},
+		{"targz with session token", kubedrv1alpha1.EngineTarGz, "token",
+			[]string{"AWS_ACCESS_KEY", "AWS_SECRET_KEY", "AWS_SESSION_TOKEN"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := testBackupLocation(tc.engine)
+			if tc.sessionToken != "" {
+				loc.Spec.CredentialKeys = &kubedrv1alpha1.CredentialKeys{SessionToken: tc.sessionToken}
+			}
+
+			driver, err := New(loc, testUtilImage)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			containers := []corev1.Container{
+				driver.InitContainer("init"),
+				driver.BackupContainer("backup", "/data"),
+				driver.ForgetContainer("forget", "abc123"),
+				driver.RestoreContainer("restore", "/restore"),
+				driver.ListContainer("list"),
+				driver.CheckContainer("check", ""),
+				driver.StatsContainer("stats"),
+				driver.PurgeContainer("purge"),
+			}
+
+			for _, c := range containers {
+				var names []string
+				for _, env := range c.Env {
+					if strings.HasPrefix(env.Name, "AWS_") {
+						names = append(names, env.Name)
+
+						// Credentials are only ever read from the secret.
+						if ref := env.ValueFrom; env.Value != "" || ref == nil || ref.SecretKeyRef == nil ||
+							ref.SecretKeyRef.Name != "s3-creds" {
+							t.Fatalf("%s: %s is not taken from the secret: %v", c.Name, env.Name, env)
+						}
+					}
+
+					// No variable may embed the credentials.
+					if strings.Contains(env.Value, "$(AWS_") {
+						t.Fatalf("%s: %s refers to credentials: %q", c.Name, env.Name, env.Value)
+					}
+				}
+
+				if !reflect.DeepEqual(names, tc.want) {
+					t.Fatalf("%s: expected variables %v, got %v", c.Name, tc.want, names)
+				}
+
+				for _, arg := range c.Args {
+					if strings.Contains(arg, "$(AWS_") {
+						t.Fatalf("%s: argument refers to credentials: %q", c.Name, arg)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTarGzContainers(t *testing.T) {
+	loc := testBackupLocation(kubedrv1alpha1.EngineTarGz)
+	loc.Spec.Prefix = "{{.Namespace}}"
+
+	driver, err := New(loc, testUtilImage)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		container corev1.Container
+		command   string
+		env       map[string]string
+	}{
+		{"init", driver.InitContainer("c"), "repoinit", nil},
+		{"backup", driver.BackupContainer("c", "/data"), "backup", map[string]string{"BACKUP_SRC": "/data"}},
+		{"forget", driver.ForgetContainer("c", "abc123"), "forget", map[string]string{"KDR_SNAPSHOT_ID": "abc123"}},
+		{"restore", driver.RestoreContainer("c", "/restore"), "restore",
+			map[string]string{"KDR_RESTORE_DEST": "/restore"}},
+		{"list", driver.ListContainer("c"), "list", nil},
+		{"check", driver.CheckContainer("c", "10%"), "check", map[string]string{"KDR_CHECK_READ_DATA_SUBSET": "10%"}},
+		{"stats", driver.StatsContainer("c"), "stats", nil},
+		{"purge", driver.PurgeContainer("c"), "purge", nil},
+	}
+
+	common := map[string]string{
+		"KDR_ENGINE":    kubedrv1alpha1.EngineTarGz,
+		"KDR_S3_URL":    "http://minio:9000",
+		"KDR_S3_BUCKET": "testbucket",
+		"KDR_S3_PREFIX": "kubedr-system",
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.container
+			if c.Image != testUtilImage {
+				t.Fatalf("expected image %q, got %q", testUtilImage, c.Image)
+			}
+			if want := []string{kubedrUtilPath, tc.command}; !reflect.DeepEqual(c.Args, want) {
+				t.Fatalf("expected args %v, got %v", want, c.Args)
+			}
+
+			for _, vars := range []map[string]string{common, tc.env} {
+				for name, value := range vars {
+					if env := findEnv(c.Env, name); env == nil || env.Value != value {
+						t.Fatalf("expected %s=%q, got %v", name, value, env)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTarGzInvalidUrl(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"http", "http://minio:9000", false},
+		{"https with path", "https://s3.example.com/base", false},
+		{"no scheme", "minio:9000", true},
+		{"no host", "http://", true},
+		{"empty", "", true},
+		{"invalid", "http://minio:9000/%zz", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := testBackupLocation(kubedrv1alpha1.EngineTarGz)
+			loc.Spec.Url = tc.url
+
+			_, err := New(loc, testUtilImage)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReplicateContainer(t *testing.T) {
+	src := testBackupLocation(kubedrv1alpha1.EngineRestic)
+	src.Spec.Filesystem = &kubedrv1alpha1.FilesystemTarget{PVCName: "backups"}
+	src.Spec.Url = ""
+	src.Spec.BucketName = ""
+
+	dest := testBackupLocation(kubedrv1alpha1.EngineTarGz)
+	dest.Name = "offsite"
+
+	replicator, err := NewReplicator(src, dest, testUtilImage)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := replicator.ReplicateContainer("repl", "abc123", "/scratch")
+	if want := []string{kubedrUtilPath, "replicate"}; !reflect.DeepEqual(c.Args, want) {
+		t.Fatalf("expected args %v, got %v", want, c.Args)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"KDR_ENGINE", kubedrv1alpha1.EngineTarGz},
+		{"KDR_S3_URL", "http://minio:9000"},
+		{"KDR_SRC_KDR_ENGINE", kubedrv1alpha1.EngineRestic},
+		{"KDR_SRC_RESTIC_REPO", "/source_repo"},
+		{"KDR_SRC_KDR_RESTORE_DEST", "/scratch"},
+		{"KDR_SNAPSHOT_ID", "abc123"},
+	}
+
+	for _, tc := range tests {
+		if env := findEnv(c.Env, tc.name); env == nil || env.Value != tc.value {
+			t.Fatalf("expected %s=%q, got %v", tc.name, tc.value, env)
+		}
+	}
+
+	if findEnv(c.Env, "KDR_SRC_MY_POD_NAME") != nil {
+		t.Fatalf("pod name is passed for the source")
+	}
+
+	if len(c.VolumeMounts) != 1 || c.VolumeMounts[0].MountPath != "/source_repo" {
+		t.Fatalf("unexpected volume mounts: %v", c.VolumeMounts)
+	}
+}
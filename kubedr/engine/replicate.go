@@ -0,0 +1,83 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+)
+
+// Prefix of the variables that describe the source repo in a replication
+// container.
+const sourceEnvPrefix = "KDR_SRC_"
+
+// Replicator builds containers that copy snapshots from the repo of one
+// BackupLocation to the repo of another. The two locations may use
+// different engines.
+type Replicator struct {
+	src  Driver
+	dest Driver
+}
+
+// NewReplicator returns a Replicator from "src" to "dest".
+func NewReplicator(src *kubedrv1alpha1.BackupLocation, dest *kubedrv1alpha1.BackupLocation,
+	utilImage string) (*Replicator, error) {
+
+	// The source repo is mounted elsewhere so that both locations can be
+	// volumes.
+	srcDriver, err := newDriver(src, utilImage, sourceRepoMount)
+	if err != nil {
+		return nil, err
+	}
+
+	destDriver, err := New(dest, utilImage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Replicator{src: srcDriver, dest: destDriver}, nil
+}
+
+// ReplicateContainer runs the kubedrutil "replicate" command, which
+// restores the given snapshot into "scratchDir" using the source repo and
+// backs it up to the destination repo. The source is described by the same
+// variables as a restore but with the prefix "KDR_SRC_".
+func (r *Replicator) ReplicateContainer(name string, snapshotID string, scratchDir string) corev1.Container {
+	c := r.dest.BackupContainer(name, scratchDir)
+	c.Args = []string{kubedrUtilPath, "replicate"}
+
+	restore := r.src.RestoreContainer(name, scratchDir)
+	for _, env := range restore.Env {
+		if env.Name == "MY_POD_NAME" {
+			continue
+		}
+
+		env.Name = sourceEnvPrefix + env.Name
+		c.Env = append(c.Env, env)
+	}
+
+	c.Env = append(c.Env, corev1.EnvVar{Name: "KDR_SNAPSHOT_ID", Value: snapshotID})
+	c.VolumeMounts = append(c.VolumeMounts, restore.VolumeMounts...)
+
+	return c
+}
+
+// Volumes needed by the replication container.
+func (r *Replicator) Volumes() []corev1.Volume {
+	return append(r.src.Volumes(), r.dest.Volumes()...)
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"path"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+)
+
+// repoMount is the name of the volume, and the path at which it is mounted,
+// in case the repo is stored on a volume instead of S3. Similarly for the
+// volumes containing the CA bundle of the S3 end point and the service
+// account token used for web identity.
+type repoMount struct {
+	volumeName string
+	mountPath  string
+
+	caVolumeName string
+	caMountPath  string
+
+	tokenVolumeName string
+	tokenMountPath  string
+}
+
+var (
+	defaultRepoMount = repoMount{
+		volumeName:      "backup-repo",
+		mountPath:       "/backup_repo",
+		caVolumeName:    "ca-bundle",
+		caMountPath:     "/etc/kubedr/ca",
+		tokenVolumeName: "web-identity-token",
+		tokenMountPath:  "/var/run/secrets/kubedr/web-identity",
+	}
+
+	// Used for the source repo when a pod accesses two repos.
+	sourceRepoMount = repoMount{
+		volumeName:      "source-repo",
+		mountPath:       "/source_repo",
+		caVolumeName:    "source-ca-bundle",
+		caMountPath:     "/etc/kubedr/source_ca",
+		tokenVolumeName: "source-web-identity-token",
+		tokenMountPath:  "/var/run/secrets/kubedr/source-web-identity",
+	}
+)
+
+const (
+	// Name of the CA bundle in the CA volume.
+	caFileName = "ca.crt"
+
+	// Name of the token in the web identity volume.
+	tokenFileName = "token"
+
+	defaultTokenAudience = "sts.amazonaws.com"
+)
+
+func secretKeySelector(secretName string, key string) *corev1.SecretKeySelector {
+	selector := corev1.SecretKeySelector{}
+	selector.Name = secretName
+	selector.Key = key
+
+	return &selector
+}
+
+func secretEnv(name string, secretName string, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: secretKeySelector(secretName, key),
+		},
+	}
+}
+
+// s3CredsEnv returns the variables containing S3 credentials. In case of
+// web identity, they point to the role and the token instead.
+func s3CredsEnv(backupLocation *kubedrv1alpha1.BackupLocation, mount repoMount) []corev1.EnvVar {
+	if webIdentity := backupLocation.Spec.WebIdentity; webIdentity != nil {
+		return []corev1.EnvVar{
+			{Name: "AWS_ROLE_ARN", Value: webIdentity.RoleARN},
+			{Name: "AWS_WEB_IDENTITY_TOKEN_FILE", Value: path.Join(mount.tokenMountPath, tokenFileName)},
+		}
+	}
+
+	credentials := backupLocation.Spec.Credentials
+	keys := backupLocation.Spec.SecretKeyNames()
+
+	env := []corev1.EnvVar{
+		secretEnv("AWS_ACCESS_KEY", credentials, keys.AccessKey),
+		secretEnv("AWS_SECRET_KEY", credentials, keys.SecretKey),
+	}
+
+	if keys.SessionToken != "" {
+		env = append(env, secretEnv("AWS_SESSION_TOKEN", credentials, keys.SessionToken))
+	}
+
+	return env
+}
+
+// repoPasswordEnv returns the variable "name" containing the password of
+// the repo. Until a change of the password is applied to the repo, the one
+// recorded in status is used.
+func repoPasswordEnv(name string, backupLocation *kubedrv1alpha1.BackupLocation) corev1.EnvVar {
+	ref := backupLocation.Spec.RepoPasswordRef()
+	if backupLocation.Status.RepoPassword != nil {
+		ref = *backupLocation.Status.RepoPassword
+	}
+
+	return secretEnv(name, ref.Name, ref.Key)
+}
+
+// tokenVolumes returns the volume, and its mount, containing the projected
+// service account token in case of web identity.
+func tokenVolumes(backupLocation *kubedrv1alpha1.BackupLocation, mount repoMount) ([]corev1.Volume, []corev1.VolumeMount) {
+	webIdentity := backupLocation.Spec.WebIdentity
+	if webIdentity == nil {
+		return nil, nil
+	}
+
+	audience := webIdentity.Audience
+	if audience == "" {
+		audience = defaultTokenAudience
+	}
+
+	tokenVolume := corev1.Volume{
+		Name: mount.tokenVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{{
+					ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+						Audience:          audience,
+						ExpirationSeconds: webIdentity.ExpirationSeconds,
+						Path:              tokenFileName,
+					},
+				}},
+			},
+		},
+	}
+
+	return []corev1.Volume{tokenVolume},
+		[]corev1.VolumeMount{{Name: mount.tokenVolumeName, MountPath: mount.tokenMountPath, ReadOnly: true}}
+}
+
+// credsVolumes returns all the volumes, and their mounts, needed to access
+// a S3 target.
+func credsVolumes(backupLocation *kubedrv1alpha1.BackupLocation, mount repoMount) ([]corev1.Volume, []corev1.VolumeMount) {
+	volumes, volumeMounts := caVolumes(backupLocation, mount)
+	tokenVols, tokenMounts := tokenVolumes(backupLocation, mount)
+
+	return append(volumes, tokenVols...), append(volumeMounts, tokenMounts...)
+}
+
+// repoVolumes returns the volume, and its mount, containing the repo in
+// case of a file system target.
+func repoVolumes(backupLocation *kubedrv1alpha1.BackupLocation, mount repoMount) ([]corev1.Volume, []corev1.VolumeMount) {
+	fs := backupLocation.Spec.Filesystem
+	if fs == nil {
+		return nil, nil
+	}
+
+	repoVolume := corev1.Volume{Name: mount.volumeName}
+	if fs.NFS != nil {
+		repoVolume.NFS = fs.NFS.DeepCopy()
+	} else {
+		repoVolume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+			ClaimName: fs.PVCName,
+		}
+	}
+
+	return []corev1.Volume{repoVolume},
+		[]corev1.VolumeMount{{Name: mount.volumeName, MountPath: mount.mountPath}}
+}
+
+// caVolumes returns the volume, and its mount, containing the CA bundle of
+// the S3 end point, if one is configured.
+func caVolumes(backupLocation *kubedrv1alpha1.BackupLocation, mount repoMount) ([]corev1.Volume, []corev1.VolumeMount) {
+	tls := backupLocation.Spec.TLS
+	if tls == nil || tls.CABundle == nil {
+		return nil, nil
+	}
+
+	caVolume := corev1.Volume{Name: mount.caVolumeName}
+	if ref := tls.CABundle.ConfigMapKeyRef; ref != nil {
+		caVolume.ConfigMap = &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: ref.LocalObjectReference,
+			Items:                []corev1.KeyToPath{{Key: ref.Key, Path: caFileName}},
+		}
+	} else if ref := tls.CABundle.SecretKeyRef; ref != nil {
+		caVolume.Secret = &corev1.SecretVolumeSource{
+			SecretName: ref.Name,
+			Items:      []corev1.KeyToPath{{Key: ref.Key, Path: caFileName}},
+		}
+	} else {
+		return nil, nil
+	}
+
+	return []corev1.Volume{caVolume},
+		[]corev1.VolumeMount{{Name: mount.caVolumeName, MountPath: mount.caMountPath, ReadOnly: true}}
+}
+
+// tlsEnv returns the variables that pass TLS options to "kubedrutil".
+func tlsEnv(backupLocation *kubedrv1alpha1.BackupLocation, mount repoMount) []corev1.EnvVar {
+	var env []corev1.EnvVar
+
+	if _, caMounts := caVolumes(backupLocation, mount); len(caMounts) > 0 {
+		env = append(env, corev1.EnvVar{Name: "KDR_CA_CERT_FILE", Value: path.Join(mount.caMountPath, caFileName)})
+	}
+
+	if tls := backupLocation.Spec.TLS; tls != nil && tls.InsecureSkipVerify {
+		env = append(env, corev1.EnvVar{Name: "KDR_INSECURE_TLS", Value: "true"})
+	}
+
+	return env
+}
+
+// objectLockEnv returns the variables that tell "kubedrutil" to create the
+// bucket with object lock enabled and to lock the data it writes. It is
+// also expected to set "lockedUntil" in the MetadataBackupRecord.
+func objectLockEnv(backupLocation *kubedrv1alpha1.BackupLocation) []corev1.EnvVar {
+	lock := backupLocation.Spec.ObjectLock
+	if lock == nil {
+		return nil
+	}
+
+	return []corev1.EnvVar{
+		{Name: "KDR_OBJECT_LOCK_MODE", Value: lock.Mode},
+		{Name: "KDR_OBJECT_LOCK_RETENTION_DAYS", Value: strconv.FormatInt(lock.RetentionDays, 10)},
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"path"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+)
+
+const resticImage = "restic/restic"
+
+// Matches the errors reported by restic when the repo is locked by
+// another process, including one that no longer exists.
+var resticLockErrorRegexp = regexp.MustCompile(`(?i)repository is already locked|unable to create lock`)
+
+// IsLockError returns true if the given error message, as reported by a
+// backup engine, says that the repo is locked.
+func IsLockError(message string) bool {
+	return resticLockErrorRegexp.MatchString(message)
+}
+
+// resticDriver stores backups in a restic repo.
+type resticDriver struct {
+	backupLocation *kubedrv1alpha1.BackupLocation
+	utilImage      string
+
+	// Location of the repo as understood by restic.
+	repo  string
+	mount repoMount
+}
+
+func newResticDriver(backupLocation *kubedrv1alpha1.BackupLocation, utilImage string,
+	mount repoMount) (*resticDriver, error) {
+
+	d := &resticDriver{
+		backupLocation: backupLocation,
+		utilImage:      utilImage,
+		mount:          mount,
+	}
+
+	prefix, err := RepoPrefix(backupLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs := backupLocation.Spec.Filesystem; fs != nil {
+		d.repo = path.Join(mount.mountPath, fs.Path, prefix)
+	} else {
+		d.repo = "s3:" + backupLocation.Spec.Url + "/" + path.Join(backupLocation.Spec.BucketName, prefix)
+	}
+
+	return d, nil
+}
+
+func (d *resticDriver) Name() string {
+	return kubedrv1alpha1.EngineRestic
+}
+
+// env returns the variables needed by restic to access the repo. They
+// are built afresh every time so that callers can modify them.
+func (d *resticDriver) env() []corev1.EnvVar {
+	var env []corev1.EnvVar
+
+	if d.backupLocation.Spec.Filesystem == nil {
+		env = append(env, s3CredsEnv(d.backupLocation, d.mount)...)
+	}
+
+	env = append(env,
+		repoPasswordEnv("RESTIC_PASSWORD", d.backupLocation),
+		corev1.EnvVar{Name: "RESTIC_REPO", Value: d.repo})
+
+	return env
+}
+
+func (d *resticDriver) volumeMounts() []corev1.VolumeMount {
+	_, volumeMounts := repoVolumes(d.backupLocation, d.mount)
+	_, credsMounts := credsVolumes(d.backupLocation, d.mount)
+
+	return append(volumeMounts, credsMounts...)
+}
+
+func (d *resticDriver) utilContainer(name string, command string) corev1.Container {
+	env := append([]corev1.EnvVar{{Name: "KDR_ENGINE", Value: d.Name()}}, d.env()...)
+	env = append(env, tlsEnv(d.backupLocation, d.mount)...)
+	env = append(env, objectLockEnv(d.backupLocation)...)
+
+	return utilContainer(name, d.utilImage, command, env, d.volumeMounts())
+}
+
+func (d *resticDriver) resticContainer(name string, args ...string) corev1.Container {
+	resticArgs := []string{"-r", d.repo}
+
+	if _, caMounts := caVolumes(d.backupLocation, d.mount); len(caMounts) > 0 {
+		resticArgs = append(resticArgs, "--cacert", path.Join(d.mount.caMountPath, caFileName))
+	}
+
+	if tls := d.backupLocation.Spec.TLS; tls != nil && tls.InsecureSkipVerify {
+		resticArgs = append(resticArgs, "--insecure-tls")
+	}
+
+	return corev1.Container{
+		Name:         name,
+		Image:        resticImage,
+		Args:         append(resticArgs, args...),
+		Env:          d.env(),
+		VolumeMounts: d.volumeMounts(),
+
+		// restic reports errors only on stderr. This makes them available
+		// in the status of the pod (to detect lock errors, for example).
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+}
+
+func (d *resticDriver) InitContainer(name string) corev1.Container {
+	return d.utilContainer(name, "repoinit")
+}
+
+func (d *resticDriver) BackupContainer(name string, src string) corev1.Container {
+	c := d.utilContainer(name, "backup")
+	c.Env = append(c.Env, corev1.EnvVar{Name: "BACKUP_SRC", Value: src})
+
+	return c
+}
+
+func (d *resticDriver) ForgetContainer(name string, snapshotID string) corev1.Container {
+	return d.resticContainer(name, "forget", "--prune", snapshotID)
+}
+
+func (d *resticDriver) RestoreContainer(name string, dest string) corev1.Container {
+	c := d.utilContainer(name, "restore")
+	c.Env = append(c.Env, corev1.EnvVar{Name: "KDR_RESTORE_DEST", Value: dest})
+
+	return c
+}
+
+func (d *resticDriver) ListContainer(name string) corev1.Container {
+	return d.resticContainer(name, "snapshots", "--json")
+}
+
+func (d *resticDriver) CheckContainer(name string, readDataSubset string) corev1.Container {
+	c := d.utilContainer(name, "check")
+	if readDataSubset != "" {
+		c.Env = append(c.Env, corev1.EnvVar{Name: "KDR_CHECK_READ_DATA_SUBSET", Value: readDataSubset})
+	}
+
+	return c
+}
+
+func (d *resticDriver) StatsContainer(name string) corev1.Container {
+	return d.utilContainer(name, "stats")
+}
+
+func (d *resticDriver) PurgeContainer(name string) corev1.Container {
+	return d.utilContainer(name, "purge")
+}
+
+func (d *resticDriver) ChangePasswordContainer(name string, newPassword corev1.SecretKeySelector) corev1.Container {
+	c := d.utilContainer(name, "changepassword")
+	c.Env = append(c.Env, secretEnv("KDR_NEW_RESTIC_PASSWORD", newPassword.Name, newPassword.Key))
+
+	return c
+}
+
+func (d *resticDriver) UnlockContainer(name string) corev1.Container {
+	// By default, restic only removes locks that are older than 30 minutes
+	// or whose process no longer exists on the same host. The caller has
+	// already made sure that none of the locks are in use.
+	return d.resticContainer(name, "unlock", "--remove-all")
+}
+
+func (d *resticDriver) Volumes() []corev1.Volume {
+	volumes, _ := repoVolumes(d.backupLocation, d.mount)
+	credsVols, _ := credsVolumes(d.backupLocation, d.mount)
+
+	return append(volumes, credsVols...)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+
+	kubedrv1alpha1 "kubedr/api/v1alpha1"
+)
+
+// tarGzDriver stores every backup as a single compressed tar archive,
+// named "<snapshot ID>.tar.gz", in a S3 bucket. There is no deduplication
+// or encryption. All operations run "kubedrutil", which accesses the
+// bucket with the S3 API, so credentials are only passed in variables.
+type tarGzDriver struct {
+	backupLocation *kubedrv1alpha1.BackupLocation
+	utilImage      string
+
+	// Expanded prefix under which the archives are stored.
+	prefix string
+
+	mount repoMount
+}
+
+func newTarGzDriver(backupLocation *kubedrv1alpha1.BackupLocation, utilImage string,
+	mount repoMount) (*tarGzDriver, error) {
+
+	if backupLocation.Spec.Filesystem != nil {
+		return nil, fmt.Errorf("Engine (%s) doesn't support filesystem targets", kubedrv1alpha1.EngineTarGz)
+	}
+
+	if backupLocation.Spec.WebIdentity != nil {
+		return nil, fmt.Errorf("Engine (%s) doesn't support web identity", kubedrv1alpha1.EngineTarGz)
+	}
+
+	if u, err := url.Parse(backupLocation.Spec.Url); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("Invalid S3 end point (%s)", backupLocation.Spec.Url)
+	}
+
+	prefix, err := RepoPrefix(backupLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tarGzDriver{
+		backupLocation: backupLocation,
+		utilImage:      utilImage,
+		prefix:         prefix,
+		mount:          mount,
+	}, nil
+}
+
+func (d *tarGzDriver) Name() string {
+	return kubedrv1alpha1.EngineTarGz
+}
+
+func (d *tarGzDriver) utilContainer(name string, command string) corev1.Container {
+	env := []corev1.EnvVar{{Name: "KDR_ENGINE", Value: d.Name()}}
+	env = append(env, s3CredsEnv(d.backupLocation, d.mount)...)
+	env = append(env,
+		corev1.EnvVar{Name: "KDR_S3_URL", Value: d.backupLocation.Spec.Url},
+		corev1.EnvVar{Name: "KDR_S3_BUCKET", Value: d.backupLocation.Spec.BucketName})
+	if d.prefix != "" {
+		env = append(env, corev1.EnvVar{Name: "KDR_S3_PREFIX", Value: d.prefix})
+	}
+	env = append(env, tlsEnv(d.backupLocation, d.mount)...)
+	env = append(env, objectLockEnv(d.backupLocation)...)
+
+	_, credsMounts := credsVolumes(d.backupLocation, d.mount)
+
+	return utilContainer(name, d.utilImage, command, env, credsMounts)
+}
+
+func (d *tarGzDriver) InitContainer(name string) corev1.Container {
+	return d.utilContainer(name, "repoinit")
+}
+
+func (d *tarGzDriver) BackupContainer(name string, src string) corev1.Container {
+	c := d.utilContainer(name, "backup")
+	c.Env = append(c.Env, corev1.EnvVar{Name: "BACKUP_SRC", Value: src})
+
+	return c
+}
+
+func (d *tarGzDriver) ForgetContainer(name string, snapshotID string) corev1.Container {
+	c := d.utilContainer(name, "forget")
+	c.Env = append(c.Env, corev1.EnvVar{Name: "KDR_SNAPSHOT_ID", Value: snapshotID})
+
+	return c
+}
+
+func (d *tarGzDriver) RestoreContainer(name string, dest string) corev1.Container {
+	c := d.utilContainer(name, "restore")
+	c.Env = append(c.Env, corev1.EnvVar{Name: "KDR_RESTORE_DEST", Value: dest})
+
+	return c
+}
+
+func (d *tarGzDriver) ListContainer(name string) corev1.Container {
+	return d.utilContainer(name, "list")
+}
+
+func (d *tarGzDriver) CheckContainer(name string, readDataSubset string) corev1.Container {
+	c := d.utilContainer(name, "check")
+	if readDataSubset != "" {
+		c.Env = append(c.Env, corev1.EnvVar{Name: "KDR_CHECK_READ_DATA_SUBSET", Value: readDataSubset})
+	}
+
+	return c
+}
+
+func (d *tarGzDriver) StatsContainer(name string) corev1.Container {
+	return d.utilContainer(name, "stats")
+}
+
+func (d *tarGzDriver) PurgeContainer(name string) corev1.Container {
+	return d.utilContainer(name, "purge")
+}
+
+func (d *tarGzDriver) Volumes() []corev1.Volume {
+	volumes, _ := credsVolumes(d.backupLocation, d.mount)
+	return volumes
+}
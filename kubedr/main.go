@@ -19,10 +19,12 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	kubedrv1alpha1 "kubedr/api/v1alpha1"
 
 	"kubedr/controllers"
+	"kubedr/engine"
 	"kubedr/metrics"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -52,11 +54,20 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var backupLocValidation kubedrv1alpha1.BackupLocationValidationOptions
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&backupLocValidation.ProbeBucket, "probe-backup-location-bucket", true,
+		"Verify S3 end point and credentials when a BackupLocation is created or its spec is changed.")
+	flag.DurationVar(&backupLocValidation.Timeout, "backup-location-validation-timeout", 10*time.Second,
+		"Maximum time taken to validate a BackupLocation.")
+	flag.StringVar(&backupLocValidation.ClusterName, "cluster-name", "",
+		"Name of this cluster, substituted for {{.ClusterName}} in the prefix of a BackupLocation.")
 	flag.Parse()
 
+	engine.ClusterName = backupLocValidation.ClusterName
+
 	ctrl.SetLogger(zap.New(func(o *zap.Options) {
 		o.Development = true
 	}))
@@ -73,21 +84,38 @@ func main() {
 	}
 
 	if err = (&controllers.BackupLocationReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("BackupLocation"),
-		Scheme: mgr.GetScheme(),
+		Client:      mgr.GetClient(),
+		Log:         ctrl.Log.WithName("controllers").WithName("BackupLocation"),
+		Scheme:      mgr.GetScheme(),
+		MetricsInfo: metricsInfo,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "BackupLocation")
 		os.Exit(1)
 	}
 
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err = (&kubedrv1alpha1.BackupLocation{}).SetupWebhookWithManager(mgr); err != nil {
+		if err = (&kubedrv1alpha1.BackupLocation{}).SetupWebhookWithManager(mgr, backupLocValidation); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "BackupLocation")
 			os.Exit(1)
 		}
 	}
 
+	if err = (&controllers.ClusterBackupLocationReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("ClusterBackupLocation"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterBackupLocation")
+		os.Exit(1)
+	}
+
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&kubedrv1alpha1.ClusterBackupLocation{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterBackupLocation")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.MetadataBackupPolicyReconciler{
 		Client:      mgr.GetClient(),
 		Log:         ctrl.Log.WithName("controllers").WithName("MetadataBackupPolicy"),
@@ -104,6 +132,22 @@ func main() {
 			os.Exit(1)
 		}
 	}
+	if err = (&controllers.ResourceBackupPolicyReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("ResourceBackupPolicy"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ResourceBackupPolicy")
+		os.Exit(1)
+	}
+
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&kubedrv1alpha1.ResourceBackupPolicy{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ResourceBackupPolicy")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.MetadataBackupRecordReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("MetadataBackupRecord"),
@@ -118,6 +162,14 @@ func main() {
 			os.Exit(1)
 		}
 	*/
+	if err = (&controllers.MetadataBackupReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("MetadataBackup"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MetadataBackup")
+		os.Exit(1)
+	}
 	if err = (&controllers.MetadataRestoreReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("MetadataRestore"),
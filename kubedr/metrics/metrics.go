@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
@@ -35,9 +36,26 @@ const (
 	numFailedBackupsKey      = "kubedr_num_failed_backups"
 	backupDurationSecondsKey = "kubedr_backup_duration_seconds"
 
-	policyLabel = "policyName"
+	numRepoChecksKey          = "kubedr_num_repo_checks"
+	numFailedRepoChecksKey    = "kubedr_num_failed_repo_checks"
+	repoCheckErrorsKey        = "kubedr_repo_check_errors"
+	repoLastCheckTimestampKey = "kubedr_repo_last_check_timestamp_seconds"
+
+	repoTotalSizeBytesKey          = "kubedr_repo_total_size_bytes"
+	repoDeduplicatedSizeBytesKey   = "kubedr_repo_deduplicated_size_bytes"
+	repoNumSnapshotsKey            = "kubedr_repo_num_snapshots"
+	repoOldestSnapshotTimestampKey = "kubedr_repo_oldest_snapshot_timestamp_seconds"
+	repoNewestSnapshotTimestampKey = "kubedr_repo_newest_snapshot_timestamp_seconds"
+
+	policyLabel    = "policyName"
+	backupLocLabel = "backupLocationName"
+	namespaceLabel = "namespace"
 )
 
+// Repo metrics are labelled by namespace as locations in different
+// namespaces can have the same name.
+var repoLabels = []string{namespaceLabel, backupLocLabel}
+
 // NewMetricsInfo creates a new metrics structure to be used by controllers.
 func NewMetricsInfo() *MetricsInfo {
 	return &MetricsInfo{
@@ -100,6 +118,78 @@ func NewMetricsInfo() *MetricsInfo {
 				},
 				[]string{policyLabel},
 			),
+
+			numRepoChecksKey: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: numRepoChecksKey,
+					Help: "Total number of repo integrity checks",
+				},
+				repoLabels,
+			),
+
+			numFailedRepoChecksKey: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: numFailedRepoChecksKey,
+					Help: "Total number of repo integrity checks that failed or found errors",
+				},
+				repoLabels,
+			),
+
+			repoCheckErrorsKey: prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: repoCheckErrorsKey,
+					Help: "Number of errors found by the last repo integrity check",
+				},
+				repoLabels,
+			),
+
+			repoLastCheckTimestampKey: prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: repoLastCheckTimestampKey,
+					Help: "Time of the last repo integrity check, in seconds since epoch",
+				},
+				repoLabels,
+			),
+
+			repoTotalSizeBytesKey: prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: repoTotalSizeBytesKey,
+					Help: "Size of all the snapshots in a repo, in bytes, as they would be if restored",
+				},
+				repoLabels,
+			),
+
+			repoDeduplicatedSizeBytesKey: prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: repoDeduplicatedSizeBytesKey,
+					Help: "Size of the data stored in a repo, in bytes, after deduplication",
+				},
+				repoLabels,
+			),
+
+			repoNumSnapshotsKey: prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: repoNumSnapshotsKey,
+					Help: "Number of snapshots in a repo",
+				},
+				repoLabels,
+			),
+
+			repoOldestSnapshotTimestampKey: prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: repoOldestSnapshotTimestampKey,
+					Help: "Time of the oldest snapshot in a repo, in seconds since epoch",
+				},
+				repoLabels,
+			),
+
+			repoNewestSnapshotTimestampKey: prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: repoNewestSnapshotTimestampKey,
+					Help: "Time of the newest snapshot in a repo, in seconds since epoch",
+				},
+				repoLabels,
+			),
 		},
 	}
 }
@@ -146,6 +236,73 @@ func (m *MetricsInfo) RecordBackupDuration(policy string, seconds float64) {
 	}
 }
 
+// RecordRepoCheck records the result of a repo integrity check. "failed" is
+// true if the check couldn't be completed or if it found any errors.
+func (m *MetricsInfo) RecordRepoCheck(namespace, backupLoc string, checkTime time.Time, numErrors int64, failed bool) {
+	if pm, ok := m.metrics[numRepoChecksKey].(*prometheus.CounterVec); ok {
+		pm.WithLabelValues(namespace, backupLoc).Inc()
+	}
+
+	if failed {
+		if pm, ok := m.metrics[numFailedRepoChecksKey].(*prometheus.CounterVec); ok {
+			pm.WithLabelValues(namespace, backupLoc).Inc()
+		}
+	}
+
+	if pm, ok := m.metrics[repoCheckErrorsKey].(*prometheus.GaugeVec); ok {
+		pm.WithLabelValues(namespace, backupLoc).Set(float64(numErrors))
+	}
+
+	if pm, ok := m.metrics[repoLastCheckTimestampKey].(*prometheus.GaugeVec); ok {
+		pm.WithLabelValues(namespace, backupLoc).Set(float64(checkTime.Unix()))
+	}
+}
+
+// SetRepoStats records the usage statistics of a repo. Snapshot times are
+// not set if the repo has no snapshots.
+func (m *MetricsInfo) SetRepoStats(namespace, backupLoc string, totalSize uint64, deduplicatedSize uint64,
+	numSnapshots int64, oldestSnapshot *metav1.Time, newestSnapshot *metav1.Time) {
+
+	if pm, ok := m.metrics[repoTotalSizeBytesKey].(*prometheus.GaugeVec); ok {
+		pm.WithLabelValues(namespace, backupLoc).Set(float64(totalSize))
+	}
+
+	if pm, ok := m.metrics[repoDeduplicatedSizeBytesKey].(*prometheus.GaugeVec); ok {
+		pm.WithLabelValues(namespace, backupLoc).Set(float64(deduplicatedSize))
+	}
+
+	if pm, ok := m.metrics[repoNumSnapshotsKey].(*prometheus.GaugeVec); ok {
+		pm.WithLabelValues(namespace, backupLoc).Set(float64(numSnapshots))
+	}
+
+	snapshotTimes := map[string]*metav1.Time{
+		repoOldestSnapshotTimestampKey: oldestSnapshot,
+		repoNewestSnapshotTimestampKey: newestSnapshot,
+	}
+
+	for key, t := range snapshotTimes {
+		if pm, ok := m.metrics[key].(*prometheus.GaugeVec); ok {
+			if t == nil {
+				pm.DeleteLabelValues(namespace, backupLoc)
+			} else {
+				pm.WithLabelValues(namespace, backupLoc).Set(float64(t.Unix()))
+			}
+		}
+	}
+}
+
+// DeleteRepoStats removes the usage statistics of a repo that no longer
+// exists.
+func (m *MetricsInfo) DeleteRepoStats(namespace, backupLoc string) {
+	for _, key := range []string{repoTotalSizeBytesKey, repoDeduplicatedSizeBytesKey, repoNumSnapshotsKey,
+		repoOldestSnapshotTimestampKey, repoNewestSnapshotTimestampKey} {
+
+		if pm, ok := m.metrics[key].(*prometheus.GaugeVec); ok {
+			pm.DeleteLabelValues(namespace, backupLoc)
+		}
+	}
+}
+
 func toSeconds(d time.Duration) float64 {
 	return float64(d / time.Second)
 }
@@ -0,0 +1,287 @@
+/*
+Copyright 2020 Catalogic Software
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package s3util contains minimal S3 client functionality needed by the
+// manager itself. Everything else is done by the backup engines in pods.
+package s3util
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Region used to sign requests. S3 compatible servers such as MinIO accept
+// it by default and AWS responds with a redirect (which still proves that
+// the end point is reachable) if the bucket is in a different region.
+const defaultRegion = "us-east-1"
+
+// sha256 of an empty payload.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// ErrAccessDenied is returned if the end point rejected the credentials.
+var ErrAccessDenied = fmt.Errorf("Access denied by S3 end point, please check credentials")
+
+// ValidateEndpoint checks that "endpoint" is a http(s) URL.
+func ValidateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("Scheme must be http or https")
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("Host is missing")
+	}
+
+	return nil
+}
+
+// NewHTTPClient returns a client that trusts the CA certificates in
+// "caBundle" (PEM), in addition to the system ones. If "insecureSkipVerify"
+// is true, certificates are not verified at all.
+func NewHTTPClient(caBundle []byte, insecureSkipVerify bool) (*http.Client, error) {
+	if len(caBundle) == 0 && !insecureSkipVerify {
+		return http.DefaultClient, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if len(caBundle) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("No valid PEM certificates found in CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// Credentials used to sign requests. SessionToken is only set for
+// temporary credentials.
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// ProbeBucket issues a signed HEAD request for the bucket.
+//
+// A missing bucket is not an error as the bucket is created when the repo
+// is initialized. Use a context with deadline to bound the time taken.
+func ProbeBucket(ctx context.Context, httpClient *http.Client, endpoint string, bucket string,
+	creds Credentials) error {
+
+	if err := ValidateEndpoint(endpoint); err != nil {
+		return err
+	}
+
+	u, _ := url.Parse(endpoint)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket
+
+	req, err := http.NewRequest(http.MethodHead, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	signRequest(req, creds, defaultRegion, time.Now().UTC())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Unable to reach S3 end point (%s)", err.Error())
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotFound:
+		return nil
+
+	case http.StatusMovedPermanently, http.StatusTemporaryRedirect, http.StatusBadRequest:
+		// Bucket is in a different region. The end point is fine but
+		// credentials can't be verified without knowing the region.
+		return nil
+
+	case http.StatusForbidden, http.StatusUnauthorized:
+		return ErrAccessDenied
+	}
+
+	return fmt.Errorf("Unexpected response from S3 end point (%s)", resp.Status)
+}
+
+// ErrObjectLockNotEnabled is returned if the bucket exists but doesn't
+// have object lock enabled.
+var ErrObjectLockNotEnabled = fmt.Errorf("Object lock is not enabled on the bucket")
+
+// ProbeObjectLock checks that object lock is enabled on the bucket.
+//
+// Similar to ProbeBucket, a missing bucket is not an error. It is created,
+// with object lock enabled, when the repo is initialized.
+func ProbeObjectLock(ctx context.Context, httpClient *http.Client, endpoint string, bucket string,
+	creds Credentials) error {
+
+	if err := ValidateEndpoint(endpoint); err != nil {
+		return err
+	}
+
+	u, _ := url.Parse(endpoint)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket
+	u.RawQuery = "object-lock="
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	signRequest(req, creds, defaultRegion, time.Now().UTC())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Unable to reach S3 end point (%s)", err.Error())
+	}
+	defer resp.Body.Close()
+
+	// Both the configuration and errors are small documents.
+	body := io.LimitReader(resp.Body, 64*1024)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var config struct {
+			ObjectLockEnabled string
+		}
+		if err := xml.NewDecoder(body).Decode(&config); err != nil {
+			return fmt.Errorf("Invalid object lock configuration (%s)", err.Error())
+		}
+
+		if config.ObjectLockEnabled != "Enabled" {
+			return ErrObjectLockNotEnabled
+		}
+		return nil
+
+	case http.StatusNotFound:
+		var s3Err struct {
+			Code string
+		}
+		_ = xml.NewDecoder(body).Decode(&s3Err)
+
+		if s3Err.Code == "NoSuchBucket" {
+			return nil
+		}
+		return ErrObjectLockNotEnabled
+
+	case http.StatusForbidden, http.StatusUnauthorized:
+		return ErrAccessDenied
+	}
+
+	return fmt.Errorf("Unexpected response from S3 end point (%s)", resp.Status)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode escapes a query parameter as required by AWS, which differs
+// from url.QueryEscape in the encoding of spaces.
+func uriEncode(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// canonicalQuery returns the query string of the URL in the form needed
+// for signing.
+func canonicalQuery(u *url.URL) string {
+	var params []string
+	for key, values := range u.Query() {
+		for _, value := range values {
+			params = append(params, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	sort.Strings(params)
+
+	return strings.Join(params, "&")
+}
+
+// signRequest adds AWS signature version 4 headers to a request that has
+// no body.
+func signRequest(req *http.Request, creds Credentials, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + emptyPayloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	if creds.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", creds.SessionToken)
+
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + creds.SessionToken + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}